@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+// GazeAssertionFailure records which output assertion failed an execution and the line that triggered it
+type GazeAssertionFailure struct {
+	Rule    string `json:"rule"`
+	Pattern string `json:"pattern,omitempty"`
+	Line    string `json:"line,omitempty"`
+}
+
+func firstMatchingLine(re *regexp.Regexp, output string) (string, bool) {
+	for _, line := range strings.Split(output, "\n") {
+		if re.MatchString(line) {
+			return line, true
+		}
+	}
+	return "", false
+}
+
+// checkOutputAssertions evaluates the task's output assertions against the captured output of an attempt
+func checkOutputAssertions(task *conf.GazeTaskConfig, output string, stderrBytes int64) []*GazeAssertionFailure {
+	failures := make([]*GazeAssertionFailure, 0)
+	if task == nil {
+		return failures
+	}
+	for i, re := range task.FailIfOutputRegexes {
+		if line, ok := firstMatchingLine(re, output); ok {
+			failures = append(failures, &GazeAssertionFailure{
+				Rule: "fail_if_output_matches", Pattern: task.FailIfOutputMatches[i], Line: line,
+			})
+		}
+	}
+	for i, re := range task.RequireOutputRegexes {
+		if _, ok := firstMatchingLine(re, output); !ok {
+			failures = append(failures, &GazeAssertionFailure{
+				Rule: "require_output_matches", Pattern: task.RequireOutputMatches[i],
+			})
+		}
+	}
+	if task.FailIfOutputEmpty && strings.TrimSpace(output) == "" {
+		failures = append(failures, &GazeAssertionFailure{Rule: "fail_if_output_empty"})
+	}
+	if task.FailIfStderrNonEmpty && stderrBytes > 0 {
+		failures = append(failures, &GazeAssertionFailure{Rule: "fail_if_stderr_nonempty"})
+	}
+	return failures
+}
+
+// describeAssertionFailures builds a short explanation to append to the exit description
+func describeAssertionFailures(failures []*GazeAssertionFailure) string {
+	parts := make([]string, len(failures))
+	for i, f := range failures {
+		switch {
+		case f.Line != "":
+			parts[i] = fmt.Sprintf("%v '%v' matched line '%v'", f.Rule, f.Pattern, f.Line)
+		case f.Pattern != "":
+			parts[i] = fmt.Sprintf("%v '%v' did not match", f.Rule, f.Pattern)
+		default:
+			parts[i] = f.Rule
+		}
+	}
+	return "output assertions failed: " + strings.Join(parts, ", ")
+}
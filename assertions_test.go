@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+func newAssertionsTestConfig(t *testing.T, task *conf.GazeTaskConfig) *conf.GazeConfig {
+	config := &conf.GazeConfig{Tasks: map[string]*conf.GazeTaskConfig{"backup": task}}
+	if err := conf.ValidateAndClean(config); err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+func TestCheckOutputAssertions(t *testing.T) {
+	config := newAssertionsTestConfig(t, &conf.GazeTaskConfig{
+		FailIfOutputMatches:  []string{"(?i)error", "^WARN"},
+		RequireOutputMatches: []string{"^done$", "bytes copied"},
+		FailIfOutputEmpty:    true,
+		FailIfStderrNonEmpty: true,
+	})
+	task := config.Task("backup")
+
+	if failures := checkOutputAssertions(task, "12 bytes copied\ndone\n", 0); len(failures) != 0 {
+		t.Errorf("expected no failures but got %v", describeAssertionFailures(failures))
+	}
+	if failures := checkOutputAssertions(nil, "", 10); len(failures) != 0 {
+		t.Errorf("expected no failures without a task but got %v", describeAssertionFailures(failures))
+	}
+
+	failures := checkOutputAssertions(task, "copying\nan Error occurred\nanother error\ndone\n", 0)
+	expected := "output assertions failed: fail_if_output_matches '(?i)error' matched line 'an Error occurred', " +
+		"require_output_matches 'bytes copied' did not match"
+	if actual := describeAssertionFailures(failures); actual != expected {
+		t.Errorf("expected '%v' but got '%v'", expected, actual)
+	}
+
+	failures = checkOutputAssertions(task, " \n", 5)
+	rules := make([]string, len(failures))
+	for i, f := range failures {
+		rules[i] = f.Rule
+	}
+	expectedRules := "require_output_matches require_output_matches fail_if_output_empty fail_if_stderr_nonempty"
+	if actual := strings.Join(rules, " "); actual != expectedRules {
+		t.Errorf("expected rules '%v' but got '%v'", expectedRules, actual)
+	}
+}
+
+func TestAssertionsOverrideStatus(t *testing.T) {
+	config := newAssertionsTestConfig(t, &conf.GazeTaskConfig{
+		StatusMap:           map[string]string{"3": "warning"},
+		FailIfOutputMatches: []string{"ERROR"},
+	})
+	cases := []struct {
+		script      string
+		description string
+	}{
+		{"echo ERROR: disk full", "Execution finished with no error but output assertions failed: fail_if_output_matches 'ERROR' matched line 'ERROR: disk full'"},
+		{"echo ERROR: disk full; exit 3", "Execution failed with code 3 but output assertions failed: fail_if_output_matches 'ERROR' matched line 'ERROR: disk full'"},
+		{"echo ERROR: disk full; exit 2", "Execution failed with code 2 and output assertions failed: fail_if_output_matches 'ERROR' matched line 'ERROR: disk full'"},
+	}
+	for _, c := range cases {
+		report, err := runReport([]string{"sh", "-c", c.script}, config, "backup", false, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Status != conf.StatusFailure || report.ExitDescription != c.description {
+			t.Errorf("'%v': expected a failure described as '%v' but got %v '%v'", c.script, c.description, report.Status, report.ExitDescription)
+		}
+		if len(report.AssertionFailures) != 1 || report.AssertionFailures[0].Line != "ERROR: disk full" {
+			t.Errorf("'%v': unexpected assertion failures %+v", c.script, report.AssertionFailures)
+		}
+	}
+}
@@ -2,13 +2,16 @@ package main
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"time"
 
 	"github.com/AstromechZA/gaze/conf"
 )
@@ -67,6 +70,58 @@ func RunWebBehaviour(report *GazeReport, config *conf.GazeBehaviourConfig) error
 	return nil
 }
 
+// withoutOutput returns a copy of the report with the captured output removed unless the behaviour includes output
+func withoutOutput(report *GazeReport, config *conf.GazeBehaviourConfig) *GazeReport {
+	if config.IncludeOutput {
+		return report
+	}
+	stripped := *report
+	stripped.CapturedOutput = ""
+	stripped.OutputTail = ""
+	return &stripped
+}
+
+// behaviourHTTPTimeout bounds how long any single http request made by a behaviour can take
+const behaviourHTTPTimeout = 30 * time.Second
+
+// doBehaviourRequest sends a request made by a behaviour and returns the response body, or an error if the response
+// code was not a 2xx.
+func doBehaviourRequest(req *http.Request) ([]byte, error) {
+	client := &http.Client{Timeout: behaviourHTTPTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		log.Infof("Request returned code %v: %v", resp.Status, string(body))
+		return body, fmt.Errorf("%v request to %v failed with code %v", req.Method, req.URL, resp.StatusCode)
+	}
+	return body, nil
+}
+
+// dialBehaviourTCP connects to a tcp server, optionally over tls, with a deadline covering the whole exchange
+func dialBehaviourTCP(address string, useTLS bool, insecureSkipVerify bool) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: behaviourHTTPTimeout}
+	var conn net.Conn
+	var err error
+	if useTLS {
+		host, _, _ := net.SplitHostPort(address)
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, &tls.Config{
+			ServerName:         host,
+			InsecureSkipVerify: insecureSkipVerify,
+		})
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(behaviourHTTPTimeout))
+	return conn, nil
+}
+
 func checkLogDirectoryExists(directoryPath string) error {
 	dstat, err := os.Stat(directoryPath)
 	if err != nil {
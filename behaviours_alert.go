@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+// alertShouldTrigger decides from the outcome of the run whether the alert should fire or resolve
+func alertShouldTrigger(report *GazeReport, config *conf.GazeBehaviourConfig) bool {
+	return report.Status == conf.StatusFailure ||
+		(report.Status == conf.StatusWarning && config.Settings["trigger_on_warning"].(bool))
+}
+
+// alertDetails are the report fields attached to triggered alerts
+func alertDetails(report *GazeReport, includeOutput bool) map[string]interface{} {
+	details := map[string]interface{}{
+		"ulid":             report.Ulid,
+		"command":          strings.Join(report.Command, " "),
+		"status":           report.Status,
+		"exit_code":        report.ExitCode,
+		"exit_description": report.ExitDescription,
+		"elapsed_seconds":  report.ElapsedSeconds,
+		"attempts":         len(report.Attempts),
+		"tags":             report.Tags,
+	}
+	if report.LimitHit != "" {
+		details["limit_hit"] = report.LimitHit
+	}
+	if includeOutput {
+		details["output_tail"] = report.OutputTail
+	}
+	return details
+}
+
+func pagerDutyPayload(report *GazeReport, config *conf.GazeBehaviourConfig, summary string, dedupKey string) interface{} {
+	payload := map[string]interface{}{
+		"routing_key":  config.Settings["routing_key"].(string),
+		"event_action": "resolve",
+		"dedup_key":    dedupKey,
+	}
+	if alertShouldTrigger(report, config) {
+		severity := config.Settings["severity"].(string)
+		if report.Status == conf.StatusWarning {
+			severity = "warning"
+		}
+		payload["event_action"] = "trigger"
+		payload["payload"] = map[string]interface{}{
+			"summary":        summary,
+			"source":         report.Hostname,
+			"severity":       severity,
+			"timestamp":      report.EndTime.Format(time.RFC3339),
+			"component":      report.Name,
+			"class":          "gaze",
+			"custom_details": alertDetails(report, config.IncludeOutput),
+		}
+	}
+	return payload
+}
+
+// alertmanagerPayload builds a single alert, the labels must be identical when firing and resolving so that
+// alertmanager treats them as the same alert.
+func alertmanagerPayload(report *GazeReport, config *conf.GazeBehaviourConfig, summary string) interface{} {
+	labels := map[string]string{}
+	for _, l := range reportTagLabels(report.Tags) {
+		labels[l[0]] = l[1]
+	}
+	labels["alertname"] = config.Settings["alert_name"].(string)
+	labels["name"] = report.Name
+	labels["host"] = report.Hostname
+	labels["severity"] = config.Settings["severity"].(string)
+
+	description := report.ExitDescription
+	if config.IncludeOutput && report.OutputTail != "" {
+		description += "\n\n" + report.OutputTail
+	}
+	alert := map[string]interface{}{
+		"labels":      labels,
+		"annotations": map[string]string{"summary": summary, "description": description, "ulid": report.Ulid},
+		"startsAt":    report.StartTime.Format(time.RFC3339Nano),
+	}
+	endsAt := report.EndTime
+	if alertShouldTrigger(report, config) {
+		endsAt = endsAt.Add(config.Settings["expires_after"].(time.Duration))
+	}
+	alert["endsAt"] = endsAt.Format(time.RFC3339Nano)
+	return []interface{}{alert}
+}
+
+func RunAlertBehaviour(report *GazeReport, config *conf.GazeBehaviourConfig) error {
+	service := config.Settings["service"].(string)
+	alertURL := config.Settings["url"].(string)
+	summary, err := renderReportTemplate("summary", config.Settings["summary"].(string), report)
+	if err != nil {
+		return err
+	}
+
+	var payload interface{}
+	if service == "pagerduty" {
+		dedupKey, err := renderReportTemplate("dedup_key", config.Settings["dedup_key"].(string), report)
+		if err != nil {
+			return err
+		}
+		payload = pagerDutyPayload(report, config, summary, dedupKey)
+	} else {
+		alertURL += "/api/v2/alerts"
+		payload = alertmanagerPayload(report, config, summary)
+	}
+
+	action := "resolve"
+	if alertShouldTrigger(report, config) {
+		action = "trigger"
+	}
+	log.Infof("Sending %v %v to %v..", service, action, alertURL)
+	data, _ := json.Marshal(payload)
+	req, err := http.NewRequest("POST", alertURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if username := config.Settings["username"].(string); username != "" {
+		req.SetBasicAuth(username, config.Settings["password"].(string))
+	}
+	_, err = doBehaviourRequest(req)
+	return err
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+// sendAlerts runs an alert behaviour against the fake receiver for each report and returns the requests
+func sendAlerts(t *testing.T, settings map[string]interface{}, reports ...*GazeReport) []capturedRequest {
+	server, requests := startFakeWebhookReceiver(t)
+	config := &conf.GazeBehaviourConfig{Type: "alert", When: "always", Settings: map[string]interface{}{"url": server.URL}}
+	for k, v := range settings {
+		config.Settings[k] = v
+	}
+	if err := conf.ValidateGazeAlertBehaviour(config); err != nil {
+		t.Fatal(err)
+	}
+	for _, report := range reports {
+		if err := RunAlertBehaviour(report, config); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(*requests) != len(reports) {
+		t.Fatalf("expected %d requests but got %d", len(reports), len(*requests))
+	}
+	return *requests
+}
+
+func newAlertTestReport(status string) *GazeReport {
+	report := newChatTestReport()
+	report.Status = status
+	report.StartTime = time.Date(2026, 1, 2, 3, 4, 0, 0, time.UTC)
+	if status == conf.StatusSuccess {
+		report.ExitCode, report.ExitDescription = 0, "Execution succeeded"
+	}
+	return report
+}
+
+func TestAlertBehaviourPagerDuty(t *testing.T) {
+	requests := sendAlerts(
+		t, map[string]interface{}{"service": "pagerduty", "routing_key": "R0123"},
+		newAlertTestReport(conf.StatusFailure), newAlertTestReport(conf.StatusSuccess),
+	)
+	trigger, resolve := decodeJSONRequest(t, requests[0]), decodeJSONRequest(t, requests[1])
+	if trigger["event_action"] != "trigger" || resolve["event_action"] != "resolve" {
+		t.Errorf("expected a trigger then a resolve but got %v and %v", trigger["event_action"], resolve["event_action"])
+	}
+	for _, payload := range []map[string]interface{}{trigger, resolve} {
+		if payload["dedup_key"] != "gaze/host1/backup" || payload["routing_key"] != "R0123" {
+			t.Errorf("unexpected dedup or routing key in %v", payload)
+		}
+	}
+	details := trigger["payload"].(map[string]interface{})
+	if details["summary"] != "backup on host1: Execution failed with code 2" || details["severity"] != "error" ||
+		details["source"] != "host1" || details["timestamp"] != "2026-01-02T03:04:05Z" {
+		t.Errorf("unexpected trigger payload %v", details)
+	}
+	if _, ok := resolve["payload"]; ok {
+		t.Errorf("expected no payload when resolving but got %v", resolve["payload"])
+	}
+}
+
+func TestAlertBehaviourAlertmanager(t *testing.T) {
+	cases := []struct {
+		name     string
+		settings map[string]interface{}
+		status   string
+		endsAt   string
+	}{
+		{"failure", map[string]interface{}{}, conf.StatusFailure, "2026-01-03T05:04:05Z"},
+		{"failure with expires_after", map[string]interface{}{"expires_after": "90m"}, conf.StatusFailure, "2026-01-02T04:34:05Z"},
+		{"warning", map[string]interface{}{}, conf.StatusWarning, "2026-01-02T03:04:05Z"},
+		{"warning with trigger_on_warning", map[string]interface{}{"trigger_on_warning": true}, conf.StatusWarning, "2026-01-03T05:04:05Z"},
+		{"success", map[string]interface{}{}, conf.StatusSuccess, "2026-01-02T03:04:05Z"},
+	}
+	expectedLabels := map[string]interface{}{
+		"alertname": "GazeTaskFailed", "name": "backup", "host": "host1", "severity": "error", "env": "prod",
+	}
+	for _, c := range cases {
+		c.settings["service"] = "alertmanager"
+		request := sendAlerts(t, c.settings, newAlertTestReport(c.status))[0]
+		if request.path != "/api/v2/alerts" {
+			t.Errorf("%v: unexpected path %v", c.name, request.path)
+		}
+		var alerts []map[string]interface{}
+		if err := json.Unmarshal(request.body, &alerts); err != nil || len(alerts) != 1 {
+			t.Fatalf("%v: expected a single alert but got %s", c.name, request.body)
+		}
+		if alerts[0]["startsAt"] != "2026-01-02T03:04:00Z" || alerts[0]["endsAt"] != c.endsAt {
+			t.Errorf("%v: expected to start at 2026-01-02T03:04:00Z and end at %v but got %v and %v",
+				c.name, c.endsAt, alerts[0]["startsAt"], alerts[0]["endsAt"])
+		}
+		// the labels identify the alert so they must not change between firing and resolving
+		if labels := alerts[0]["labels"]; !reflect.DeepEqual(labels, expectedLabels) {
+			t.Errorf("%v: expected labels %v but got %v", c.name, expectedLabels, labels)
+		}
+	}
+}
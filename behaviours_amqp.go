@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+// AMQP 0-9-1 frame types and the class and method ids that gaze sends or expects
+const (
+	amqpFrameMethod    = 1
+	amqpFrameHeader    = 2
+	amqpFrameBody      = 3
+	amqpFrameHeartbeat = 8
+	amqpFrameEnd       = 0xce
+
+	amqpClassConnection = 10
+	amqpClassChannel    = 20
+	amqpClassBasic      = 60
+	amqpClassConfirm    = 85
+)
+
+type amqpMethodID struct {
+	class  uint16
+	method uint16
+}
+
+var (
+	amqpConnectionStart   = amqpMethodID{amqpClassConnection, 10}
+	amqpConnectionStartOk = amqpMethodID{amqpClassConnection, 11}
+	amqpConnectionTune    = amqpMethodID{amqpClassConnection, 30}
+	amqpConnectionTuneOk  = amqpMethodID{amqpClassConnection, 31}
+	amqpConnectionOpen    = amqpMethodID{amqpClassConnection, 40}
+	amqpConnectionOpenOk  = amqpMethodID{amqpClassConnection, 41}
+	amqpConnectionClose   = amqpMethodID{amqpClassConnection, 50}
+	amqpConnectionCloseOk = amqpMethodID{amqpClassConnection, 51}
+	amqpChannelOpen       = amqpMethodID{amqpClassChannel, 10}
+	amqpChannelOpenOk     = amqpMethodID{amqpClassChannel, 11}
+	amqpChannelClose      = amqpMethodID{amqpClassChannel, 40}
+	amqpConfirmSelect     = amqpMethodID{amqpClassConfirm, 10}
+	amqpConfirmSelectOk   = amqpMethodID{amqpClassConfirm, 11}
+	amqpBasicPublish      = amqpMethodID{amqpClassBasic, 40}
+	amqpBasicAck          = amqpMethodID{amqpClassBasic, 80}
+	amqpBasicNack         = amqpMethodID{amqpClassBasic, 120}
+)
+
+// amqpWriter builds the arguments of a method or content header in the AMQP wire format
+type amqpWriter struct {
+	bytes.Buffer
+}
+
+func (w *amqpWriter) octet(v byte) {
+	w.WriteByte(v)
+}
+
+func (w *amqpWriter) short(v uint16) {
+	binary.Write(w, binary.BigEndian, v)
+}
+
+func (w *amqpWriter) long(v uint32) {
+	binary.Write(w, binary.BigEndian, v)
+}
+
+func (w *amqpWriter) longlong(v uint64) {
+	binary.Write(w, binary.BigEndian, v)
+}
+
+func (w *amqpWriter) shortstr(v string) {
+	if len(v) > 255 {
+		v = v[:255]
+	}
+	w.octet(byte(len(v)))
+	w.WriteString(v)
+}
+
+func (w *amqpWriter) longstr(v string) {
+	w.long(uint32(len(v)))
+	w.WriteString(v)
+}
+
+// table writes a field table where every value is a long string
+func (w *amqpWriter) table(values map[string]string) {
+	var inner amqpWriter
+	for k, v := range values {
+		inner.shortstr(k)
+		inner.octet('S')
+		inner.longstr(v)
+	}
+	w.longstr(inner.String())
+}
+
+// amqpConnection is a single channel connection that only supports what is needed to publish a message
+type amqpConnection struct {
+	conn     net.Conn
+	reader   *bufio.Reader
+	frameMax uint32
+}
+
+func (c *amqpConnection) writeFrame(frameType byte, channel uint16, payload []byte) error {
+	var frame amqpWriter
+	frame.octet(frameType)
+	frame.short(channel)
+	frame.long(uint32(len(payload)))
+	frame.Write(payload)
+	frame.octet(amqpFrameEnd)
+	_, err := c.conn.Write(frame.Bytes())
+	return err
+}
+
+func (c *amqpConnection) writeMethod(channel uint16, id amqpMethodID, args func(w *amqpWriter)) error {
+	var w amqpWriter
+	w.short(id.class)
+	w.short(id.method)
+	if args != nil {
+		args(&w)
+	}
+	return c.writeFrame(amqpFrameMethod, channel, w.Bytes())
+}
+
+// readMethod reads the next method frame, skipping heartbeats and returning an error if the server closes the
+// channel or connection.
+func (c *amqpConnection) readMethod() (amqpMethodID, []byte, error) {
+	for {
+		var header [7]byte
+		if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+			return amqpMethodID{}, nil, err
+		}
+		payload := make([]byte, binary.BigEndian.Uint32(header[3:])+1)
+		if _, err := io.ReadFull(c.reader, payload); err != nil {
+			return amqpMethodID{}, nil, err
+		}
+		if payload[len(payload)-1] != amqpFrameEnd {
+			return amqpMethodID{}, nil, fmt.Errorf("AMQP frame was not terminated correctly")
+		}
+		payload = payload[:len(payload)-1]
+		if header[0] == amqpFrameHeartbeat {
+			continue
+		}
+		if header[0] != amqpFrameMethod || len(payload) < 4 {
+			return amqpMethodID{}, nil, fmt.Errorf("AMQP server sent unexpected frame type %v", header[0])
+		}
+		id := amqpMethodID{binary.BigEndian.Uint16(payload), binary.BigEndian.Uint16(payload[2:])}
+		args := payload[4:]
+		if id == amqpConnectionClose || id == amqpChannelClose {
+			// both start with a reply code and reply text
+			text := ""
+			if len(args) >= 3 && len(args) >= 3+int(args[2]) {
+				text = string(args[3 : 3+int(args[2])])
+			}
+			closed := "channel"
+			if id == amqpConnectionClose {
+				closed = "connection"
+				c.writeMethod(0, amqpConnectionCloseOk, nil)
+			}
+			return id, args, fmt.Errorf("AMQP server closed the %v: %v", closed, text)
+		}
+		return id, args, nil
+	}
+}
+
+func (c *amqpConnection) expectMethod(expected amqpMethodID) ([]byte, error) {
+	id, args, err := c.readMethod()
+	if err != nil {
+		return nil, err
+	}
+	if id != expected {
+		return nil, fmt.Errorf("AMQP server sent method %v.%v instead of %v.%v", id.class, id.method, expected.class, expected.method)
+	}
+	return args, nil
+}
+
+// open performs the connection handshake with plain authentication and opens channel 1 in confirm mode
+func (c *amqpConnection) open(vhost string, username string, password string) error {
+	if _, err := c.conn.Write([]byte("AMQP\x00\x00\x09\x01")); err != nil {
+		return err
+	}
+	if _, err := c.expectMethod(amqpConnectionStart); err != nil {
+		return err
+	}
+	err := c.writeMethod(0, amqpConnectionStartOk, func(w *amqpWriter) {
+		w.table(map[string]string{"product": "gaze", "version": Version})
+		w.shortstr("PLAIN")
+		w.longstr("\x00" + username + "\x00" + password)
+		w.shortstr("en_US")
+	})
+	if err != nil {
+		return err
+	}
+	tune, err := c.expectMethod(amqpConnectionTune)
+	if err != nil {
+		return err
+	}
+	if len(tune) < 6 {
+		return fmt.Errorf("AMQP server sent a short tune method")
+	}
+	c.frameMax = binary.BigEndian.Uint32(tune[2:])
+	if c.frameMax == 0 || c.frameMax > 128*1024 {
+		c.frameMax = 128 * 1024
+	}
+	err = c.writeMethod(0, amqpConnectionTuneOk, func(w *amqpWriter) {
+		w.short(1)
+		w.long(c.frameMax)
+		w.short(0) // no heartbeats since the connection is short lived
+	})
+	if err != nil {
+		return err
+	}
+	if err := c.writeMethod(0, amqpConnectionOpen, func(w *amqpWriter) {
+		w.shortstr(vhost)
+		w.shortstr("")
+		w.octet(0)
+	}); err != nil {
+		return err
+	}
+	if _, err := c.expectMethod(amqpConnectionOpenOk); err != nil {
+		return err
+	}
+	if err := c.writeMethod(1, amqpChannelOpen, func(w *amqpWriter) { w.shortstr("") }); err != nil {
+		return err
+	}
+	if _, err := c.expectMethod(amqpChannelOpenOk); err != nil {
+		return err
+	}
+	if err := c.writeMethod(1, amqpConfirmSelect, func(w *amqpWriter) { w.octet(0) }); err != nil {
+		return err
+	}
+	_, err = c.expectMethod(amqpConfirmSelectOk)
+	return err
+}
+
+// publish sends the message and waits for the broker to confirm it
+func (c *amqpConnection) publish(exchange string, routingKey string, body []byte, messageID string, persistent bool) error {
+	err := c.writeMethod(1, amqpBasicPublish, func(w *amqpWriter) {
+		w.short(0)
+		w.shortstr(exchange)
+		w.shortstr(routingKey)
+		w.octet(0)
+	})
+	if err != nil {
+		return err
+	}
+
+	var header amqpWriter
+	header.short(amqpClassBasic)
+	header.short(0)
+	header.longlong(uint64(len(body)))
+	// property flags for content-type, delivery-mode, message-id, timestamp, and app-id
+	header.short(1<<15 | 1<<12 | 1<<7 | 1<<6 | 1<<3)
+	header.shortstr("application/json")
+	if persistent {
+		header.octet(2)
+	} else {
+		header.octet(1)
+	}
+	header.shortstr(messageID)
+	header.longlong(uint64(time.Now().Unix()))
+	header.shortstr("gaze")
+	if err := c.writeFrame(amqpFrameHeader, 1, header.Bytes()); err != nil {
+		return err
+	}
+
+	// a frame has 8 bytes of overhead
+	chunkSize := int(c.frameMax) - 8
+	for len(body) > 0 {
+		n := chunkSize
+		if n > len(body) {
+			n = len(body)
+		}
+		if err := c.writeFrame(amqpFrameBody, 1, body[:n]); err != nil {
+			return err
+		}
+		body = body[n:]
+	}
+
+	id, _, err := c.readMethod()
+	if err != nil {
+		return err
+	}
+	if id == amqpBasicNack {
+		return fmt.Errorf("AMQP server rejected the message")
+	}
+	if id != amqpBasicAck {
+		return fmt.Errorf("AMQP server sent method %v.%v instead of an ack", id.class, id.method)
+	}
+	return nil
+}
+
+func (c *amqpConnection) close() error {
+	err := c.writeMethod(0, amqpConnectionClose, func(w *amqpWriter) {
+		w.short(200)
+		w.shortstr("")
+		w.short(0)
+		w.short(0)
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.expectMethod(amqpConnectionCloseOk)
+	return err
+}
+
+func RunAMQPBehaviour(report *GazeReport, config *conf.GazeBehaviourConfig) error {
+	address := config.Settings["address"].(string)
+	exchange := config.Settings["exchange"].(string)
+	routingKey, err := renderReportTemplate("routing_key", config.Settings["routing_key"].(string), report)
+	if err != nil {
+		return err
+	}
+	body, _ := json.Marshal(withoutOutput(report, config))
+
+	log.Infof("Publishing to AMQP exchange '%v' with routing key '%v' on %v..", exchange, routingKey, address)
+	conn, err := dialBehaviourTCP(address, config.Settings["tls"].(bool), config.Settings["insecure_skip_verify"].(bool))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	c := &amqpConnection{conn: conn, reader: bufio.NewReader(conn)}
+	if err := c.open(
+		config.Settings["vhost"].(string), config.Settings["username"].(string), config.Settings["password"].(string),
+	); err != nil {
+		return err
+	}
+	if err := c.publish(exchange, routingKey, body, report.Ulid, config.Settings["persistent"].(bool)); err != nil {
+		return err
+	}
+	return c.close()
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// fakeAMQPFrame is a single frame read by the fake broker
+type fakeAMQPFrame struct {
+	frameType byte
+	channel   uint16
+	payload   []byte
+}
+
+func (f fakeAMQPFrame) method() amqpMethodID {
+	return amqpMethodID{binary.BigEndian.Uint16(f.payload), binary.BigEndian.Uint16(f.payload[2:])}
+}
+
+func readFakeAMQPFrame(r *bufio.Reader) (fakeAMQPFrame, error) {
+	var header [7]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return fakeAMQPFrame{}, err
+	}
+	payload := make([]byte, binary.BigEndian.Uint32(header[3:])+1)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return fakeAMQPFrame{}, err
+	}
+	if payload[len(payload)-1] != amqpFrameEnd {
+		return fakeAMQPFrame{}, io.ErrUnexpectedEOF
+	}
+	return fakeAMQPFrame{header[0], binary.BigEndian.Uint16(header[1:]), payload[:len(payload)-1]}, nil
+}
+
+// runFakeAMQPBroker performs the server side of the handshake on a pipe with a small frame max, records every frame
+// the client sends, and replies to the publish with the given method.
+func runFakeAMQPBroker(t *testing.T, conn net.Conn, publishReply func(c *amqpConnection)) chan []fakeAMQPFrame {
+	result := make(chan []fakeAMQPFrame, 1)
+	go func() {
+		defer conn.Close()
+		frames := make([]fakeAMQPFrame, 0)
+		defer func() { result <- frames }()
+		c := &amqpConnection{conn: conn, reader: bufio.NewReader(conn)}
+		protocol := make([]byte, 8)
+		if _, err := io.ReadFull(c.reader, protocol); err != nil || string(protocol) != "AMQP\x00\x00\x09\x01" {
+			return
+		}
+		c.writeMethod(0, amqpConnectionStart, func(w *amqpWriter) {
+			w.octet(0)
+			w.octet(9)
+			w.table(map[string]string{"product": "fake"})
+			w.longstr("PLAIN")
+			w.longstr("en_US")
+		})
+		bodySize := uint64(0)
+		for {
+			frame, err := readFakeAMQPFrame(c.reader)
+			if err != nil {
+				return
+			}
+			frames = append(frames, frame)
+			switch frame.frameType {
+			case amqpFrameHeader:
+				bodySize = binary.BigEndian.Uint64(frame.payload[4:])
+				continue
+			case amqpFrameBody:
+				bodySize -= uint64(len(frame.payload))
+				if bodySize == 0 {
+					publishReply(c)
+				}
+				continue
+			}
+			switch frame.method() {
+			case amqpConnectionStartOk:
+				c.writeMethod(0, amqpConnectionTune, func(w *amqpWriter) {
+					w.short(1)
+					w.long(32)
+					w.short(60)
+				})
+			case amqpConnectionOpen:
+				c.writeMethod(0, amqpConnectionOpenOk, func(w *amqpWriter) { w.shortstr("") })
+			case amqpChannelOpen:
+				c.writeMethod(1, amqpChannelOpenOk, func(w *amqpWriter) { w.longstr("") })
+			case amqpConfirmSelect:
+				c.writeMethod(1, amqpConfirmSelectOk, nil)
+			case amqpConnectionClose:
+				c.writeMethod(0, amqpConnectionCloseOk, nil)
+				return
+			}
+		}
+	}()
+	return result
+}
+
+func TestAMQPPublish(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	result := runFakeAMQPBroker(t, server, func(c *amqpConnection) {
+		c.writeFrame(amqpFrameHeartbeat, 0, nil)
+		c.writeMethod(1, amqpBasicAck, func(w *amqpWriter) {
+			w.longlong(1)
+			w.octet(0)
+		})
+	})
+	c := &amqpConnection{conn: client, reader: bufio.NewReader(client)}
+	if err := c.open("/", "guest", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if c.frameMax != 32 {
+		t.Errorf("expected the frame max from the tune method but got %d", c.frameMax)
+	}
+	body := strings.Repeat("0123456789", 6)
+	if err := c.publish("amq.topic", "gaze.backup.failure", []byte(body), "01BX5ZZKBKACTAV9WEVGEMMVRZ", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.close(); err != nil {
+		t.Fatal(err)
+	}
+	frames := <-result
+
+	methods := make([]amqpMethodID, 0)
+	bodyFrames := make([]string, 0)
+	var header []byte
+	for _, frame := range frames {
+		switch frame.frameType {
+		case amqpFrameMethod:
+			methods = append(methods, frame.method())
+		case amqpFrameHeader:
+			header = frame.payload
+		case amqpFrameBody:
+			bodyFrames = append(bodyFrames, string(frame.payload))
+		}
+	}
+	expectedMethods := []amqpMethodID{
+		amqpConnectionStartOk, amqpConnectionTuneOk, amqpConnectionOpen, amqpChannelOpen, amqpConfirmSelect,
+		amqpBasicPublish, amqpConnectionClose,
+	}
+	if len(methods) != len(expectedMethods) {
+		t.Fatalf("expected methods %v but got %v", expectedMethods, methods)
+	}
+	for i := range methods {
+		if methods[i] != expectedMethods[i] {
+			t.Errorf("expected method %v to be %v but got %v", i, expectedMethods[i], methods[i])
+		}
+	}
+
+	// the start-ok carries the plain credentials after the client properties and the mechanism
+	startOk := string(frames[0].payload)
+	if !strings.Contains(startOk, "\x05PLAIN\x00\x00\x00\x0d\x00guest\x00secret") {
+		t.Errorf("expected plain credentials in the start-ok %q", startOk)
+	}
+	// a frame max of 32 leaves 24 bytes of body in each frame
+	if len(bodyFrames) != 3 || strings.Join(bodyFrames, "") != body || len(bodyFrames[0]) != 24 {
+		t.Errorf("expected the body in 3 frames but got %q", bodyFrames)
+	}
+	if binary.BigEndian.Uint64(header[4:]) != uint64(len(body)) {
+		t.Errorf("expected the header to carry the body size")
+	}
+	if !strings.Contains(string(header), "\x10application/json\x02\x1a01BX5ZZKBKACTAV9WEVGEMMVRZ") {
+		t.Errorf("expected the content type, persistent delivery mode, and message id in the header %q", header)
+	}
+}
+
+func TestAMQPPublishRejected(t *testing.T) {
+	for expected, reply := range map[string]func(c *amqpConnection){
+		"AMQP server rejected the message": func(c *amqpConnection) {
+			c.writeMethod(1, amqpBasicNack, func(w *amqpWriter) {
+				w.longlong(1)
+				w.octet(0)
+			})
+		},
+		"AMQP server closed the channel: NOT_FOUND - no exchange 'missing'": func(c *amqpConnection) {
+			c.writeMethod(1, amqpChannelClose, func(w *amqpWriter) {
+				w.short(404)
+				w.shortstr("NOT_FOUND - no exchange 'missing'")
+				w.short(amqpClassBasic)
+				w.short(40)
+			})
+		},
+	} {
+		client, server := net.Pipe()
+		runFakeAMQPBroker(t, server, reply)
+		c := &amqpConnection{conn: client, reader: bufio.NewReader(client)}
+		if err := c.open("/", "guest", "guest"); err != nil {
+			t.Fatal(err)
+		}
+		err := c.publish("missing", "key", []byte("{}"), "id", false)
+		client.Close()
+		if err == nil || err.Error() != expected {
+			t.Errorf("expected '%v' but got %v", expected, err)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+// chatColours are the hex colours used for each status
+var chatColours = map[string]string{
+	conf.StatusSuccess: "2eb886",
+	conf.StatusWarning: "daa038",
+	conf.StatusFailure: "a30200",
+	conf.StatusRunning: "439fe0",
+}
+
+// chatMessage is the content common to every chat flavour
+type chatMessage struct {
+	Title       string
+	Description string
+	Colour      string
+	Facts       [][2]string
+	OutputTail  string
+	Time        time.Time
+}
+
+// formatElapsed formats the elapsed seconds of a report as a rounded duration
+func formatElapsed(seconds float32) string {
+	d := time.Duration(float64(seconds) * float64(time.Second))
+	if d > time.Minute {
+		return d.Round(time.Second).String()
+	}
+	return d.Round(time.Millisecond).String()
+}
+
+func buildChatMessage(report *GazeReport, title string, includeOutput bool) *chatMessage {
+	tags := strings.Join(report.Tags, ", ")
+	if tags == "" {
+		tags = "-"
+	}
+	message := &chatMessage{
+		Title:       title,
+		Description: report.ExitDescription,
+		Colour:      chatColours[report.Status],
+		Facts: [][2]string{
+			{"Status", report.Status},
+			{"Exit Code", strconv.Itoa(report.ExitCode)},
+			{"Duration", formatElapsed(report.ElapsedSeconds)},
+			{"Host", report.Hostname},
+			{"Tags", tags},
+			{"Attempts", strconv.Itoa(len(report.Attempts))},
+		},
+		Time: report.EndTime,
+	}
+	if report.Status == conf.StatusRunning {
+		message.Time = time.Now()
+	}
+	if includeOutput {
+		// stop the output from closing the code block early
+		message.OutputTail = strings.Replace(strings.TrimRight(report.OutputTail, "\n"), "```", "` ` `", -1)
+	}
+	return message
+}
+
+// codeBlock returns the output tail as a markdown code block after a blank line, or nothing if there is no output
+func (m *chatMessage) codeBlock() string {
+	if m.OutputTail == "" {
+		return ""
+	}
+	return "\n\n```\n" + m.OutputTail + "\n```"
+}
+
+// htmlEscaper escapes the characters that slack and mattermost use for links and mentions such as <!channel>, which
+// are also the ones that need escaping in the html of teams message cards
+var htmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// slackPayload builds an attachment which is understood by both slack and mattermost
+func slackPayload(m *chatMessage, username string) interface{} {
+	fields := make([]map[string]interface{}, len(m.Facts))
+	for i, f := range m.Facts {
+		fields[i] = map[string]interface{}{"title": f[0], "value": f[1], "short": true}
+	}
+	payload := map[string]interface{}{
+		"text": m.Title,
+		"attachments": []map[string]interface{}{{
+			"fallback":  m.Title + ": " + m.Description,
+			"color":     "#" + m.Colour,
+			"title":     m.Title,
+			"text":      htmlEscaper.Replace(m.Description) + m.codeBlock(),
+			"fields":    fields,
+			"footer":    "gaze",
+			"ts":        m.Time.Unix(),
+			"mrkdwn_in": []string{"text"},
+		}},
+	}
+	if username != "" {
+		payload["username"] = username
+	}
+	return payload
+}
+
+// discordMaxDescription is a little under the 4096 character limit of an embed description
+const discordMaxDescription = 4000
+
+func discordPayload(m *chatMessage, username string) interface{} {
+	fields := make([]map[string]interface{}, len(m.Facts))
+	for i, f := range m.Facts {
+		fields[i] = map[string]interface{}{"name": f[0], "value": f[1], "inline": true}
+	}
+	// embed descriptions are limited to 4096 characters so cut down a long exit description and keep the end of the
+	// output when they are too long
+	trimmed := *m
+	if len(trimmed.Description) > discordMaxDescription {
+		trimmed.Description = strings.ToValidUTF8(trimmed.Description[:discordMaxDescription-3], "") + "…"
+	}
+	if room := discordMaxDescription - len(trimmed.Description) - 16; len(m.OutputTail) > room {
+		trimmed.OutputTail = ""
+		if room > 0 {
+			trimmed.OutputTail = "…" + strings.ToValidUTF8(m.OutputTail[len(m.OutputTail)-room:], "")
+		}
+	}
+	description := trimmed.Description + trimmed.codeBlock()
+	colour, _ := strconv.ParseInt(m.Colour, 16, 32)
+	payload := map[string]interface{}{
+		"embeds": []map[string]interface{}{{
+			"title":       m.Title,
+			"description": description,
+			"color":       colour,
+			"fields":      fields,
+			"timestamp":   m.Time.UTC().Format(time.RFC3339),
+		}},
+	}
+	if username != "" {
+		payload["username"] = username
+	}
+	return payload
+}
+
+func teamsMessageCardPayload(m *chatMessage) interface{} {
+	facts := make([]map[string]string, len(m.Facts))
+	for i, f := range m.Facts {
+		facts[i] = map[string]string{"name": f[0], "value": f[1]}
+	}
+	section := map[string]interface{}{"facts": facts}
+	if m.OutputTail != "" {
+		section["text"] = "<pre>" + htmlEscaper.Replace(m.OutputTail) + "</pre>"
+	}
+	return map[string]interface{}{
+		"@type":      "MessageCard",
+		"@context":   "https://schema.org/extensions",
+		"themeColor": m.Colour,
+		"summary":    m.Title,
+		"title":      m.Title,
+		"text":       htmlEscaper.Replace(m.Description),
+		"sections":   []interface{}{section},
+	}
+}
+
+// adaptiveCardColours maps the status colours onto the named colours available to adaptive cards
+var adaptiveCardColours = map[string]string{
+	conf.StatusSuccess: "Good",
+	conf.StatusWarning: "Warning",
+	conf.StatusFailure: "Attention",
+	conf.StatusRunning: "Accent",
+}
+
+func teamsAdaptiveCardPayload(m *chatMessage, status string) interface{} {
+	facts := make([]map[string]string, len(m.Facts))
+	for i, f := range m.Facts {
+		facts[i] = map[string]string{"title": f[0], "value": f[1]}
+	}
+	body := []interface{}{
+		map[string]interface{}{
+			"type": "TextBlock", "text": m.Title, "weight": "Bolder", "size": "Medium", "wrap": true,
+			"color": adaptiveCardColours[status],
+		},
+		map[string]interface{}{"type": "TextBlock", "text": m.Description, "wrap": true},
+		map[string]interface{}{"type": "FactSet", "facts": facts},
+	}
+	if m.OutputTail != "" {
+		body = append(body, map[string]interface{}{
+			"type": "TextBlock", "text": m.OutputTail, "fontType": "Monospace", "wrap": true,
+		})
+	}
+	return map[string]interface{}{
+		"type": "message",
+		"attachments": []interface{}{map[string]interface{}{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content": map[string]interface{}{
+				"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+				"type":    "AdaptiveCard",
+				"version": "1.4",
+				"body":    body,
+			},
+		}},
+	}
+}
+
+// ntfyPriorities and ntfyTags map the status onto the ntfy priority and an emoji tag
+var ntfyPriorities = map[string]string{
+	conf.StatusSuccess: "low", conf.StatusWarning: "default", conf.StatusFailure: "high", conf.StatusRunning: "min",
+}
+var ntfyTags = map[string]string{
+	conf.StatusSuccess: "white_check_mark", conf.StatusWarning: "warning", conf.StatusFailure: "rotating_light",
+	conf.StatusRunning: "hourglass_flowing_sand",
+}
+
+// ntfyRequest builds a plain text message with the title, priority, and tags in headers
+func ntfyRequest(m *chatMessage, report *GazeReport, url string) (*http.Request, error) {
+	lines := []string{m.Description}
+	for _, f := range m.Facts[1:] {
+		lines = append(lines, fmt.Sprintf("%v: %v", f[0], f[1]))
+	}
+	body := strings.Join(lines, "\n")
+	if m.OutputTail != "" {
+		body += "\n\n" + m.OutputTail
+	}
+	req, err := http.NewRequest("POST", url, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	// headers can only carry ascii, so anything else is sent as an rfc 2047 encoded word which ntfy decodes
+	req.Header.Set("Title", mime.BEncoding.Encode("utf-8", strings.Join(strings.Fields(m.Title), " ")))
+	req.Header.Set("Priority", ntfyPriorities[report.Status])
+	tags := strings.Join(append([]string{ntfyTags[report.Status]}, report.Tags...), ",")
+	req.Header.Set("Tags", mime.BEncoding.Encode("utf-8", tags))
+	return req, nil
+}
+
+func RunChatBehaviour(report *GazeReport, config *conf.GazeBehaviourConfig) error {
+	flavour := config.Settings["flavour"].(string)
+	chatURL := config.Settings["url"].(string)
+	username := config.Settings["username"].(string)
+	title, err := renderReportTemplate("title", config.Settings["title"].(string), report)
+	if err != nil {
+		return err
+	}
+	message := buildChatMessage(report, title, config.IncludeOutput)
+
+	var req *http.Request
+	if flavour == "ntfy" {
+		if req, err = ntfyRequest(message, report, chatURL); err != nil {
+			return err
+		}
+		if token := config.Settings["token"].(string); token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	} else {
+		var payload interface{}
+		switch flavour {
+		case "slack", "mattermost":
+			payload = slackPayload(message, username)
+		case "discord":
+			payload = discordPayload(message, username)
+		case "teams":
+			if config.Settings["card"].(string) == "message_card" {
+				payload = teamsMessageCardPayload(message)
+			} else {
+				payload = teamsAdaptiveCardPayload(message, report.Status)
+			}
+		}
+		data, _ := json.Marshal(payload)
+		if req, err = http.NewRequest("POST", chatURL, bytes.NewReader(data)); err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	log.Infof("Sending %v message to %v..", flavour, chatURL)
+	_, err = doBehaviourRequest(req)
+	return err
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+// capturedRequest is a request received by the fake webhook receiver
+type capturedRequest struct {
+	method string
+	path   string
+	header http.Header
+	body   []byte
+}
+
+// startFakeWebhookReceiver records every request it receives and responds with a 200
+func startFakeWebhookReceiver(t *testing.T) (*httptest.Server, *[]capturedRequest) {
+	requests := make([]capturedRequest, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, capturedRequest{method: r.Method, path: r.URL.Path, header: r.Header, body: body})
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func newChatTestReport() *GazeReport {
+	return &GazeReport{
+		Ulid: "01BX5ZZKBKACTAV9WEVGEMMVRZ", Name: "backup", Hostname: "host1", Status: conf.StatusFailure,
+		ExitCode: 2, ExitDescription: "Execution failed with code 2", ElapsedSeconds: 1.5,
+		EndTime: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), Tags: []string{"env:prod"},
+		OutputTail: "some output\n", Attempts: []*GazeAttempt{{Number: 1}},
+	}
+}
+
+// sendChatMessage runs a chat behaviour of the given flavour against the fake receiver and returns the one request
+func sendChatMessage(t *testing.T, report *GazeReport, settings map[string]interface{}) capturedRequest {
+	server, requests := startFakeWebhookReceiver(t)
+	config := &conf.GazeBehaviourConfig{Type: "chat", IncludeOutput: true, Settings: map[string]interface{}{
+		"url": server.URL + "/hook",
+	}}
+	for k, v := range settings {
+		config.Settings[k] = v
+	}
+	if err := conf.ValidateGazeChatBehaviour(config); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunChatBehaviour(report, config); err != nil {
+		t.Fatal(err)
+	}
+	if len(*requests) != 1 {
+		t.Fatalf("expected 1 request but got %d", len(*requests))
+	}
+	request := (*requests)[0]
+	if request.method != "POST" || request.path != "/hook" {
+		t.Errorf("expected POST /hook but got %v %v", request.method, request.path)
+	}
+	return request
+}
+
+func decodeJSONRequest(t *testing.T, request capturedRequest) map[string]interface{} {
+	if ct := request.header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected a json content type but got '%v'", ct)
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(request.body, &payload); err != nil {
+		t.Fatalf("body is not json: %v: %s", err, request.body)
+	}
+	return payload
+}
+
+func TestChatBehaviourSlackAndMattermost(t *testing.T) {
+	for _, flavour := range []string{"slack", "mattermost"} {
+		request := sendChatMessage(t, newChatTestReport(), map[string]interface{}{"flavour": flavour, "username": "gaze"})
+		payload := decodeJSONRequest(t, request)
+		if payload["text"] != "backup failure on host1" || payload["username"] != "gaze" {
+			t.Errorf("%v: unexpected text or username in %v", flavour, payload)
+		}
+		attachment := payload["attachments"].([]interface{})[0].(map[string]interface{})
+		if attachment["color"] != "#a30200" {
+			t.Errorf("%v: expected the failure colour but got %v", flavour, attachment["color"])
+		}
+		if attachment["text"] != "Execution failed with code 2\n\n```\nsome output\n```" {
+			t.Errorf("%v: unexpected attachment text %q", flavour, attachment["text"])
+		}
+		if len(attachment["fields"].([]interface{})) != 6 || attachment["ts"] != float64(1767323045) {
+			t.Errorf("%v: unexpected fields or timestamp in %v", flavour, attachment)
+		}
+	}
+}
+
+func TestChatBehaviourEscapesDescription(t *testing.T) {
+	report := newChatTestReport()
+	report.ExitDescription = "Output did not match <!channel> & <@U123>"
+	escaped := "Output did not match &lt;!channel&gt; &amp; &lt;@U123&gt;"
+	for _, flavour := range []string{"slack", "mattermost"} {
+		payload := decodeJSONRequest(t, sendChatMessage(t, report, map[string]interface{}{"flavour": flavour}))
+		attachment := payload["attachments"].([]interface{})[0].(map[string]interface{})
+		if !strings.HasPrefix(attachment["text"].(string), escaped+"\n") {
+			t.Errorf("%v: expected an escaped description but got %q", flavour, attachment["text"])
+		}
+	}
+
+	report.OutputTail = "<b>bold</b>"
+	payload := decodeJSONRequest(t, sendChatMessage(t, report, map[string]interface{}{"flavour": "teams", "card": "message_card"}))
+	if payload["text"] != escaped {
+		t.Errorf("expected an escaped message card text but got %q", payload["text"])
+	}
+	section := payload["sections"].([]interface{})[0].(map[string]interface{})
+	if section["text"] != "<pre>&lt;b&gt;bold&lt;/b&gt;</pre>" {
+		t.Errorf("expected an escaped output tail but got %q", section["text"])
+	}
+}
+
+func TestChatBehaviourDiscord(t *testing.T) {
+	request := sendChatMessage(t, newChatTestReport(), map[string]interface{}{"flavour": "discord"})
+	payload := decodeJSONRequest(t, request)
+	if _, ok := payload["username"]; ok {
+		t.Errorf("expected no username but got %v", payload["username"])
+	}
+	embed := payload["embeds"].([]interface{})[0].(map[string]interface{})
+	if embed["title"] != "backup failure on host1" || embed["color"] != float64(0xa30200) {
+		t.Errorf("unexpected title or colour in %v", embed)
+	}
+	if embed["timestamp"] != "2026-01-02T03:04:05Z" {
+		t.Errorf("unexpected timestamp %v", embed["timestamp"])
+	}
+	if !strings.HasSuffix(embed["description"].(string), "```\nsome output\n```") {
+		t.Errorf("expected the output in the description but got %q", embed["description"])
+	}
+}
+
+func TestChatBehaviourDiscordLimitsDescription(t *testing.T) {
+	report := newChatTestReport()
+	report.ExitDescription = strings.Repeat("é", 5000)
+	report.OutputTail = strings.Repeat("output\n", 1000)
+	request := sendChatMessage(t, report, map[string]interface{}{"flavour": "discord"})
+	embed := decodeJSONRequest(t, request)["embeds"].([]interface{})[0].(map[string]interface{})
+	if description := embed["description"].(string); len([]rune(description)) > 4096 {
+		t.Errorf("expected the description to fit in 4096 characters but it has %d", len([]rune(description)))
+	}
+}
+
+func TestChatBehaviourTeams(t *testing.T) {
+	request := sendChatMessage(t, newChatTestReport(), map[string]interface{}{"flavour": "teams"})
+	payload := decodeJSONRequest(t, request)
+	attachment := payload["attachments"].([]interface{})[0].(map[string]interface{})
+	if payload["type"] != "message" || attachment["contentType"] != "application/vnd.microsoft.card.adaptive" {
+		t.Errorf("unexpected adaptive card envelope %v", payload)
+	}
+	body := attachment["content"].(map[string]interface{})["body"].([]interface{})
+	if len(body) != 4 || body[0].(map[string]interface{})["color"] != "Attention" {
+		t.Errorf("unexpected adaptive card body %v", body)
+	}
+
+	request = sendChatMessage(t, newChatTestReport(), map[string]interface{}{"flavour": "teams", "card": "message_card"})
+	payload = decodeJSONRequest(t, request)
+	if payload["@type"] != "MessageCard" || payload["themeColor"] != "a30200" || payload["title"] != "backup failure on host1" {
+		t.Errorf("unexpected message card %v", payload)
+	}
+}
+
+func TestChatBehaviourNtfy(t *testing.T) {
+	request := sendChatMessage(t, newChatTestReport(), map[string]interface{}{"flavour": "ntfy", "token": "tk_secret"})
+	for header, expected := range map[string]string{
+		"Title":         "backup failure on host1",
+		"Priority":      "high",
+		"Tags":          "rotating_light,env:prod",
+		"Authorization": "Bearer tk_secret",
+	} {
+		if actual := request.header.Get(header); actual != expected {
+			t.Errorf("expected %v header '%v' but got '%v'", header, expected, actual)
+		}
+	}
+	expectedBody := "Execution failed with code 2\nExit Code: 2\nDuration: 1.5s\nHost: host1\nTags: env:prod\nAttempts: 1\n\nsome output"
+	if string(request.body) != expectedBody {
+		t.Errorf("unexpected body %q", request.body)
+	}
+}
+
+func TestChatBehaviourNtfyEncodesNonASCIITitle(t *testing.T) {
+	report := newChatTestReport()
+	report.Name = "sauvegarde-données"
+	request := sendChatMessage(t, report, map[string]interface{}{"flavour": "ntfy"})
+	raw := request.header.Get("Title")
+	if !strings.HasPrefix(raw, "=?utf-8?") {
+		t.Errorf("expected an rfc 2047 encoded title but got '%v'", raw)
+	}
+	decoded, err := new(mime.WordDecoder).DecodeHeader(raw)
+	if err != nil || decoded != "sauvegarde-données failure on host1" {
+		t.Errorf("expected the title to decode but got '%v' (%v)", decoded, err)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+type elasticsearchBulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"items"`
+}
+
+// buildElasticsearchBulkBody builds the ndjson body indexing the report under its ulid so that retried behaviours do
+// not create duplicates.
+func buildElasticsearchBulkBody(report *GazeReport, index string) ([]byte, error) {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return nil, err
+	}
+	doc := make(map[string]interface{})
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	doc["@timestamp"] = report.EndTime
+	action := map[string]map[string]string{"index": {"_index": index, "_id": report.Ulid}}
+
+	var buff bytes.Buffer
+	encoder := json.NewEncoder(&buff)
+	if err := encoder.Encode(action); err != nil {
+		return nil, err
+	}
+	if err := encoder.Encode(doc); err != nil {
+		return nil, err
+	}
+	return buff.Bytes(), nil
+}
+
+func RunElasticsearchBehaviour(report *GazeReport, config *conf.GazeBehaviourConfig) error {
+	index, err := renderReportTemplate("index", config.Settings["index"].(string), report)
+	if err != nil {
+		return err
+	}
+	body, err := buildElasticsearchBulkBody(withoutOutput(report, config), index)
+	if err != nil {
+		return err
+	}
+
+	bulkURL := config.Settings["url"].(string) + "/_bulk"
+	log.Infof("Indexing report into '%v' at %v..", index, bulkURL)
+	req, err := http.NewRequest("POST", bulkURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if apiKey := config.Settings["api_key"].(string); apiKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+apiKey)
+	} else if username := config.Settings["username"].(string); username != "" {
+		req.SetBasicAuth(username, config.Settings["password"].(string))
+	}
+	respBody, err := doBehaviourRequest(req)
+	if err != nil {
+		return err
+	}
+
+	// the bulk api reports failures of individual items in the body of a successful response
+	var resp elasticsearchBulkResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return fmt.Errorf("Could not parse bulk response: %v", err.Error())
+	}
+	if resp.Errors {
+		for _, item := range resp.Items {
+			for _, result := range item {
+				if result.Status >= 300 {
+					return fmt.Errorf("Indexing into '%v' failed with code %v: %s", index, result.Status, result.Error)
+				}
+			}
+		}
+		return fmt.Errorf("Indexing into '%v' failed", index)
+	}
+	return nil
+}
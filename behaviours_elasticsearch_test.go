@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+func TestBuildElasticsearchBulkBody(t *testing.T) {
+	report := &GazeReport{Ulid: "01ARZ3NDEKTSV4RRFFQ69G5FAV", Name: "backup", EndTime: time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC)}
+	body, err := buildElasticsearchBulkBody(report, "gaze-2017.07.14")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(body), "\n")
+	if len(lines) != 3 || lines[2] != "" {
+		t.Fatalf("expected two newline terminated lines but got %q", string(body))
+	}
+	if expected := `{"index":{"_id":"01ARZ3NDEKTSV4RRFFQ69G5FAV","_index":"gaze-2017.07.14"}}`; lines[0] != expected {
+		t.Errorf("expected action '%v' but got '%v'", expected, lines[0])
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[1]), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc["@timestamp"] != "2017-07-14T02:40:00Z" || doc["name"] != "backup" || doc["ulid"] != report.Ulid {
+		t.Errorf("unexpected document %v", doc)
+	}
+}
+
+func TestRunElasticsearchBehaviour(t *testing.T) {
+	cases := []struct {
+		name          string
+		response      string
+		includeOutput bool
+		expectedError string
+	}{
+		{"indexed", `{"errors":false,"items":[{"index":{"status":201}}]}`, false, ""},
+		{"with output", `{"errors":false,"items":[{"index":{"status":201}}]}`, true, ""},
+		{
+			"item failed", `{"errors":true,"items":[{"index":{"status":400,"error":{"type":"mapper_parsing_exception"}}}]}`, false,
+			`Indexing into 'gaze-2017.07.14' failed with code 400: {"type":"mapper_parsing_exception"}`,
+		},
+		{"failed without item", `{"errors":true,"items":[]}`, false, "Indexing into 'gaze-2017.07.14' failed"},
+		{"unreadable", `not json`, false, "Could not parse bulk response: invalid character 'o' in literal null (expecting 'u')"},
+	}
+	for _, c := range cases {
+		var path, auth, contentType string
+		var body []byte
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path, auth, contentType = r.URL.Path, r.Header.Get("Authorization"), r.Header.Get("Content-Type")
+			body, _ = ioutil.ReadAll(r.Body)
+			fmt.Fprint(w, c.response)
+		}))
+		config := &conf.GazeBehaviourConfig{
+			Type: "elasticsearch", IncludeOutput: c.includeOutput,
+			Settings: map[string]interface{}{"url": server.URL, "api_key": "key"},
+		}
+		if err := conf.ValidateGazeElasticsearchBehaviour(config); err != nil {
+			t.Fatal(err)
+		}
+		report := &GazeReport{
+			Ulid: "01ARZ3NDEKTSV4RRFFQ69G5FAV", Name: "backup", CapturedOutput: "secret output",
+			StartTime: time.Date(2017, 7, 14, 2, 40, 0, 0, time.Local),
+		}
+		err := RunElasticsearchBehaviour(report, config)
+		server.Close()
+		if c.expectedError == "" && err != nil {
+			t.Errorf("%v: unexpected error: %v", c.name, err)
+		} else if c.expectedError != "" && (err == nil || err.Error() != c.expectedError) {
+			t.Errorf("%v: expected error '%v' but got %v", c.name, c.expectedError, err)
+		}
+		if path != "/_bulk" || auth != "ApiKey key" || contentType != "application/x-ndjson" {
+			t.Errorf("%v: unexpected request to '%v' with '%v' '%v'", c.name, path, auth, contentType)
+		}
+		if !bytes.Contains(body, []byte(`"_index":"gaze-2017.07.14"`)) {
+			t.Errorf("%v: expected the rendered index in %s", c.name, body)
+		}
+		if bytes.Contains(body, []byte("secret output")) != c.includeOutput {
+			t.Errorf("%v: expected output included %v in %s", c.name, c.includeOutput, body)
+		}
+	}
+}
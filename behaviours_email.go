@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+// loginAuth implements the non-standard but widely used LOGIN smtp authentication mechanism
+type loginAuth struct {
+	username string
+	password string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	prompt := strings.ToLower(strings.TrimSpace(string(fromServer)))
+	switch {
+	case strings.HasPrefix(prompt, "user"):
+		return []byte(a.username), nil
+	case strings.HasPrefix(prompt, "pass"):
+		return []byte(a.password), nil
+	}
+	return nil, fmt.Errorf("unexpected LOGIN prompt '%v'", string(fromServer))
+}
+
+func isLocalhost(host string) bool {
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
+
+// dialSMTP connects to the server using implicit tls, starttls, or plain text
+func dialSMTP(host string, port int, tlsMode string, tlsConfig *tls.Config) (*smtp.Client, error) {
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	dialer := &net.Dialer{Timeout: behaviourHTTPTimeout}
+	var conn net.Conn
+	var err error
+	if tlsMode == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(behaviourHTTPTimeout))
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if tlsMode == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			client.Close()
+			return nil, fmt.Errorf("SMTP server %v does not support STARTTLS", addr)
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+// buildEmailMessage builds the message with a quoted-printable body and optionally the full output as an attachment
+func buildEmailMessage(report *GazeReport, from string, to []string, subject string, body string, attachOutput bool) ([]byte, error) {
+	var msg bytes.Buffer
+	msg.WriteString("From: " + from + "\r\n")
+	msg.WriteString("To: " + strings.Join(to, ", ") + "\r\n")
+	msg.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	msg.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString(fmt.Sprintf("Message-ID: <%v@%v>\r\n", report.Ulid, report.Hostname))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+
+	writeBody := func(w *bytes.Buffer) error {
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(strings.Replace(body, "\n", "\r\n", -1))); err != nil {
+			return err
+		}
+		return qp.Close()
+	}
+
+	if !attachOutput {
+		msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+		msg.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeBody(&msg); err != nil {
+			return nil, err
+		}
+		return msg.Bytes(), nil
+	}
+
+	var parts bytes.Buffer
+	mw := multipart.NewWriter(&parts)
+	msg.WriteString("Content-Type: multipart/mixed; boundary=" + mw.Boundary() + "\r\n\r\n")
+
+	bodyHeader := textproto.MIMEHeader{}
+	bodyHeader.Set("Content-Type", "text/plain; charset=utf-8")
+	bodyHeader.Set("Content-Transfer-Encoding", "quoted-printable")
+	if _, err := mw.CreatePart(bodyHeader); err != nil {
+		return nil, err
+	}
+	if err := writeBody(&parts); err != nil {
+		return nil, err
+	}
+
+	attachHeader := textproto.MIMEHeader{}
+	attachHeader.Set("Content-Type", "text/plain; charset=utf-8")
+	attachHeader.Set("Content-Transfer-Encoding", "base64")
+	attachHeader.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%v-output.txt\"", report.Ulid))
+	if _, err := mw.CreatePart(attachHeader); err != nil {
+		return nil, err
+	}
+	encoded := base64.StdEncoding.EncodeToString([]byte(report.CapturedOutput))
+	for len(encoded) > 76 {
+		parts.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	parts.WriteString(encoded + "\r\n")
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	msg.Write(parts.Bytes())
+	return msg.Bytes(), nil
+}
+
+func RunEmailBehaviour(report *GazeReport, config *conf.GazeBehaviourConfig) error {
+	host := config.Settings["host"].(string)
+	port := config.Settings["port"].(int)
+	tlsMode := config.Settings["tls"].(string)
+	username := config.Settings["username"].(string)
+	password := config.Settings["password"].(string)
+	from := config.Settings["from"].(string)
+	to := config.Settings["to"].([]string)
+
+	templateReport := withoutOutput(report, config)
+	subject, err := renderReportTemplate("subject", config.Settings["subject"].(string), templateReport)
+	if err != nil {
+		return err
+	}
+	body, err := renderReportTemplate("body", config.Settings["body"].(string), templateReport)
+	if err != nil {
+		return err
+	}
+	msg, err := buildEmailMessage(report, from, to, strings.TrimSpace(subject), body, config.Settings["attach_output"].(bool))
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Sending email to %v via %v:%v..", to, host, port)
+	tlsConfig := &tls.Config{ServerName: host, InsecureSkipVerify: config.Settings["insecure_skip_verify"].(bool)}
+	client, err := dialSMTP(host, port, tlsMode, tlsConfig)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if username != "" {
+		var auth smtp.Auth
+		if config.Settings["auth"].(string) == "login" {
+			auth = &loginAuth{username: username, password: password}
+		} else {
+			auth = smtp.PlainAuth("", username, password, host)
+		}
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	// the envelope needs the bare addresses without any display names
+	fromAddress, err := mail.ParseAddress(from)
+	if err != nil {
+		return fmt.Errorf("Invalid from address '%v': %v", from, err.Error())
+	}
+	if err := client.Mail(fromAddress.Address); err != nil {
+		return err
+	}
+	for _, recipient := range to {
+		toAddress, err := mail.ParseAddress(recipient)
+		if err != nil {
+			return fmt.Errorf("Invalid to address '%v': %v", recipient, err.Error())
+		}
+		if err := client.Rcpt(toAddress.Address); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+// fakeSMTPSession records what a client sent to the fake smtp server
+type fakeSMTPSession struct {
+	commands []string
+	auth     []string
+	data     []string
+}
+
+// startFakeSMTPServer accepts a single smtp session on a local port and sends what it saw down the returned channel
+func startFakeSMTPServer(t *testing.T) (int, chan *fakeSMTPSession) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions := make(chan *fakeSMTPSession, 1)
+	go func() {
+		defer listener.Close()
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		session := new(fakeSMTPSession)
+		defer func() { sessions <- session }()
+
+		r := bufio.NewReader(conn)
+		reply := func(lines ...string) {
+			for _, l := range lines {
+				conn.Write([]byte(l + "\r\n"))
+			}
+		}
+		readLine := func() (string, bool) {
+			line, err := r.ReadString('\n')
+			return strings.TrimRight(line, "\r\n"), err == nil
+		}
+
+		reply("220 localhost fake smtp")
+		for {
+			line, ok := readLine()
+			if !ok {
+				return
+			}
+			session.commands = append(session.commands, line)
+			verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+			switch verb {
+			case "EHLO":
+				reply("250-localhost", "250 AUTH PLAIN LOGIN")
+			case "AUTH":
+				parts := strings.Fields(line)
+				if parts[1] == "PLAIN" {
+					decoded, _ := base64.StdEncoding.DecodeString(parts[2])
+					session.auth = append(session.auth, string(decoded))
+				} else {
+					for _, prompt := range []string{"VXNlcm5hbWU6", "UGFzc3dvcmQ6"} {
+						reply("334 " + prompt)
+						answer, _ := readLine()
+						decoded, _ := base64.StdEncoding.DecodeString(answer)
+						session.auth = append(session.auth, string(decoded))
+					}
+				}
+				reply("235 2.7.0 Authentication successful")
+			case "MAIL", "RCPT":
+				reply("250 2.1.0 Ok")
+			case "DATA":
+				reply("354 End data with <CR><LF>.<CR><LF>")
+				for {
+					dataLine, ok := readLine()
+					if !ok || dataLine == "." {
+						break
+					}
+					session.data = append(session.data, dataLine)
+				}
+				reply("250 2.0.0 Ok: queued")
+			case "QUIT":
+				reply("221 2.0.0 Bye")
+				return
+			default:
+				reply("502 5.5.2 Error: command not recognized")
+			}
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port, sessions
+}
+
+func newEmailBehaviourConfig(t *testing.T, port int, settings map[string]interface{}) *conf.GazeBehaviourConfig {
+	config := &conf.GazeBehaviourConfig{Type: "email", Settings: map[string]interface{}{
+		"host": "localhost",
+		"port": port,
+		"tls":  "none",
+		"from": "Gaze <gaze@example.com>",
+		"to":   []interface{}{"ops@example.com", "Backup Team <backups@example.com>"},
+	}}
+	for k, v := range settings {
+		config.Settings[k] = v
+	}
+	if err := conf.ValidateGazeEmailBehaviour(config); err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+func TestEmailBehaviourSMTPDialogue(t *testing.T) {
+	port, sessions := startFakeSMTPServer(t)
+	config := newEmailBehaviourConfig(t, port, map[string]interface{}{
+		"username": "gaze",
+		"password": "secret",
+		"subject":  "{{.Name}} {{.Status}}",
+		"body":     "first line\n.starts with a dot\n.\nlast line",
+	})
+	report := &GazeReport{Ulid: "01BX5ZZKBKACTAV9WEVGEMMVRZ", Name: "backup", Status: conf.StatusFailure, Hostname: "host1"}
+	if err := RunEmailBehaviour(report, config); err != nil {
+		t.Fatal(err)
+	}
+	session := <-sessions
+
+	expectedCommands := []string{
+		"MAIL FROM:<gaze@example.com>",
+		"RCPT TO:<ops@example.com>",
+		"RCPT TO:<backups@example.com>",
+		"DATA",
+		"QUIT",
+	}
+	if !strings.HasPrefix(session.commands[0], "EHLO ") {
+		t.Errorf("expected the session to start with EHLO but got '%v'", session.commands[0])
+	}
+	if !strings.HasPrefix(session.commands[1], "AUTH PLAIN ") {
+		t.Errorf("expected AUTH PLAIN after EHLO but got '%v'", session.commands[1])
+	}
+	if strings.Join(session.commands[2:], "\n") != strings.Join(expectedCommands, "\n") {
+		t.Errorf("unexpected commands %q", session.commands[2:])
+	}
+	if len(session.auth) != 1 || session.auth[0] != "\x00gaze\x00secret" {
+		t.Errorf("unexpected PLAIN credentials %q", session.auth)
+	}
+
+	data := strings.Join(session.data, "\n")
+	for _, expected := range []string{
+		"From: Gaze <gaze@example.com>",
+		"To: ops@example.com, Backup Team <backups@example.com>",
+		"Subject: backup failure",
+		"Message-ID: <01BX5ZZKBKACTAV9WEVGEMMVRZ@host1>",
+		"Content-Transfer-Encoding: quoted-printable",
+	} {
+		if !strings.Contains(data, expected) {
+			t.Errorf("expected the message to contain '%v' but got:\n%v", expected, data)
+		}
+	}
+	// lines starting with a dot must be dot-stuffed so that the server does not end the data early
+	bodyLines := session.data[len(session.data)-4:]
+	expectedBody := []string{"first line", "..starts with a dot", "..", "last line"}
+	if strings.Join(bodyLines, "\n") != strings.Join(expectedBody, "\n") {
+		t.Errorf("expected dot-stuffed body %q but got %q", expectedBody, bodyLines)
+	}
+}
+
+func TestEmailBehaviourLoginAuthAndAttachment(t *testing.T) {
+	port, sessions := startFakeSMTPServer(t)
+	config := newEmailBehaviourConfig(t, port, map[string]interface{}{
+		"username":      "gaze",
+		"password":      "secret",
+		"auth":          "login",
+		"attach_output": true,
+	})
+	report := &GazeReport{
+		Ulid: "01BX5ZZKBKACTAV9WEVGEMMVRZ", Name: "backup", Status: conf.StatusSuccess, Hostname: "host1",
+		CapturedOutput: strings.Repeat("output line\n", 20),
+	}
+	if err := RunEmailBehaviour(report, config); err != nil {
+		t.Fatal(err)
+	}
+	session := <-sessions
+
+	if session.commands[1] != "AUTH LOGIN" {
+		t.Errorf("expected AUTH LOGIN but got '%v'", session.commands[1])
+	}
+	if strings.Join(session.auth, ",") != "gaze,secret" {
+		t.Errorf("unexpected LOGIN credentials %q", session.auth)
+	}
+	data := strings.Join(session.data, "\n")
+	if !strings.Contains(data, "Content-Type: multipart/mixed; boundary=") {
+		t.Errorf("expected a multipart message but got:\n%v", data)
+	}
+	if !strings.Contains(data, `Content-Disposition: attachment; filename="01BX5ZZKBKACTAV9WEVGEMMVRZ-output.txt"`) {
+		t.Errorf("expected the output attachment but got:\n%v", data)
+	}
+	encoded := base64.StdEncoding.EncodeToString([]byte(report.CapturedOutput))
+	if !strings.Contains(strings.Replace(data, "\n", "", -1), encoded) {
+		t.Errorf("expected the base64 encoded output in the message")
+	}
+	for _, line := range session.data {
+		if len(line) > 998 {
+			t.Errorf("line of %d characters exceeds the smtp limit", len(line))
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+// gelfMaxChunks is the largest number of chunks a GELF message can be split into over UDP
+const gelfMaxChunks = 128
+
+// gelfFieldName makes a name safe for use as a GELF additional field
+func gelfFieldName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// flattenGELFFields adds a value from the json form of the report as additional fields. Objects are flattened with
+// underscores, lists of plain values are joined, and lists of objects are kept as json.
+func flattenGELFFields(output map[string]interface{}, prefix string, value interface{}) {
+	switch v := value.(type) {
+	case nil:
+	case map[string]interface{}:
+		for k, inner := range v {
+			flattenGELFFields(output, prefix+"_"+gelfFieldName(k), inner)
+		}
+	case []interface{}:
+		parts := make([]string, 0, len(v))
+		for _, inner := range v {
+			switch inner.(type) {
+			case map[string]interface{}, []interface{}:
+				data, _ := json.Marshal(v)
+				output[prefix] = string(data)
+				return
+			}
+			parts = append(parts, fmt.Sprint(inner))
+		}
+		output[prefix] = strings.Join(parts, " ")
+	case bool:
+		output[prefix] = fmt.Sprint(v)
+	default:
+		output[prefix] = v
+	}
+}
+
+// buildGELFMessage formats the report as a GELF 1.1 message
+func buildGELFMessage(report *GazeReport, includeOutput bool) ([]byte, error) {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return nil, err
+	}
+	raw := make(map[string]interface{})
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	// these are sent as standard fields instead
+	for _, k := range []string{"captured_output", "output_tail", "hostname", "id"} {
+		delete(raw, k)
+	}
+	if attempts, ok := raw["attempts"].([]interface{}); ok {
+		for _, a := range attempts {
+			if am, ok := a.(map[string]interface{}); ok {
+				delete(am, "output_tail")
+			}
+		}
+	}
+	message := make(map[string]interface{})
+	keys := make([]string, 0, len(raw))
+	for k := range raw {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		flattenGELFFields(message, "_"+gelfFieldName(k), raw[k])
+	}
+
+	timestamp := report.EndTime
+	if report.Status == conf.StatusRunning {
+		timestamp = time.Now()
+	}
+	message["version"] = "1.1"
+	message["host"] = report.Hostname
+	message["short_message"] = report.ExitDescription
+	message["timestamp"] = float64(timestamp.UnixNano()/int64(time.Millisecond)) / 1000
+	message["level"] = syslogSeverity(report.Status)
+	if includeOutput && report.CapturedOutput != "" {
+		message["full_message"] = report.CapturedOutput
+	}
+	return json.Marshal(message)
+}
+
+// chunkGELF splits a message into chunks that each fit into the given size, or returns it as is if it already fits
+func chunkGELF(message []byte, chunkSize int) ([][]byte, error) {
+	if len(message) <= chunkSize {
+		return [][]byte{message}, nil
+	}
+	// each chunk has a 12 byte header of magic bytes, the message id, the sequence number, and the sequence count
+	dataSize := chunkSize - 12
+	count := (len(message) + dataSize - 1) / dataSize
+	if count > gelfMaxChunks {
+		return nil, fmt.Errorf("GELF message of %v bytes needs more than %v chunks", len(message), gelfMaxChunks)
+	}
+	id := make([]byte, 8)
+	rand.Read(id)
+	chunks := make([][]byte, count)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * dataSize
+		if end > len(message) {
+			end = len(message)
+		}
+		chunk := append([]byte{0x1e, 0x0f}, id...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunks[i] = append(chunk, message[i*dataSize:end]...)
+	}
+	return chunks, nil
+}
+
+func RunGELFBehaviour(report *GazeReport, config *conf.GazeBehaviourConfig) error {
+	network := config.Settings["network"].(string)
+	address := config.Settings["address"].(string)
+	message, err := buildGELFMessage(report, config.IncludeOutput)
+	if err != nil {
+		return err
+	}
+
+	var packets [][]byte
+	if network == "tcp" {
+		// tcp messages are delimited by a null byte and cannot be compressed
+		packets = [][]byte{append(message, 0)}
+	} else {
+		if config.Settings["compress"].(bool) {
+			var buff bytes.Buffer
+			gz := gzip.NewWriter(&buff)
+			gz.Write(message)
+			gz.Close()
+			message = buff.Bytes()
+		}
+		if packets, err = chunkGELF(message, config.Settings["chunk_size"].(int)); err != nil {
+			return err
+		}
+	}
+
+	log.Infof("Sending GELF message to %v %v..", network, address)
+	conn, err := net.DialTimeout(network, address, behaviourHTTPTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(behaviourHTTPTimeout))
+	for _, p := range packets {
+		if _, err := conn.Write(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+func TestGELFFieldName(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected string
+	}{
+		{"exit_code", "exit_code"},
+		{"a.b-c", "a.b-c"},
+		{"rows copied", "rows_copied"},
+		{"a/b:c", "a_b_c"},
+	}
+	for _, c := range cases {
+		if actual := gelfFieldName(c.input); actual != c.expected {
+			t.Errorf("%q: expected '%v' but got '%v'", c.input, c.expected, actual)
+		}
+	}
+}
+
+func TestFlattenGELFFields(t *testing.T) {
+	cases := []struct {
+		name     string
+		value    interface{}
+		expected map[string]interface{}
+	}{
+		{"nil", nil, map[string]interface{}{}},
+		{"number", 1.5, map[string]interface{}{"_x": 1.5}},
+		{"string", "a", map[string]interface{}{"_x": "a"}},
+		{"bool", true, map[string]interface{}{"_x": "true"}},
+		{"object", map[string]interface{}{"a b": 1.0, "c": map[string]interface{}{"d": "e"}}, map[string]interface{}{"_x_a_b": 1.0, "_x_c_d": "e"}},
+		{"plain list", []interface{}{"a", 1.0, true}, map[string]interface{}{"_x": "a 1 true"}},
+		{"list of objects", []interface{}{map[string]interface{}{"a": 1.0}}, map[string]interface{}{"_x": `[{"a":1}]`}},
+		{"list of lists", []interface{}{"a", []interface{}{"b"}}, map[string]interface{}{"_x": `["a",["b"]]`}},
+	}
+	for _, c := range cases {
+		actual := map[string]interface{}{}
+		flattenGELFFields(actual, "_x", c.value)
+		if !reflect.DeepEqual(actual, c.expected) {
+			t.Errorf("%v: expected %v but got %v", c.name, c.expected, actual)
+		}
+	}
+}
+
+func newGELFTestReport() *GazeReport {
+	return &GazeReport{
+		Ulid:            "01ARZ3NDEKTSV4RRFFQ69G5FAV",
+		Name:            "backup",
+		Hostname:        "db1",
+		EndTime:         time.Unix(1500000000, 250000000),
+		ExitCode:        2,
+		ExitDescription: "Execution failed with code 2",
+		Status:          conf.StatusFailure,
+		Tags:            []string{"env:prod", "nightly"},
+		Metrics:         map[string]float64{"rows copied": 12},
+		CapturedOutput:  "line 1\nline 2\n",
+		OutputTail:      "line 2\n",
+		Attempts:        []*GazeAttempt{{Number: 1, ExitCode: 2, OutputTail: "line 2\n"}},
+	}
+}
+
+func TestBuildGELFMessage(t *testing.T) {
+	data, err := buildGELFMessage(newGELFTestReport(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var message map[string]interface{}
+	if err := json.Unmarshal(data, &message); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"version":              "1.1",
+		"host":                 "db1",
+		"short_message":        "Execution failed with code 2",
+		"full_message":         "line 1\nline 2\n",
+		"timestamp":            1500000000.25,
+		"level":                3.0,
+		"_name":                "backup",
+		"_exit_code":           2.0,
+		"_status":              conf.StatusFailure,
+		"_tags":                "env:prod nightly",
+		"_metrics_rows_copied": 12.0,
+		"_ulid":                "01ARZ3NDEKTSV4RRFFQ69G5FAV",
+	}
+	for k, v := range expected {
+		if message[k] != v {
+			t.Errorf("expected %v to be %v but got %v", k, v, message[k])
+		}
+	}
+	for _, k := range []string{"_captured_output", "_output_tail", "_hostname", "_id", "_fields"} {
+		if _, ok := message[k]; ok {
+			t.Errorf("expected no %v field", k)
+		}
+	}
+	if attempts := message["_attempts"].(string); strings.Contains(attempts, "output_tail") || !strings.Contains(attempts, `"number":1`) {
+		t.Errorf("unexpected attempts field %v", attempts)
+	}
+
+	data, _ = buildGELFMessage(newGELFTestReport(), false)
+	if bytes.Contains(data, []byte("full_message")) {
+		t.Errorf("expected no full message without include_output but got %s", data)
+	}
+}
+
+func TestChunkGELF(t *testing.T) {
+	message := []byte(strings.Repeat("abcdefghij", 10))
+	if chunks, err := chunkGELF(message, 100); err != nil || len(chunks) != 1 || !bytes.Equal(chunks[0], message) {
+		t.Errorf("expected a message that fits to be sent as is but got %v %v", len(chunks), err)
+	}
+
+	chunks, err := chunkGELF(message, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 4 {
+		t.Fatalf("expected 4 chunks but got %v", len(chunks))
+	}
+	var joined []byte
+	for i, c := range chunks {
+		if len(c) > 42 || c[0] != 0x1e || c[1] != 0x0f || c[10] != byte(i) || c[11] != 4 {
+			t.Errorf("chunk %v has an invalid header % x", i, c[:12])
+		}
+		if !bytes.Equal(c[2:10], chunks[0][2:10]) {
+			t.Errorf("chunk %v has a different message id", i)
+		}
+		joined = append(joined, c[12:]...)
+	}
+	if !bytes.Equal(joined, message) {
+		t.Errorf("expected the chunks to join into the message but got %s", joined)
+	}
+
+	if _, err := chunkGELF(make([]byte, 52*gelfMaxChunks+1), 64); err == nil {
+		t.Errorf("expected an error for a message needing more than %v chunks", gelfMaxChunks)
+	}
+}
+
+func newGELFBehaviourConfig(t *testing.T, network string, address string, compress bool) *conf.GazeBehaviourConfig {
+	config := &conf.GazeBehaviourConfig{Type: "gelf", Settings: map[string]interface{}{
+		"network": network, "address": address, "compress": compress, "chunk_size": 64,
+	}}
+	if err := conf.ValidateGazeGELFBehaviour(config); err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+func TestRunGELFBehaviourUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	report := newGELFTestReport()
+	if err := RunGELFBehaviour(report, newGELFBehaviourConfig(t, "udp", conn.LocalAddr().String(), true)); err != nil {
+		t.Fatal(err)
+	}
+
+	// reassemble the chunks in sequence order
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	parts := map[byte][]byte{}
+	count := -1
+	for count < 0 || len(parts) < count {
+		buff := make([]byte, 1024)
+		n, _, err := conn.ReadFrom(buff)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n > 64 || buff[0] != 0x1e || buff[1] != 0x0f {
+			t.Fatalf("unexpected packet % x", buff[:n])
+		}
+		parts[buff[10]], count = buff[12:n], int(buff[11])
+	}
+	var compressed []byte
+	for i := 0; i < count; i++ {
+		compressed = append(compressed, parts[byte(i)]...)
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(reader)
+	expected, _ := buildGELFMessage(report, false)
+	if !bytes.Equal(data, expected) {
+		t.Errorf("expected %s but got %s", expected, data)
+	}
+}
+
+func TestRunGELFBehaviourTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			close(received)
+			return
+		}
+		defer conn.Close()
+		data, _ := bufio.NewReader(conn).ReadBytes(0)
+		received <- data
+	}()
+
+	report := newGELFTestReport()
+	if err := RunGELFBehaviour(report, newGELFBehaviourConfig(t, "tcp", listener.Addr().String(), true)); err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := buildGELFMessage(report, false)
+	if data := <-received; !bytes.Equal(data, append(expected, 0)) {
+		t.Errorf("expected an uncompressed null terminated message but got %q", data)
+	}
+}
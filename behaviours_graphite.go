@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+// buildGraphiteLines formats the report metrics in the plaintext protocol, timestamped at the end of the run
+func buildGraphiteLines(report *GazeReport, prefix string) []byte {
+	var buff bytes.Buffer
+	timestamp := report.EndTime.Unix()
+	for _, m := range collectReportMetrics(report) {
+		buff.WriteString(fmt.Sprintf(
+			"%v %v %d\n", joinMetricPath(prefix, m.Name), strconv.FormatFloat(m.Value, 'f', -1, 64), timestamp,
+		))
+	}
+	return buff.Bytes()
+}
+
+func RunGraphiteBehaviour(report *GazeReport, config *conf.GazeBehaviourConfig) error {
+	address := config.Settings["address"].(string)
+	prefix, err := renderMetricPrefix(report, config)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Sending graphite metrics to %v..", address)
+	conn, err := net.DialTimeout("tcp", address, behaviourHTTPTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(behaviourHTTPTimeout))
+	_, err = conn.Write(buildGraphiteLines(report, prefix))
+	return err
+}
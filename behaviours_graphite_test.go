@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+func TestBuildGraphiteLines(t *testing.T) {
+	report := &GazeReport{
+		EndTime:        time.Unix(1500000000, 0),
+		ElapsedSeconds: 0.1,
+		ExitCode:       1,
+		Status:         conf.StatusWarning,
+		Attempts:       []*GazeAttempt{{}, {}},
+		Metrics:        map[string]float64{"queue.depth": 1e6},
+	}
+	expected := "gaze.host.duration_seconds 0.1 1500000000\n" +
+		"gaze.host.exit_code 1 1500000000\n" +
+		"gaze.host.attempts 2 1500000000\n" +
+		"gaze.host.runs 1 1500000000\n" +
+		"gaze.host.successes 0 1500000000\n" +
+		"gaze.host.warnings 1 1500000000\n" +
+		"gaze.host.failures 0 1500000000\n" +
+		"gaze.host.metrics.queue_depth 1000000 1500000000\n"
+	if actual := string(buildGraphiteLines(report, "gaze.host")); actual != expected {
+		t.Errorf("expected %q but got %q", expected, actual)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+var influxPrecisions = map[string]time.Duration{
+	"ns": time.Nanosecond, "us": time.Microsecond, "ms": time.Millisecond, "s": time.Second,
+}
+
+// influxV1Precisions are the names the v1 write api uses for the precision values
+var influxV1Precisions = map[string]string{"ns": "n", "us": "u", "ms": "ms", "s": "s"}
+
+var influxStringEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"")
+
+const (
+	influxKeySpecials         = ",= \n\r"
+	influxMeasurementSpecials = ", \n\r"
+)
+
+// influxEscape escapes the special characters of a key, tag value or measurement. Line protocol has no escape for
+// newlines so they become escaped spaces. A run of backslashes before a special character or the end of the value
+// would escape the escape or the separator that follows, so those are doubled.
+func influxEscape(input string, specials string) string {
+	var output strings.Builder
+	for i := 0; i < len(input); i++ {
+		switch c := input[i]; {
+		case c == '\\':
+			j := i
+			for j < len(input) && input[j] == '\\' {
+				j++
+			}
+			output.WriteString(input[i:j])
+			if j == len(input) || strings.IndexByte(specials, input[j]) >= 0 {
+				output.WriteString(input[i:j])
+			}
+			i = j - 1
+		case c == '\n' || c == '\r':
+			output.WriteString("\\ ")
+		case strings.IndexByte(specials, c) >= 0:
+			output.WriteByte('\\')
+			output.WriteByte(c)
+		default:
+			output.WriteByte(c)
+		}
+	}
+	return output.String()
+}
+
+// buildInfluxLine formats the report as a single point in line protocol
+func buildInfluxLine(report *GazeReport, measurement string, precision time.Duration) string {
+	tags := append([][2]string{{"host", report.Hostname}, {"name", report.Name}}, reportTagLabels(report.Tags)...)
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i][0] < tags[j][0] })
+
+	var line strings.Builder
+	line.WriteString(influxEscape(measurement, influxMeasurementSpecials))
+	for _, t := range tags {
+		// empty tag values are not allowed
+		if t[1] != "" {
+			line.WriteString("," + influxEscape(t[0], influxKeySpecials) + "=" + influxEscape(t[1], influxKeySpecials))
+		}
+	}
+
+	fields := []string{
+		"duration_seconds=" + strconv.FormatFloat(float32ToMetric(report.ElapsedSeconds), 'f', -1, 64),
+		fmt.Sprintf("exit_code=%di", report.ExitCode),
+		fmt.Sprintf("attempts=%di", len(report.Attempts)),
+		"status=\"" + influxStringEscaper.Replace(report.Status) + "\"",
+		"success=" + strconv.FormatBool(report.Status == conf.StatusSuccess),
+	}
+	if ru := report.ResourceUsage; ru != nil {
+		fields = append(
+			fields,
+			"user_cpu_seconds="+strconv.FormatFloat(ru.UserCPUSeconds, 'f', -1, 64),
+			"system_cpu_seconds="+strconv.FormatFloat(ru.SystemCPUSeconds, 'f', -1, 64),
+			fmt.Sprintf("max_rss_bytes=%di", ru.MaxRSSBytes),
+		)
+	}
+	names := make([]string, 0, len(report.Metrics))
+	for k := range report.Metrics {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		fields = append(fields, influxEscape("metric_"+k, influxKeySpecials)+"="+strconv.FormatFloat(report.Metrics[k], 'f', -1, 64))
+	}
+
+	line.WriteString(" " + strings.Join(fields, ","))
+	line.WriteString(fmt.Sprintf(" %d\n", report.EndTime.UnixNano()/int64(precision)))
+	return line.String()
+}
+
+// influxWriteURL builds the write endpoint for the configured api version
+func influxWriteURL(config *conf.GazeBehaviourConfig) string {
+	baseURL := config.Settings["url"].(string)
+	precision := config.Settings["precision"].(string)
+	query := url.Values{}
+	if config.Settings["api"].(string) == "v1" {
+		query.Set("db", config.Settings["database"].(string))
+		if rp := config.Settings["retention_policy"].(string); rp != "" {
+			query.Set("rp", rp)
+		}
+		query.Set("precision", influxV1Precisions[precision])
+		return baseURL + "/write?" + query.Encode()
+	}
+	query.Set("org", config.Settings["org"].(string))
+	query.Set("bucket", config.Settings["bucket"].(string))
+	query.Set("precision", precision)
+	return baseURL + "/api/v2/write?" + query.Encode()
+}
+
+func RunInfluxBehaviour(report *GazeReport, config *conf.GazeBehaviourConfig) error {
+	api := config.Settings["api"].(string)
+	precision := influxPrecisions[config.Settings["precision"].(string)]
+	line := buildInfluxLine(report, config.Settings["measurement"].(string), precision)
+
+	if api == "udp" {
+		address := config.Settings["address"].(string)
+		log.Infof("Sending influx point to %v..", address)
+		conn, err := net.DialTimeout("udp", address, behaviourHTTPTimeout)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(behaviourHTTPTimeout))
+		_, err = conn.Write([]byte(line))
+		return err
+	}
+
+	writeURL := influxWriteURL(config)
+	log.Infof("Making POST request to %v..", writeURL)
+	req, err := http.NewRequest("POST", writeURL, strings.NewReader(line))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if token := config.Settings["token"].(string); token != "" {
+		req.Header.Set("Authorization", "Token "+token)
+	} else if username := config.Settings["username"].(string); username != "" {
+		req.SetBasicAuth(username, config.Settings["password"].(string))
+	}
+	_, err = doBehaviourRequest(req)
+	return err
+}
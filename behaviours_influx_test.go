@@ -0,0 +1,119 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+func TestInfluxEscape(t *testing.T) {
+	cases := []struct {
+		name     string
+		input    string
+		specials string
+		expected string
+	}{
+		{"plain", "backup", influxKeySpecials, `backup`},
+		{"specials", "a,b=c d", influxKeySpecials, `a\,b\=c\ d`},
+		{"newlines", "a\nb\r", influxKeySpecials, `a\ b\ `},
+		{"inner backslash", `C:\temp`, influxKeySpecials, `C:\temp`},
+		{"trailing backslash", `C:\`, influxKeySpecials, `C:\\`},
+		{"trailing backslashes", `a\\`, influxKeySpecials, `a\\\\`},
+		{"backslash before special", `a\ b`, influxKeySpecials, `a\\\ b`},
+		{"backslash before newline", "a\\\nb", influxKeySpecials, `a\\\ b`},
+		{"measurement keeps equals", "a=b c", influxMeasurementSpecials, `a=b\ c`},
+		{"measurement backslash before equals", `a\=b`, influxMeasurementSpecials, `a\=b`},
+	}
+	for _, c := range cases {
+		if actual := influxEscape(c.input, c.specials); actual != c.expected {
+			t.Errorf("%v: expected '%v' but got '%v'", c.name, c.expected, actual)
+		}
+	}
+}
+
+func TestBuildInfluxLine(t *testing.T) {
+	report := &GazeReport{
+		Name:           "nightly backup",
+		Hostname:       "db1",
+		Tags:           []string{"env:prod", `dir=C:\`},
+		EndTime:        time.Unix(1500000000, 500000000),
+		ElapsedSeconds: 1.5,
+		ExitCode:       1,
+		Status:         conf.StatusWarning,
+		Attempts:       []*GazeAttempt{{}},
+		Metrics:        map[string]float64{"rows copied": 12},
+	}
+	expected := `gaze\ runs,dir=C:\\,env=prod,host=db1,name=nightly\ backup ` +
+		`duration_seconds=1.5,exit_code=1i,attempts=1i,status="warning",success=false,metric_rows\ copied=12 1500000000500` + "\n"
+	if actual := buildInfluxLine(report, "gaze runs", time.Millisecond); actual != expected {
+		t.Errorf("expected %q but got %q", expected, actual)
+	}
+
+	// empty tag values are left out and the resource usage adds fields
+	report = &GazeReport{
+		Name:          "x",
+		EndTime:       time.Unix(1500000000, 0),
+		Status:        conf.StatusSuccess,
+		ResourceUsage: &GazeResourceUsage{UserCPUSeconds: 0.5, SystemCPUSeconds: 0.25, MaxRSSBytes: 1024},
+	}
+	expected = `gaze,name=x duration_seconds=0,exit_code=0i,attempts=0i,status="success",success=true,` +
+		`user_cpu_seconds=0.5,system_cpu_seconds=0.25,max_rss_bytes=1024i 1500000000` + "\n"
+	if actual := buildInfluxLine(report, "gaze", time.Second); actual != expected {
+		t.Errorf("expected %q but got %q", expected, actual)
+	}
+}
+
+func TestRunInfluxBehaviour(t *testing.T) {
+	cases := []struct {
+		name          string
+		settings      map[string]interface{}
+		expectedURI   string
+		expectedAuth  string
+		expectedBasic bool
+	}{
+		{
+			"v2", map[string]interface{}{"org": "acme", "bucket": "jobs", "token": "secret"},
+			"/api/v2/write?bucket=jobs&org=acme&precision=s", "Token secret", false,
+		},
+		{
+			"v1", map[string]interface{}{"api": "v1", "database": "jobs", "retention_policy": "week", "precision": "ms", "username": "u", "password": "p"},
+			"/write?db=jobs&precision=ms&rp=week", "", true,
+		},
+	}
+	for _, c := range cases {
+		var uri, auth, body string
+		var basic bool
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			raw, _ := ioutil.ReadAll(r.Body)
+			uri, auth, body = r.URL.RequestURI(), r.Header.Get("Authorization"), string(raw)
+			_, _, basic = r.BasicAuth()
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		c.settings["url"] = server.URL + "/"
+		config := &conf.GazeBehaviourConfig{Type: "influx", Settings: c.settings}
+		if err := conf.ValidateGazeInfluxBehaviour(config); err != nil {
+			t.Fatal(err)
+		}
+		report := &GazeReport{Name: "x", EndTime: time.Unix(1500000000, 0), Status: conf.StatusSuccess}
+		if err := RunInfluxBehaviour(report, config); err != nil {
+			t.Errorf("%v: unexpected error: %v", c.name, err)
+		}
+		server.Close()
+		if uri != c.expectedURI {
+			t.Errorf("%v: expected uri '%v' but got '%v'", c.name, c.expectedURI, uri)
+		}
+		if c.expectedAuth != "" && auth != c.expectedAuth {
+			t.Errorf("%v: expected authorization '%v' but got '%v'", c.name, c.expectedAuth, auth)
+		}
+		if basic != c.expectedBasic {
+			t.Errorf("%v: expected basic auth %v but got %v", c.name, c.expectedBasic, basic)
+		}
+		if expected := buildInfluxLine(report, "gaze", influxPrecisions[c.settings["precision"].(string)]); body != expected {
+			t.Errorf("%v: expected body %q but got %q", c.name, expected, body)
+		}
+	}
+}
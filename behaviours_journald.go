@@ -0,0 +1,73 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// journalFieldName makes a string safe for use as a journal field name: upper case letters, digits and underscores,
+// not starting with an underscore or digit, and at most 64 characters.
+func journalFieldName(prefix string, name string) string {
+	cleaned := strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		return '_'
+	}, prefix+name)
+	// a leading underscore marks a trusted field that clients cannot set, and a leading digit is not allowed at all
+	cleaned = strings.TrimLeft(cleaned, "_")
+	if cleaned == "" || (cleaned[0] >= '0' && cleaned[0] <= '9') {
+		cleaned = "GAZE_" + cleaned
+	}
+	if len(cleaned) > 64 {
+		cleaned = cleaned[:64]
+	}
+	return cleaned
+}
+
+// buildJournalFields builds the ordered list of native journal fields for the report
+func buildJournalFields(report *GazeReport, identifier string, includeOutput bool) [][2]string {
+	fields := [][2]string{
+		{"MESSAGE", report.Name + " " + report.Status + ": " + report.ExitDescription},
+		{"PRIORITY", strconv.Itoa(syslogSeverity(report.Status))},
+		{"SYSLOG_IDENTIFIER", identifier},
+		{"GAZE_ULID", report.Ulid},
+		{"GAZE_NAME", report.Name},
+		{"GAZE_STATUS", report.Status},
+		{"GAZE_EXIT_CODE", strconv.Itoa(report.ExitCode)},
+		{"GAZE_EXIT_DESCRIPTION", report.ExitDescription},
+		{"GAZE_COMMAND", strings.Join(report.Command, " ")},
+		{"GAZE_ELAPSED_SECONDS", strconv.FormatFloat(float64(report.ElapsedSeconds), 'f', -1, 32)},
+		{"GAZE_START_TIME", report.StartTime.Format("2006-01-02T15:04:05.000000Z07:00")},
+		{"GAZE_TAGS", strings.Join(report.Tags, ",")},
+		{"GAZE_ATTEMPTS", strconv.Itoa(len(report.Attempts))},
+	}
+	if report.LimitHit != "" {
+		fields = append(fields, [2]string{"GAZE_LIMIT_HIT", report.LimitHit})
+	}
+	if includeOutput {
+		fields = append(fields, [2]string{"GAZE_OUTPUT", report.CapturedOutput})
+	}
+
+	keys := make([]string, 0, len(report.Metrics))
+	for k := range report.Metrics {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fields = append(fields, [2]string{journalFieldName("GAZE_METRIC_", k), strconv.FormatFloat(report.Metrics[k], 'f', -1, 64)})
+	}
+	keys = keys[:0]
+	for k := range report.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fields = append(fields, [2]string{journalFieldName("GAZE_FIELD_", k), report.Fields[k]})
+	}
+	return fields
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"syscall"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+// sendJournalDatagram sends the entry directly or, when it is too large for a datagram, through an unlinked file
+// descriptor in the same way that sd_journal_send does.
+func sendJournalDatagram(socketPath string, entry []byte) error {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write(entry)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, syscall.EMSGSIZE) && !errors.Is(err, syscall.ENOBUFS) {
+		return err
+	}
+
+	tmpDir := "/dev/shm"
+	if _, err := os.Stat(tmpDir); err != nil {
+		tmpDir = ""
+	}
+	f, err := ioutil.TempFile(tmpDir, "gaze-journal-")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := os.Remove(f.Name()); err != nil {
+		return err
+	}
+	if _, err := f.Write(entry); err != nil {
+		return err
+	}
+
+	// the go connection can't send ancillary data once connected so use a separate raw socket
+	sock, err := syscall.Socket(syscall.AF_UNIX, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(sock)
+	return syscall.Sendmsg(sock, nil, syscall.UnixRights(int(f.Fd())), &syscall.SockaddrUnix{Name: socketPath}, 0)
+}
+
+func RunJournaldBehaviour(report *GazeReport, config *conf.GazeBehaviourConfig) error {
+	socketPath := config.Settings["socket"].(string)
+	identifier := config.Settings["identifier"].(string)
+
+	var entry bytes.Buffer
+	for _, field := range buildJournalFields(report, identifier, config.IncludeOutput) {
+		if bytes.IndexByte([]byte(field[1]), '\n') < 0 {
+			entry.WriteString(field[0] + "=" + field[1] + "\n")
+			continue
+		}
+		// values containing newlines use the length prefixed binary form
+		entry.WriteString(field[0] + "\n")
+		binary.Write(&entry, binary.LittleEndian, uint64(len(field[1])))
+		entry.WriteString(field[1] + "\n")
+	}
+
+	log.Infof("Sending journal entry to %v..", socketPath)
+	if err := sendJournalDatagram(socketPath, entry.Bytes()); err != nil {
+		return fmt.Errorf("Could not write to journal: %v", err.Error())
+	}
+	return nil
+}
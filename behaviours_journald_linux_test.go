@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+func TestJournaldBehaviourNativeProtocol(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "journal.socket")
+	listener, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	config := &conf.GazeBehaviourConfig{Type: "journald", IncludeOutput: true, Settings: map[string]interface{}{"socket": socketPath}}
+	if err := conf.ValidateGazeJournaldBehaviour(config); err != nil {
+		t.Fatal(err)
+	}
+	report := &GazeReport{Ulid: "01BX5ZZKBKACTAV9WEVGEMMVRZ", Name: "backup", Status: conf.StatusFailure, CapturedOutput: "a\nb"}
+	if err := RunJournaldBehaviour(report, config); err != nil {
+		t.Fatal(err)
+	}
+
+	buffer := make([]byte, 65536)
+	n, err := listener.Read(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := buffer[:n]
+	if !bytes.HasPrefix(entry, []byte("MESSAGE=backup failure: \nPRIORITY=3\nSYSLOG_IDENTIFIER=gaze\n")) {
+		t.Errorf("unexpected start of entry %q", entry)
+	}
+	// a value with newlines is written as the name, a little endian length, and the raw value
+	var binaryField bytes.Buffer
+	binaryField.WriteString("GAZE_OUTPUT\n")
+	binary.Write(&binaryField, binary.LittleEndian, uint64(3))
+	binaryField.WriteString("a\nb\n")
+	if !bytes.Contains(entry, binaryField.Bytes()) {
+		t.Errorf("expected the output in the binary form in %q", entry)
+	}
+	if !strings.Contains(string(entry), "\nGAZE_ULID=01BX5ZZKBKACTAV9WEVGEMMVRZ\n") {
+		t.Errorf("expected the ulid field in %q", entry)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+func RunJournaldBehaviour(report *GazeReport, config *conf.GazeBehaviourConfig) error {
+	return fmt.Errorf("The journald behaviour is only supported on linux")
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+func TestJournalFieldName(t *testing.T) {
+	cases := []struct {
+		prefix   string
+		name     string
+		expected string
+	}{
+		{"GAZE_METRIC_", "rows", "GAZE_METRIC_ROWS"},
+		{"GAZE_FIELD_", "db.table-name", "GAZE_FIELD_DB_TABLE_NAME"},
+		{"", "_SYSTEMD_UNIT", "SYSTEMD_UNIT"},
+		{"", "__", "GAZE_"},
+		{"", "", "GAZE_"},
+		{"", "2xx", "GAZE_2XX"},
+		{"", "_9lives", "GAZE_9LIVES"},
+		{"", "naïve", "NA_VE"},
+		{"GAZE_FIELD_", strings.Repeat("x", 80), "GAZE_FIELD_" + strings.Repeat("X", 53)},
+	}
+	for _, c := range cases {
+		actual := journalFieldName(c.prefix, c.name)
+		if actual != c.expected {
+			t.Errorf("%q %q: expected '%v' but got '%v'", c.prefix, c.name, c.expected, actual)
+		}
+		if len(actual) > 64 || actual[0] == '_' || (actual[0] >= '0' && actual[0] <= '9') {
+			t.Errorf("%q %q: '%v' is not a valid journal field name", c.prefix, c.name, actual)
+		}
+	}
+}
+
+func TestBuildJournalFields(t *testing.T) {
+	report := &GazeReport{
+		Ulid: "01BX5ZZKBKACTAV9WEVGEMMVRZ", Name: "backup", Status: conf.StatusWarning, ExitCode: 3,
+		ExitDescription: "Execution failed with code 3", Command: []string{"backup.sh", "--all"},
+		Tags: []string{"env:prod"}, LimitHit: "open_files", CapturedOutput: "line 1\nline 2\n",
+		Metrics: map[string]float64{"rows": 10, "bytes": 1.5}, Fields: map[string]string{"db": "users"},
+	}
+	fields := buildJournalFields(report, "gaze", true)
+	values := make(map[string]string)
+	names := make([]string, 0, len(fields))
+	for _, f := range fields {
+		values[f[0]] = f[1]
+		names = append(names, f[0])
+	}
+	for name, expected := range map[string]string{
+		"MESSAGE":           "backup warning: Execution failed with code 3",
+		"PRIORITY":          "4",
+		"SYSLOG_IDENTIFIER": "gaze",
+		"GAZE_COMMAND":      "backup.sh --all",
+		"GAZE_LIMIT_HIT":    "open_files",
+		"GAZE_OUTPUT":       "line 1\nline 2\n",
+	} {
+		if values[name] != expected {
+			t.Errorf("expected %v to be %q but got %q", name, expected, values[name])
+		}
+	}
+	// metrics and fields come last in name order so that entries are stable
+	if tail := strings.Join(names[len(names)-3:], ","); tail != "GAZE_METRIC_BYTES,GAZE_METRIC_ROWS,GAZE_FIELD_DB" {
+		t.Errorf("unexpected extracted value fields %v", tail)
+	}
+	if withoutOutput := buildJournalFields(report, "gaze", false); len(withoutOutput) != len(fields)-1 {
+		t.Errorf("expected the output to be left out without include_output")
+	}
+}
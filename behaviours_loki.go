@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+// lokiMaxBatchBytes bounds the size of the lines sent in a single push request
+const lokiMaxBatchBytes = 1024 * 1024
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+type lokiPushRequest struct {
+	Streams []lokiStream `json:"streams"`
+}
+
+// lokiStreamLabels builds the stream labels from the tags and the name, host, and status of the run
+func lokiStreamLabels(report *GazeReport) map[string]string {
+	labels := make(map[string]string)
+	for _, l := range reportTagLabels(report.Tags) {
+		labels[l[0]] = l[1]
+	}
+	labels["name"] = report.Name
+	labels["host"] = report.Hostname
+	labels["status"] = report.Status
+	return labels
+}
+
+// lokiEntries pairs each line of the captured output with the time it was written, keeping the timestamps in order
+// since loki rejects out of order entries within a stream.
+func lokiEntries(report *GazeReport) [][2]string {
+	output := strings.TrimSuffix(report.CapturedOutput, "\n")
+	if output == "" {
+		return nil
+	}
+	lines := strings.Split(output, "\n")
+	entries := make([][2]string, len(lines))
+	var previous int64
+	for i, line := range lines {
+		t := report.EndTime
+		if i < len(report.outputLineTimes) {
+			t = report.outputLineTimes[i]
+		}
+		ts := t.UnixNano()
+		if ts <= previous {
+			ts = previous + 1
+		}
+		previous = ts
+		entries[i] = [2]string{strconv.FormatInt(ts, 10), strings.TrimSuffix(line, "\r")}
+	}
+	return entries
+}
+
+func RunLokiBehaviour(report *GazeReport, config *conf.GazeBehaviourConfig) error {
+	entries := lokiEntries(report)
+	if len(entries) == 0 {
+		log.Infof("Skipping loki behaviour since there was no output")
+		return nil
+	}
+	pushURL := config.Settings["url"].(string) + "/loki/api/v1/push"
+	labels := lokiStreamLabels(report)
+
+	for len(entries) > 0 {
+		size, count := 0, 0
+		for count < len(entries) && (count == 0 || size+len(entries[count][1]) <= lokiMaxBatchBytes) {
+			size += len(entries[count][1])
+			count++
+		}
+		data, _ := json.Marshal(&lokiPushRequest{Streams: []lokiStream{{Stream: labels, Values: entries[:count]}}})
+		entries = entries[count:]
+
+		log.Infof("Pushing %v lines to %v..", count, pushURL)
+		req, err := http.NewRequest("POST", pushURL, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if tenant := config.Settings["tenant_id"].(string); tenant != "" {
+			req.Header.Set("X-Scope-OrgID", tenant)
+		}
+		if username := config.Settings["username"].(string); username != "" {
+			req.SetBasicAuth(username, config.Settings["password"].(string))
+		}
+		if _, err := doBehaviourRequest(req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
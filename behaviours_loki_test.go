@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+func TestLokiStreamLabels(t *testing.T) {
+	report := &GazeReport{
+		Name: "backup", Hostname: "db1", Status: conf.StatusFailure,
+		Tags: []string{"env:prod", "nightly", "status:ignored"},
+	}
+	expected := map[string]string{"env": "prod", "tags": "nightly", "name": "backup", "host": "db1", "status": conf.StatusFailure}
+	if actual := lokiStreamLabels(report); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v but got %v", expected, actual)
+	}
+}
+
+func TestLokiEntries(t *testing.T) {
+	base := time.Unix(1500000000, 0)
+	cases := []struct {
+		name     string
+		output   string
+		times    []time.Time
+		expected [][2]string
+	}{
+		{"empty", "", nil, nil},
+		{"only newline", "\n", nil, nil},
+		{
+			"line times", "a\nb\n", []time.Time{base, base.Add(time.Second)},
+			[][2]string{{"1500000000000000000", "a"}, {"1500000001000000000", "b"}},
+		},
+		{
+			"carriage returns", "a\r\nb", []time.Time{base, base},
+			[][2]string{{"1500000000000000000", "a"}, {"1500000000000000001", "b"}},
+		},
+		{
+			"out of order", "a\nb\nc", []time.Time{base.Add(time.Second), base, base.Add(time.Second)},
+			[][2]string{{"1500000001000000000", "a"}, {"1500000001000000001", "b"}, {"1500000001000000002", "c"}},
+		},
+		{
+			"missing times use the end time", "a\nb", []time.Time{base},
+			[][2]string{{"1500000000000000000", "a"}, {"1500000002000000000", "b"}},
+		},
+	}
+	for _, c := range cases {
+		report := &GazeReport{CapturedOutput: c.output, outputLineTimes: c.times, EndTime: base.Add(2 * time.Second)}
+		if actual := lokiEntries(report); !reflect.DeepEqual(actual, c.expected) {
+			t.Errorf("%v: expected %v but got %v", c.name, c.expected, actual)
+		}
+	}
+}
+
+func TestRunLokiBehaviour(t *testing.T) {
+	var pushes []lokiPushRequest
+	var tenants, paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var push lokiPushRequest
+		if err := json.NewDecoder(r.Body).Decode(&push); err != nil {
+			t.Errorf("could not decode push: %v", err)
+		}
+		pushes = append(pushes, push)
+		tenants = append(tenants, r.Header.Get("X-Scope-OrgID"))
+		paths = append(paths, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	config := &conf.GazeBehaviourConfig{Type: "loki", Settings: map[string]interface{}{"url": server.URL + "/", "tenant_id": "team"}}
+	if err := conf.ValidateGazeLokiBehaviour(config); err != nil {
+		t.Fatal(err)
+	}
+
+	// no output means no push
+	report := &GazeReport{Name: "backup", Status: conf.StatusSuccess, EndTime: time.Unix(1500000000, 0)}
+	if err := RunLokiBehaviour(report, config); err != nil || len(pushes) != 0 {
+		t.Fatalf("expected no push without output but got %v pushes and %v", len(pushes), err)
+	}
+
+	// lines that do not fit in one batch are split across requests
+	long := strings.Repeat("x", lokiMaxBatchBytes/2+1)
+	report.CapturedOutput = "short\n" + long + "\n" + long + "\n"
+	if err := RunLokiBehaviour(report, config); err != nil {
+		t.Fatal(err)
+	}
+	if len(pushes) != 2 {
+		t.Fatalf("expected 2 pushes but got %v", len(pushes))
+	}
+	for i, count := range []int{2, 1} {
+		if paths[i] != "/loki/api/v1/push" || tenants[i] != "team" {
+			t.Errorf("push %v: unexpected path '%v' or tenant '%v'", i, paths[i], tenants[i])
+		}
+		if len(pushes[i].Streams) != 1 || len(pushes[i].Streams[0].Values) != count {
+			t.Errorf("push %v: expected one stream with %v lines but got %v", i, count, pushes[i].Streams)
+		} else if pushes[i].Streams[0].Stream["name"] != "backup" {
+			t.Errorf("push %v: unexpected labels %v", i, pushes[i].Streams[0].Stream)
+		}
+	}
+	if pushes[0].Streams[0].Values[0][1] != "short" || pushes[1].Streams[0].Values[0][1] != long {
+		t.Errorf("lines were not pushed in order")
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+// MQTT 3.1.1 control packet types, already shifted into the high nibble of the fixed header
+const (
+	mqttConnect    = 0x10
+	mqttConnack    = 0x20
+	mqttPublish    = 0x30
+	mqttPuback     = 0x40
+	mqttPubrec     = 0x50
+	mqttPubrel     = 0x62 // pubrel has the reserved flag bits 0010
+	mqttPubcomp    = 0x70
+	mqttDisconnect = 0xe0
+)
+
+// mqttString encodes a string with its two byte length prefix
+func mqttString(s string) []byte {
+	b := make([]byte, 2, 2+len(s))
+	binary.BigEndian.PutUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// mqttPacket prefixes the body with the fixed header and variable length remaining length
+func mqttPacket(header byte, body []byte) []byte {
+	packet := []byte{header}
+	length := len(body)
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		packet = append(packet, digit)
+		if length == 0 {
+			break
+		}
+	}
+	return append(packet, body...)
+}
+
+// readMQTTPacket reads a single packet and returns its fixed header and body
+func readMQTTPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		digit, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		if i >= 4 {
+			return 0, nil, fmt.Errorf("MQTT packet has a malformed remaining length")
+		}
+		length += int(digit&0x7f) * multiplier
+		multiplier *= 128
+		if digit&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, length)
+	_, err = io.ReadFull(r, body)
+	return header, body, err
+}
+
+// expectMQTTPacket reads the next packet and checks that it is the expected acknowledgement for the packet id
+func expectMQTTPacket(r *bufio.Reader, expected byte, packetID uint16) error {
+	header, body, err := readMQTTPacket(r)
+	if err != nil {
+		return err
+	}
+	if header&0xf0 != expected&0xf0 || len(body) < 2 || binary.BigEndian.Uint16(body) != packetID {
+		return fmt.Errorf("MQTT server sent unexpected packet 0x%x", header)
+	}
+	return nil
+}
+
+var mqttConnackErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+func buildMQTTConnect(clientID string, username string, password string) []byte {
+	var flags byte = 0x02 // clean session
+	payload := mqttString(clientID)
+	if username != "" {
+		flags |= 0x80
+		payload = append(payload, mqttString(username)...)
+		if password != "" {
+			flags |= 0x40
+			payload = append(payload, mqttString(password)...)
+		}
+	}
+	body := append(mqttString("MQTT"), 4, flags, 0, 60) // protocol level 4 and a 60 second keep alive
+	return mqttPacket(mqttConnect, append(body, payload...))
+}
+
+func buildMQTTPublish(topic string, payload []byte, qos int, retain bool, packetID uint16) []byte {
+	header := byte(mqttPublish) | byte(qos<<1)
+	if retain {
+		header |= 0x01
+	}
+	body := mqttString(topic)
+	if qos > 0 {
+		body = append(body, byte(packetID>>8), byte(packetID))
+	}
+	return mqttPacket(header, append(body, payload...))
+}
+
+// mqttClientID returns the configured client id, or one made from the end of the ulid. MQTT 3.1.1 only guarantees
+// that servers accept ids of up to 23 characters, and the random part of the ulid is at the end.
+func mqttClientID(report *GazeReport, config *conf.GazeBehaviourConfig) string {
+	if clientID := config.Settings["client_id"].(string); clientID != "" {
+		return clientID
+	}
+	ulid := report.Ulid
+	if len(ulid) > 18 {
+		ulid = ulid[len(ulid)-18:]
+	}
+	return "gaze-" + ulid
+}
+
+// publishMQTT connects over an established connection, publishes the payload, waits for the acknowledgements that
+// the qos requires, and disconnects.
+func publishMQTT(
+	conn io.ReadWriter, clientID string, username string, password string, topic string, payload []byte, qos int,
+	retain bool,
+) error {
+	reader := bufio.NewReader(conn)
+	if _, err := conn.Write(buildMQTTConnect(clientID, username, password)); err != nil {
+		return err
+	}
+	header, body, err := readMQTTPacket(reader)
+	if err != nil {
+		return err
+	}
+	if header != mqttConnack || len(body) != 2 {
+		return fmt.Errorf("MQTT server sent unexpected packet 0x%x instead of CONNACK", header)
+	}
+	if body[1] != 0 {
+		return fmt.Errorf("MQTT server refused the connection: %v", mqttConnackErrors[body[1]])
+	}
+
+	const packetID = 1
+	if _, err := conn.Write(buildMQTTPublish(topic, payload, qos, retain, packetID)); err != nil {
+		return err
+	}
+	switch qos {
+	case 1:
+		err = expectMQTTPacket(reader, mqttPuback, packetID)
+	case 2:
+		if err = expectMQTTPacket(reader, mqttPubrec, packetID); err == nil {
+			if _, err = conn.Write(mqttPacket(mqttPubrel, []byte{0, packetID})); err == nil {
+				err = expectMQTTPacket(reader, mqttPubcomp, packetID)
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write(mqttPacket(mqttDisconnect, nil))
+	return err
+}
+
+func RunMQTTBehaviour(report *GazeReport, config *conf.GazeBehaviourConfig) error {
+	address := config.Settings["address"].(string)
+	topic, err := renderReportTemplate("topic", config.Settings["topic"].(string), report)
+	if err != nil {
+		return err
+	}
+	payload, _ := json.Marshal(withoutOutput(report, config))
+
+	log.Infof("Publishing to MQTT topic '%v' on %v..", topic, address)
+	conn, err := dialBehaviourTCP(address, config.Settings["tls"].(bool), config.Settings["insecure_skip_verify"].(bool))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return publishMQTT(
+		conn, mqttClientID(report, config), config.Settings["username"].(string), config.Settings["password"].(string),
+		topic, payload, config.Settings["qos"].(int), config.Settings["retain"].(bool),
+	)
+}
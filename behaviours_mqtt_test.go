@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+func TestMQTTPacketRemainingLength(t *testing.T) {
+	for _, size := range []int{0, 127, 128, 16383, 16384, 300000} {
+		packet := mqttPacket(mqttPublish, bytes.Repeat([]byte{'x'}, size))
+		header, body, err := readMQTTPacket(bufio.NewReader(bytes.NewReader(packet)))
+		if err != nil {
+			t.Fatalf("%d: %v", size, err)
+		}
+		if header != mqttPublish || len(body) != size {
+			t.Errorf("%d: decoded header 0x%x with %d bytes", size, header, len(body))
+		}
+	}
+	malformed := []byte{mqttPublish, 0xff, 0xff, 0xff, 0xff, 0x01}
+	if _, _, err := readMQTTPacket(bufio.NewReader(bytes.NewReader(malformed))); err == nil {
+		t.Errorf("expected an error for a remaining length of more than 4 bytes")
+	}
+}
+
+func TestMQTTClientID(t *testing.T) {
+	report := &GazeReport{Ulid: "01BX5ZZKBKACTAV9WEVGEMMVRZ"}
+	config := &conf.GazeBehaviourConfig{Type: "mqtt", Settings: map[string]interface{}{
+		"address": "localhost",
+	}}
+	if err := conf.ValidateGazeMQTTBehaviour(config); err != nil {
+		t.Fatal(err)
+	}
+	if clientID := mqttClientID(report, config); clientID != "gaze-BKACTAV9WEVGEMMVRZ" || len(clientID) > 23 {
+		t.Errorf("unexpected client id '%v'", clientID)
+	}
+	config.Settings["client_id"] = "backup-host1"
+	if clientID := mqttClientID(report, config); clientID != "backup-host1" {
+		t.Errorf("expected the configured client id but got '%v'", clientID)
+	}
+}
+
+// fakeMQTTPublish is what the fake broker decoded from the client
+type fakeMQTTPublish struct {
+	connect     []byte
+	publishFlag byte
+	topic       string
+	payload     string
+	packets     []byte
+}
+
+// runFakeMQTTBroker answers one client on the server end of a pipe, acknowledging a publish the way its qos requires
+func runFakeMQTTBroker(t *testing.T, conn net.Conn, returnCode byte) chan *fakeMQTTPublish {
+	result := make(chan *fakeMQTTPublish, 1)
+	go func() {
+		defer conn.Close()
+		seen := new(fakeMQTTPublish)
+		defer func() { result <- seen }()
+		r := bufio.NewReader(conn)
+		for {
+			header, body, err := readMQTTPacket(r)
+			if err != nil {
+				return
+			}
+			seen.packets = append(seen.packets, header)
+			switch header & 0xf0 {
+			case mqttConnect:
+				seen.connect = body
+				conn.Write(mqttPacket(mqttConnack, []byte{0, returnCode}))
+			case mqttPublish:
+				seen.publishFlag = header & 0x0f
+				topicLength := int(binary.BigEndian.Uint16(body))
+				seen.topic = string(body[2 : 2+topicLength])
+				rest := body[2+topicLength:]
+				switch (header >> 1) & 0x03 {
+				case 1:
+					conn.Write(mqttPacket(mqttPuback, rest[:2]))
+					rest = rest[2:]
+				case 2:
+					conn.Write(mqttPacket(mqttPubrec, rest[:2]))
+					rest = rest[2:]
+				}
+				seen.payload = string(rest)
+			case mqttPubrel & 0xf0:
+				conn.Write(mqttPacket(mqttPubcomp, body))
+			case mqttDisconnect:
+				return
+			}
+		}
+	}()
+	return result
+}
+
+func TestMQTTPublishQoS(t *testing.T) {
+	expectedPackets := map[int][]byte{
+		0: {mqttConnect, mqttPublish | 0x01, mqttDisconnect},
+		1: {mqttConnect, mqttPublish | 0x02 | 0x01, mqttDisconnect},
+		2: {mqttConnect, mqttPublish | 0x04 | 0x01, mqttPubrel, mqttDisconnect},
+	}
+	for qos := 0; qos <= 2; qos++ {
+		client, server := net.Pipe()
+		result := runFakeMQTTBroker(t, server, 0)
+		err := publishMQTT(client, "gaze-client", "user", "pass", "gaze/backup/failure", []byte(`{"a":1}`), qos, true)
+		client.Close()
+		if err != nil {
+			t.Fatalf("qos %d: %v", qos, err)
+		}
+		seen := <-result
+		if !bytes.Equal(seen.packets, expectedPackets[qos]) {
+			t.Errorf("qos %d: expected packets %x but got %x", qos, expectedPackets[qos], seen.packets)
+		}
+		if seen.topic != "gaze/backup/failure" || seen.payload != `{"a":1}` {
+			t.Errorf("qos %d: unexpected topic '%v' or payload '%v'", qos, seen.topic, seen.payload)
+		}
+		if seen.publishFlag&0x01 != 0x01 {
+			t.Errorf("qos %d: expected the retain flag", qos)
+		}
+		// protocol name, level 4, clean session with username and password, and the 60 second keep alive
+		expectedConnect := append(mqttString("MQTT"), 4, 0xc2, 0, 60)
+		expectedConnect = append(expectedConnect, mqttString("gaze-client")...)
+		expectedConnect = append(expectedConnect, mqttString("user")...)
+		expectedConnect = append(expectedConnect, mqttString("pass")...)
+		if !bytes.Equal(seen.connect, expectedConnect) {
+			t.Errorf("qos %d: unexpected connect %q", qos, seen.connect)
+		}
+	}
+}
+
+func TestMQTTPublishRefused(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	runFakeMQTTBroker(t, server, 2)
+	err := publishMQTT(client, "gaze-client", "", "", "topic", nil, 0, false)
+	if err == nil || !strings.Contains(err.Error(), "identifier rejected") {
+		t.Errorf("expected the connection to be refused but got %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+// natsServerInfo holds the parts of the INFO message sent by the server on connect that gaze needs
+type natsServerInfo struct {
+	TLSRequired bool  `json:"tls_required"`
+	MaxPayload  int64 `json:"max_payload"`
+}
+
+// natsSubject replaces the whitespace that is not allowed in subjects
+func natsSubject(subject string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\r' || r == '\n' {
+			return '_'
+		}
+		return r
+	}, subject)
+}
+
+// readNATSLine reads a single protocol line, turning server errors into errors
+func readNATSLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if strings.HasPrefix(line, "-ERR") {
+		return "", fmt.Errorf("NATS server returned an error: %v", strings.TrimSpace(line[4:]))
+	}
+	return line, nil
+}
+
+// publishNATS reads the server INFO from an established connection, upgrades it to tls when needed, and publishes the
+// payload, waiting for the server to process it.
+func publishNATS(conn net.Conn, config *conf.GazeBehaviourConfig, subject string, payload []byte) error {
+	useTLS := config.Settings["tls"].(bool)
+	reader := bufio.NewReader(conn)
+	line, err := readNATSLine(reader)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("NATS server sent '%v' instead of INFO", line)
+	}
+	var info natsServerInfo
+	if err := json.Unmarshal([]byte(line[5:]), &info); err != nil {
+		return fmt.Errorf("Could not parse NATS server INFO: %v", err.Error())
+	}
+	if info.MaxPayload > 0 && int64(len(payload)) > info.MaxPayload {
+		return fmt.Errorf("Report of %v bytes is larger than the NATS max payload of %v", len(payload), info.MaxPayload)
+	}
+	if useTLS || info.TLSRequired {
+		host, _, _ := net.SplitHostPort(config.Settings["address"].(string))
+		tlsConn := tls.Client(conn, &tls.Config{
+			ServerName:         host,
+			InsecureSkipVerify: config.Settings["insecure_skip_verify"].(bool),
+		})
+		if err := tlsConn.Handshake(); err != nil {
+			return err
+		}
+		defer tlsConn.Close()
+		conn = tlsConn
+		reader = bufio.NewReader(conn)
+	}
+
+	connect := map[string]interface{}{
+		"verbose": false, "pedantic": false, "tls_required": useTLS || info.TLSRequired,
+		"name": "gaze", "lang": "go", "version": Version, "protocol": 1,
+	}
+	if token := config.Settings["token"].(string); token != "" {
+		connect["auth_token"] = token
+	}
+	if username := config.Settings["username"].(string); username != "" {
+		connect["user"] = username
+		connect["pass"] = config.Settings["password"].(string)
+	}
+	connectData, _ := json.Marshal(connect)
+
+	// the PING is answered with a PONG once the server has processed everything before it, or an error if the
+	// connect or publish failed
+	message := fmt.Sprintf("CONNECT %s\r\nPUB %v %d\r\n%s\r\nPING\r\n", connectData, subject, len(payload), payload)
+	if _, err := conn.Write([]byte(message)); err != nil {
+		return err
+	}
+	for {
+		line, err := readNATSLine(reader)
+		if err != nil {
+			return err
+		}
+		if line == "PONG" {
+			return nil
+		}
+	}
+}
+
+func RunNATSBehaviour(report *GazeReport, config *conf.GazeBehaviourConfig) error {
+	address := config.Settings["address"].(string)
+	subject, err := renderReportTemplate("subject", config.Settings["subject"].(string), report)
+	if err != nil {
+		return err
+	}
+	subject = natsSubject(subject)
+	payload, _ := json.Marshal(withoutOutput(report, config))
+
+	log.Infof("Publishing to NATS subject '%v' on %v..", subject, address)
+	// nats servers send their INFO in plain text and then upgrade to tls if required
+	conn, err := dialBehaviourTCP(address, false, false)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return publishNATS(conn, config, subject, payload)
+}
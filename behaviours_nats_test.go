@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+// fakeNATSSession is what the fake server decoded from the client
+type fakeNATSSession struct {
+	connect map[string]interface{}
+	subject string
+	payload string
+}
+
+// runFakeNATSServer sends the info line and then answers the client on the server end of a pipe, replying to the
+// publish with the given error or a PONG
+func runFakeNATSServer(t *testing.T, conn net.Conn, info string, pubError string) chan *fakeNATSSession {
+	result := make(chan *fakeNATSSession, 1)
+	go func() {
+		defer conn.Close()
+		session := new(fakeNATSSession)
+		defer func() { result <- session }()
+		conn.Write([]byte("INFO " + info + "\r\n"))
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			switch {
+			case strings.HasPrefix(line, "CONNECT "):
+				json.Unmarshal([]byte(line[8:]), &session.connect)
+			case strings.HasPrefix(line, "PUB "):
+				parts := strings.Fields(line)
+				session.subject = parts[1]
+				size, _ := strconv.Atoi(parts[2])
+				payload := make([]byte, size+2)
+				io.ReadFull(r, payload)
+				session.payload = string(payload[:size])
+				if pubError != "" {
+					conn.Write([]byte("-ERR '" + pubError + "'\r\n"))
+					return
+				}
+			case line == "PING":
+				conn.Write([]byte("PONG\r\n"))
+				return
+			}
+		}
+	}()
+	return result
+}
+
+func newNATSBehaviourConfig(t *testing.T, settings map[string]interface{}) *conf.GazeBehaviourConfig {
+	config := &conf.GazeBehaviourConfig{Type: "nats", Settings: map[string]interface{}{"address": "localhost"}}
+	for k, v := range settings {
+		config.Settings[k] = v
+	}
+	if err := conf.ValidateGazeNATSBehaviour(config); err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+func TestNATSPublish(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	result := runFakeNATSServer(t, server, `{"server_id":"fake","max_payload":1048576}`, "")
+	config := newNATSBehaviourConfig(t, map[string]interface{}{"username": "gaze", "password": "secret"})
+	if err := publishNATS(client, config, natsSubject("gaze.back up.failure"), []byte(`{"a":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	session := <-result
+	if session.subject != "gaze.back_up.failure" || session.payload != `{"a":1}` {
+		t.Errorf("unexpected subject '%v' or payload '%v'", session.subject, session.payload)
+	}
+	if session.connect["user"] != "gaze" || session.connect["pass"] != "secret" || session.connect["verbose"] != false {
+		t.Errorf("unexpected connect %v", session.connect)
+	}
+}
+
+func TestNATSPublishErrors(t *testing.T) {
+	client, server := net.Pipe()
+	runFakeNATSServer(t, server, `{"max_payload":4}`, "")
+	err := publishNATS(client, newNATSBehaviourConfig(t, nil), "subject", []byte(`{"a":1}`))
+	client.Close()
+	if err == nil || !strings.Contains(err.Error(), "larger than the NATS max payload of 4") {
+		t.Errorf("expected a max payload error but got %v", err)
+	}
+
+	client, server = net.Pipe()
+	runFakeNATSServer(t, server, `{}`, "Permissions Violation for Publish to subject")
+	err = publishNATS(client, newNATSBehaviourConfig(t, nil), "subject", []byte(`{"a":1}`))
+	client.Close()
+	if err == nil || err.Error() != "NATS server returned an error: 'Permissions Violation for Publish to subject'" {
+		t.Errorf("expected the server error but got %v", err)
+	}
+}
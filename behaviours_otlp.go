@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/AstromechZA/gaze/conf"
+
+	"github.com/oklog/ulid"
+)
+
+const (
+	otlpSpanKindInternal = 1
+	otlpStatusOk         = 1
+	otlpStatusError      = 2
+)
+
+var traceparentRegex = regexp.MustCompile(`^[0-9a-f]{2}-([0-9a-f]{32})-([0-9a-f]{16})-[0-9a-f]{2}$`)
+
+// parseTraceparent returns the trace and parent span ids from a W3C traceparent header value
+func parseTraceparent(value string) (string, string, error) {
+	value = strings.TrimSpace(value)
+	parts := traceparentRegex.FindStringSubmatch(value)
+	if parts == nil || strings.HasPrefix(value, "ff") ||
+		parts[1] == strings.Repeat("0", 32) || parts[2] == strings.Repeat("0", 16) {
+		return "", "", fmt.Errorf("TRACEPARENT '%v' is not a valid traceparent", value)
+	}
+	return parts[1], parts[2], nil
+}
+
+// otlpTraceIDs picks the trace and parent span ids, nesting under TRACEPARENT when it is set and otherwise using the
+// ulid of the run as the trace id of a new trace.
+func otlpTraceIDs(report *GazeReport) (string, string) {
+	if tp := os.Getenv("TRACEPARENT"); tp != "" {
+		traceID, parentID, err := parseTraceparent(tp)
+		if err == nil {
+			return traceID, parentID
+		}
+		log.Warningf("Ignoring parent trace: %v", err.Error())
+	}
+	if parsed, err := ulid.Parse(report.Ulid); err == nil {
+		return hex.EncodeToString(parsed[:]), ""
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id), ""
+}
+
+// otlpTagAttributes returns an attribute for each "key:value" or "key=value" tag
+func otlpTagAttributes(report *GazeReport) []otlpKeyValue {
+	attributes := []otlpKeyValue{}
+	for _, l := range reportTagLabels(report.Tags) {
+		if l[0] != "tags" {
+			attributes = append(attributes, otlpStringAttr("gaze.tag."+l[0], l[1]))
+		}
+	}
+	return attributes
+}
+
+func otlpResourceFor(report *GazeReport, serviceName string) otlpResource {
+	return otlpResource{Attributes: []otlpKeyValue{
+		otlpStringAttr("service.name", serviceName),
+		otlpStringAttr("host.name", report.Hostname),
+	}}
+}
+
+// buildOTLPSpan converts the report into a span with the fields and metrics as attributes
+func buildOTLPSpan(report *GazeReport, includeOutput bool) otlpSpan {
+	traceID, parentID := otlpTraceIDs(report)
+	spanID := make([]byte, 8)
+	rand.Read(spanID)
+
+	attributes := []otlpKeyValue{
+		otlpStringAttr("gaze.ulid", report.Ulid),
+		otlpStringAttr("gaze.name", report.Name),
+		otlpStringsAttr("gaze.command", report.Command),
+		otlpStringAttr("gaze.status", report.Status),
+		otlpIntAttr("gaze.exit_code", int64(report.ExitCode)),
+		otlpStringAttr("gaze.exit_description", report.ExitDescription),
+		otlpIntAttr("gaze.attempts", int64(len(report.Attempts))),
+		otlpStringsAttr("gaze.tags", report.Tags),
+	}
+	if report.LimitHit != "" {
+		attributes = append(attributes, otlpStringAttr("gaze.limit_hit", report.LimitHit))
+	}
+	attributes = append(attributes, otlpTagAttributes(report)...)
+	keys := make([]string, 0, len(report.Fields)+len(report.Metrics))
+	for k := range report.Fields {
+		keys = append(keys, k)
+	}
+	for k := range report.Metrics {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if v, ok := report.Metrics[k]; ok {
+			attributes = append(attributes, otlpDoubleAttr("gaze.metric."+k, v))
+		} else {
+			attributes = append(attributes, otlpStringAttr("gaze.field."+k, report.Fields[k]))
+		}
+	}
+
+	span := otlpSpan{
+		TraceID:           traceID,
+		SpanID:            hex.EncodeToString(spanID),
+		ParentSpanID:      parentID,
+		Name:              report.Name,
+		Kind:              otlpSpanKindInternal,
+		StartTimeUnixNano: otlpUint64(report.StartTime.UnixNano()),
+		EndTimeUnixNano:   otlpUint64(report.EndTime.UnixNano()),
+		Attributes:        attributes,
+		Status:            otlpStatus{Code: otlpStatusOk},
+	}
+	if parentID != "" {
+		span.TraceState = os.Getenv("TRACESTATE")
+	}
+	if report.Status == conf.StatusFailure {
+		span.Status = otlpStatus{Code: otlpStatusError, Message: report.ExitDescription}
+	}
+	if includeOutput && report.OutputTail != "" {
+		span.Events = []otlpEvent{{
+			TimeUnixNano: span.EndTimeUnixNano,
+			Name:         "output",
+			Attributes:   []otlpKeyValue{otlpStringAttr("gaze.output_tail", report.OutputTail)},
+		}}
+	}
+	return span
+}
+
+// buildOTLPMetrics converts the report metrics into gauges at the end time of the run
+func buildOTLPMetrics(report *GazeReport) []otlpMetric {
+	attributes := append([]otlpKeyValue{otlpStringAttr("gaze.name", report.Name)}, otlpTagAttributes(report)...)
+	gauge := func(name string, unit string, value float64) otlpMetric {
+		return otlpMetric{Name: name, Unit: unit, Gauge: otlpGauge{DataPoints: []otlpDataPoint{{
+			Attributes: attributes, TimeUnixNano: otlpUint64(report.EndTime.UnixNano()), AsDouble: value,
+		}}}}
+	}
+	metrics := []otlpMetric{}
+	for _, m := range collectReportMetrics(report) {
+		// counters of a single run carry no more information than the success gauge
+		if m.Kind == metricKindCounter {
+			continue
+		}
+		name, unit := "gaze.run."+m.Name, "1"
+		if m.Name == "duration_seconds" {
+			name, unit = "gaze.run.duration", "s"
+		} else if strings.HasPrefix(m.Name, "metrics.") {
+			name = "gaze.metric." + strings.TrimPrefix(m.Name, "metrics.")
+		}
+		metrics = append(metrics, gauge(name, unit, m.Value))
+	}
+	return append(metrics, gauge("gaze.run.success", "1", boolToMetric(report.Status == conf.StatusSuccess)))
+}
+
+// otlpMarshaller is implemented by the export requests so that they can be encoded either way
+type otlpMarshaller interface {
+	marshalProto(b *protoBuffer)
+}
+
+func sendOTLP(config *conf.GazeBehaviourConfig, path string, request otlpMarshaller) error {
+	var body []byte
+	contentType := "application/x-protobuf"
+	if config.Settings["protocol"].(string) == "json" {
+		contentType = "application/json"
+		body, _ = json.Marshal(request)
+	} else {
+		var b protoBuffer
+		request.marshalProto(&b)
+		body = b.Bytes()
+	}
+
+	exportURL := config.Settings["url"].(string) + path
+	log.Infof("Making POST request to %v..", exportURL)
+	req, err := http.NewRequest("POST", exportURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for headerName, headerContent := range config.Settings["headers"].(map[string]string) {
+		req.Header.Set(headerName, headerContent)
+	}
+	_, err = doBehaviourRequest(req)
+	return err
+}
+
+func RunOTLPBehaviour(report *GazeReport, config *conf.GazeBehaviourConfig) error {
+	resource := otlpResourceFor(report, config.Settings["service_name"].(string))
+	scope := otlpScope{Name: "gaze", Version: Version}
+
+	traces := &otlpTracesRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: resource,
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: scope, Spans: []otlpSpan{buildOTLPSpan(report, config.IncludeOutput)},
+		}},
+	}}}
+	if err := sendOTLP(config, "/v1/traces", traces); err != nil {
+		return err
+	}
+
+	if config.Settings["metrics"].(bool) {
+		metrics := &otlpMetricsRequest{ResourceMetrics: []otlpResourceMetrics{{
+			Resource:     resource,
+			ScopeMetrics: []otlpScopeMetrics{{Scope: scope, Metrics: buildOTLPMetrics(report)}},
+		}}}
+		return sendOTLP(config, "/v1/metrics", metrics)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	cases := []struct {
+		name     string
+		input    string
+		traceID  string
+		parentID string
+		valid    bool
+	}{
+		{"valid", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", true},
+		{"surrounding space", " 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00\n", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", true},
+		{"invalid version", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "", "", false},
+		{"invalid version after space", " ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "", "", false},
+		{"zero trace id", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", "", "", false},
+		{"zero parent id", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", "", "", false},
+		{"upper case", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-01", "", "", false},
+		{"short", "00-4bf92f3577b34da6-00f067aa0ba902b7-01", "", "", false},
+		{"empty", "", "", "", false},
+	}
+	for _, c := range cases {
+		traceID, parentID, err := parseTraceparent(c.input)
+		if (err == nil) != c.valid {
+			t.Errorf("%v: expected valid %v but got error %v", c.name, c.valid, err)
+		} else if traceID != c.traceID || parentID != c.parentID {
+			t.Errorf("%v: expected '%v' '%v' but got '%v' '%v'", c.name, c.traceID, c.parentID, traceID, parentID)
+		}
+	}
+}
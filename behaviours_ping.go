@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/AstromechZA/gaze/conf"
+
+	"github.com/oklog/ulid"
+)
+
+// ulidAsUUID formats the 128 bits of a ulid as a uuid string since that is what run ids are expected to be
+func ulidAsUUID(id string) (string, error) {
+	parsed, err := ulid.Parse(id)
+	if err != nil {
+		return "", err
+	}
+	b := parsed[:]
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// pingSuffix picks the url suffix for the report following the healthchecks conventions. The status decides whether
+// the ping is a failure, since the status map may have turned a non-zero exit code into a success or warning that
+// healthchecks would otherwise record as down.
+func pingSuffix(report *GazeReport, useExitCode bool) string {
+	if report.Status == conf.StatusRunning {
+		if report.Heartbeat {
+			return "/log"
+		}
+		return "/start"
+	}
+	if report.Status != conf.StatusFailure {
+		return ""
+	}
+	// an exit code of 0 would be a success ping so failed assertions must still fail
+	if useExitCode && report.ExitCode > 0 && report.ExitCode <= 255 {
+		return fmt.Sprintf("/%d", report.ExitCode)
+	}
+	return "/fail"
+}
+
+func RunPingBehaviour(report *GazeReport, config *conf.GazeBehaviourConfig) error {
+	baseURL := config.Settings["base_url"].(string)
+	useExitCode := config.Settings["use_exit_code"].(bool)
+	useRunID := config.Settings["run_id"].(bool)
+
+	pingURL := baseURL + pingSuffix(report, useExitCode)
+	if useRunID {
+		rid, err := ulidAsUUID(report.Ulid)
+		if err != nil {
+			return err
+		}
+		pingURL += "?rid=" + url.QueryEscape(rid)
+	}
+
+	body := ""
+	if config.IncludeOutput {
+		body = report.OutputTail
+	}
+
+	log.Infof("Pinging %v..", pingURL)
+	req, err := http.NewRequest("POST", pingURL, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	_, err = doBehaviourRequest(req)
+	return err
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+func TestPingSuffix(t *testing.T) {
+	cases := []struct {
+		name        string
+		status      string
+		exitCode    int
+		heartbeat   bool
+		useExitCode bool
+		expected    string
+	}{
+		{"success", conf.StatusSuccess, 0, false, false, ""},
+		{"warning", conf.StatusWarning, 1, false, false, ""},
+		{"failure", conf.StatusFailure, 2, false, false, "/fail"},
+		{"start", conf.StatusRunning, 0, false, true, "/start"},
+		{"heartbeat", conf.StatusRunning, 0, true, true, "/log"},
+		{"exit code success", conf.StatusSuccess, 0, false, true, ""},
+		{"exit code mapped to success", conf.StatusSuccess, 3, false, true, ""},
+		{"exit code mapped to warning", conf.StatusWarning, 24, false, true, ""},
+		{"exit code failure", conf.StatusFailure, 2, false, true, "/2"},
+		{"exit code failed assertion", conf.StatusFailure, 0, false, true, "/fail"},
+		{"exit code out of range", conf.StatusFailure, -1, false, true, "/fail"},
+	}
+	for _, c := range cases {
+		report := &GazeReport{Status: c.status, ExitCode: c.exitCode, Heartbeat: c.heartbeat}
+		if actual := pingSuffix(report, c.useExitCode); actual != c.expected {
+			t.Errorf("%v: expected suffix '%v' but got '%v'", c.name, c.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / 1e9
+}
+
+// buildPromReportDocument writes the gauges describing the last run, the last success time is given separately since
+// it may come from an earlier run.
+func buildPromReportDocument(report *GazeReport, labels [][2]string, lastSuccess float64, haveLastSuccess bool) *promWriter {
+	w := &promWriter{labels: labels}
+	w.gauge("gaze_last_start_timestamp_seconds", "Unix time the last run started.", unixSeconds(report.StartTime))
+	w.gauge("gaze_last_end_timestamp_seconds", "Unix time the last run ended.", unixSeconds(report.EndTime))
+	w.gauge("gaze_last_duration_seconds", "Elapsed time of the last run.", float32ToMetric(report.ElapsedSeconds))
+	w.gauge("gaze_last_exit_code", "Exit code of the last run.", float64(report.ExitCode))
+	w.gauge("gaze_last_attempts", "Number of attempts made by the last run.", float64(len(report.Attempts)))
+	w.gauge("gaze_last_success", "Whether the last run succeeded.", boolToMetric(report.Status == conf.StatusSuccess))
+	if haveLastSuccess {
+		w.gauge("gaze_last_success_timestamp_seconds", "Unix time the last successful run ended.", lastSuccess)
+	}
+	if ru := report.ResourceUsage; ru != nil {
+		w.gauge("gaze_last_user_cpu_seconds", "User cpu time used by the last run.", ru.UserCPUSeconds)
+		w.gauge("gaze_last_system_cpu_seconds", "System cpu time used by the last run.", ru.SystemCPUSeconds)
+		w.gauge("gaze_last_max_rss_bytes", "Maximum resident set size of the last run.", float64(ru.MaxRSSBytes))
+	}
+	return w
+}
+
+// writeFileAtomically writes to a temporary file in the same directory and renames it over the target so that readers
+// never see a partial file.
+func writeFileAtomically(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func RunPrometheusTextfileBehaviour(report *GazeReport, config *conf.GazeBehaviourConfig) error {
+	directory := config.Settings["directory"].(string)
+	if err := checkLogDirectoryExists(directory); err != nil {
+		return err
+	}
+	filename := config.Settings["filename"].(string)
+	if filename == "" {
+		filename = fmt.Sprintf("gaze_%v.prom", promLabelName(report.Name))
+	}
+	path := filepath.Join(directory, filename)
+
+	lastSuccess, haveLastSuccess := unixSeconds(report.EndTime), report.Status == conf.StatusSuccess
+	if !haveLastSuccess {
+		if f, err := os.Open(path); err == nil {
+			lastSuccess, haveLastSuccess = findPromSample(f, "gaze_last_success_timestamp_seconds")
+			f.Close()
+		}
+	}
+
+	log.Infof("Writing prometheus metrics to '%v'..", path)
+	return writeFileAtomically(path, buildPromReportDocument(report, promReportLabels(report), lastSuccess, haveLastSuccess).buff.Bytes())
+}
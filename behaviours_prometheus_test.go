@@ -0,0 +1,102 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+func TestRunPrometheusTextfileBehaviour(t *testing.T) {
+	directory, err := ioutil.TempDir("", "gaze-prometheus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	config := &conf.GazeBehaviourConfig{Type: "prometheus_textfile", Settings: map[string]interface{}{"directory": directory}}
+	if err := conf.ValidateGazePrometheusTextfileBehaviour(config); err != nil {
+		t.Fatal(err)
+	}
+	report := &GazeReport{
+		Name:           "nightly backup",
+		Hostname:       "db1",
+		Tags:           []string{"env:prod"},
+		StartTime:      time.Unix(1500000000, 0),
+		EndTime:        time.Unix(1500000002, 500000000),
+		ElapsedSeconds: 2.5,
+		Status:         conf.StatusSuccess,
+		Attempts:       []*GazeAttempt{{}},
+	}
+	if err := RunPrometheusTextfileBehaviour(report, config); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(directory, "gaze_nightly_backup.prom")
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := `{name="nightly backup",host="db1",env="prod"}`
+	for _, line := range []string{
+		"# TYPE gaze_last_start_timestamp_seconds gauge",
+		"gaze_last_start_timestamp_seconds" + labels + " 1500000000",
+		"gaze_last_end_timestamp_seconds" + labels + " 1500000002.5",
+		"gaze_last_duration_seconds" + labels + " 2.5",
+		"gaze_last_success" + labels + " 1",
+		"gaze_last_success_timestamp_seconds" + labels + " 1500000002.5",
+	} {
+		if !strings.Contains(string(content), line+"\n") {
+			t.Errorf("expected line '%v' in %v", line, string(content))
+		}
+	}
+
+	// a failure keeps the last success time from the existing file
+	report.Status, report.ExitCode, report.EndTime = conf.StatusFailure, 1, time.Unix(1500003600, 0)
+	if err := RunPrometheusTextfileBehaviour(report, config); err != nil {
+		t.Fatal(err)
+	}
+	if content, err = ioutil.ReadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"gaze_last_exit_code" + labels + " 1",
+		"gaze_last_success" + labels + " 0",
+		"gaze_last_success_timestamp_seconds" + labels + " 1500000002.5",
+	} {
+		if !strings.Contains(string(content), line+"\n") {
+			t.Errorf("expected line '%v' in %v", line, string(content))
+		}
+	}
+
+	if entries, _ := ioutil.ReadDir(directory); len(entries) != 1 {
+		t.Errorf("expected only the metrics file to remain but got %v entries", len(entries))
+	}
+}
+
+func TestRunPrometheusTextfileBehaviourFirstFailure(t *testing.T) {
+	directory, err := ioutil.TempDir("", "gaze-prometheus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	config := &conf.GazeBehaviourConfig{Type: "prometheus_textfile", Settings: map[string]interface{}{"directory": directory, "filename": "custom.prom"}}
+	if err := conf.ValidateGazePrometheusTextfileBehaviour(config); err != nil {
+		t.Fatal(err)
+	}
+	report := &GazeReport{Name: "x", Status: conf.StatusFailure, ExitCode: 2}
+	if err := RunPrometheusTextfileBehaviour(report, config); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(directory, "custom.prom"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "gaze_last_success_timestamp_seconds") {
+		t.Errorf("expected no last success time before any success but got %v", string(content))
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+// pushgatewayPathSegment formats a grouping label for the url path, using the base64 form for values that could not
+// otherwise be represented.
+func pushgatewayPathSegment(name string, value string) string {
+	if value == "" || strings.Contains(value, "/") {
+		encoded := base64.RawURLEncoding.EncodeToString([]byte(value))
+		if encoded == "" {
+			encoded = "="
+		}
+		return name + "@base64/" + encoded
+	}
+	return name + "/" + url.PathEscape(value)
+}
+
+// pushgatewayURL builds the url for the job and instance grouping along with any labels from the tags
+func pushgatewayURL(baseURL string, report *GazeReport) string {
+	parts := []string{
+		baseURL, "metrics",
+		pushgatewayPathSegment("job", report.Name),
+		pushgatewayPathSegment("instance", report.Hostname),
+	}
+	for _, l := range reportTagLabels(report.Tags) {
+		parts = append(parts, pushgatewayPathSegment(l[0], l[1]))
+	}
+	return strings.Join(parts, "/")
+}
+
+// pushgatewayGrouping returns the grouping key labels that pushgatewayURL puts in the url path
+func pushgatewayGrouping(report *GazeReport) map[string]string {
+	grouping := map[string]string{"job": report.Name, "instance": report.Hostname}
+	for _, l := range reportTagLabels(report.Tags) {
+		grouping[l[0]] = l[1]
+	}
+	return grouping
+}
+
+type pushgatewayMetricFamily struct {
+	Metrics []struct {
+		Value string `json:"value"`
+	} `json:"metrics"`
+}
+
+// pushgatewayLastSuccess reads the last success time of the group from the pushgateway api, since the PUT of a run
+// that did not succeed would otherwise drop it.
+func pushgatewayLastSuccess(baseURL string, report *GazeReport, username string, password string) (float64, bool, error) {
+	req, err := http.NewRequest("GET", baseURL+"/api/v1/metrics", nil)
+	if err != nil {
+		return 0, false, err
+	}
+	if username != "" || password != "" {
+		req.SetBasicAuth(username, password)
+	}
+	body, err := doBehaviourRequest(req)
+	if err != nil {
+		return 0, false, err
+	}
+	var response struct {
+		Data []map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return 0, false, err
+	}
+	grouping := pushgatewayGrouping(report)
+	for _, group := range response.Data {
+		var labels map[string]string
+		if err := json.Unmarshal(group["labels"], &labels); err != nil || !reflect.DeepEqual(labels, grouping) {
+			continue
+		}
+		var family pushgatewayMetricFamily
+		if raw, ok := group["gaze_last_success_timestamp_seconds"]; ok && json.Unmarshal(raw, &family) == nil {
+			for _, m := range family.Metrics {
+				if v, err := strconv.ParseFloat(m.Value, 64); err == nil {
+					return v, true, nil
+				}
+			}
+		}
+	}
+	return 0, false, nil
+}
+
+func RunPushgatewayBehaviour(report *GazeReport, config *conf.GazeBehaviourConfig) error {
+	baseURL := config.Settings["url"].(string)
+	username := config.Settings["username"].(string)
+	password := config.Settings["password"].(string)
+
+	// a PUT replaces every metric in the group, so the last success time of an earlier run has to be carried over. If
+	// it cannot be read a POST is used instead, which only replaces the metrics that are pushed.
+	method := "PUT"
+	lastSuccess, haveLastSuccess := unixSeconds(report.EndTime), true
+	if report.Status != conf.StatusSuccess {
+		var err error
+		lastSuccess, haveLastSuccess, err = pushgatewayLastSuccess(baseURL, report, username, password)
+		if err != nil {
+			log.Warningf("Could not read the last success time from the pushgateway, pushing with POST instead: %v", err.Error())
+			method = "POST"
+		}
+	}
+
+	// the grouping labels are attached by the pushgateway so the samples themselves have none
+	w := buildPromReportDocument(report, nil, lastSuccess, haveLastSuccess)
+	if len(report.Metrics) > 0 {
+		names := make([]string, 0, len(report.Metrics))
+		for k := range report.Metrics {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		w.family("gaze_last_metric", "Metrics extracted from the output of the last run.")
+		for _, k := range names {
+			w.sample("gaze_last_metric", report.Metrics[k], [2]string{"metric", k})
+		}
+	}
+
+	pushURL := pushgatewayURL(baseURL, report)
+	log.Infof("Making %v request to %v..", method, pushURL)
+	req, err := http.NewRequest(method, pushURL, &w.buff)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if username != "" || password != "" {
+		req.SetBasicAuth(username, password)
+	}
+	_, err = doBehaviourRequest(req)
+	return err
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+func TestPushgatewayURL(t *testing.T) {
+	cases := []struct {
+		name     string
+		report   *GazeReport
+		expected string
+	}{
+		{"plain", &GazeReport{Name: "backup", Hostname: "db1"}, "http://pg/metrics/job/backup/instance/db1"},
+		{"escaped", &GazeReport{Name: "nightly backup", Hostname: "db1"}, "http://pg/metrics/job/nightly%20backup/instance/db1"},
+		{"slash", &GazeReport{Name: "a/b", Hostname: "db1"}, "http://pg/metrics/job@base64/YS9i/instance/db1"},
+		{"empty", &GazeReport{Name: "backup"}, "http://pg/metrics/job/backup/instance@base64/="},
+		{
+			"tags", &GazeReport{Name: "backup", Hostname: "db1", Tags: []string{"env:prod", "nightly"}},
+			"http://pg/metrics/job/backup/instance/db1/env/prod/tags/nightly",
+		},
+	}
+	for _, c := range cases {
+		if actual := pushgatewayURL("http://pg", c.report); actual != c.expected {
+			t.Errorf("%v: expected '%v' but got '%v'", c.name, c.expected, actual)
+		}
+	}
+}
+
+// fakePushgateway records the pushes it receives and serves the given status and body from the metrics api
+type fakePushgateway struct {
+	lock      sync.Mutex
+	apiStatus int
+	apiBody   string
+	methods   []string
+	paths     []string
+	bodies    []string
+}
+
+func (f *fakePushgateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if r.URL.Path == "/api/v1/metrics" {
+		w.WriteHeader(f.apiStatus)
+		fmt.Fprint(w, f.apiBody)
+		return
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	f.methods = append(f.methods, r.Method)
+	f.paths = append(f.paths, r.URL.EscapedPath())
+	f.bodies = append(f.bodies, string(body))
+}
+
+func newPushgatewayBehaviourConfig(t *testing.T, url string) *conf.GazeBehaviourConfig {
+	config := &conf.GazeBehaviourConfig{Type: "pushgateway", Settings: map[string]interface{}{"url": url + "/"}}
+	if err := conf.ValidateGazePushgatewayBehaviour(config); err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+func TestRunPushgatewayBehaviour(t *testing.T) {
+	gateway := &fakePushgateway{
+		apiStatus: http.StatusOK,
+		apiBody: `{"status":"success","data":[` +
+			`{"labels":{"job":"other","instance":"db1"},"gaze_last_success_timestamp_seconds":{"metrics":[{"value":"1"}]}},` +
+			`{"labels":{"job":"nightly backup","instance":"db1","env":"prod"},"gaze_last_success_timestamp_seconds":{"metrics":[{"value":"1500000000.5"}]}}` +
+			`]}`,
+	}
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+	config := newPushgatewayBehaviourConfig(t, server.URL)
+
+	report := &GazeReport{
+		Name:     "nightly backup",
+		Hostname: "db1",
+		Tags:     []string{"env:prod"},
+		EndTime:  time.Unix(1500003600, 0),
+		Status:   conf.StatusSuccess,
+		Metrics:  map[string]float64{"rows": 12},
+	}
+	if err := RunPushgatewayBehaviour(report, config); err != nil {
+		t.Fatal(err)
+	}
+	report.Status, report.ExitCode = conf.StatusFailure, 1
+	if err := RunPushgatewayBehaviour(report, config); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(gateway.paths) != 2 {
+		t.Fatalf("expected 2 pushes but got %v", len(gateway.paths))
+	}
+	for i, expected := range []string{"1500003600", "1500000000.5"} {
+		if gateway.methods[i] != "PUT" {
+			t.Errorf("push %v: expected a PUT but got %v", i, gateway.methods[i])
+		}
+		if gateway.paths[i] != "/metrics/job/nightly%20backup/instance/db1/env/prod" {
+			t.Errorf("push %v: unexpected path %v", i, gateway.paths[i])
+		}
+		for _, line := range []string{
+			"# TYPE gaze_last_exit_code gauge",
+			"gaze_last_success_timestamp_seconds " + expected,
+			"# TYPE gaze_last_metric gauge",
+			`gaze_last_metric{metric="rows"} 12`,
+		} {
+			if !strings.Contains(gateway.bodies[i], line+"\n") {
+				t.Errorf("push %v: expected line '%v' in %v", i, line, gateway.bodies[i])
+			}
+		}
+	}
+	if !strings.Contains(gateway.bodies[1], "gaze_last_exit_code 1\n") {
+		t.Errorf("expected the exit code of the failed run in %v", gateway.bodies[1])
+	}
+}
+
+func TestRunPushgatewayBehaviourWithoutLastSuccess(t *testing.T) {
+	cases := []struct {
+		name      string
+		apiStatus int
+		apiBody   string
+		method    string
+	}{
+		{"no earlier success", http.StatusOK, `{"status":"success","data":[]}`, "PUT"},
+		{"lookup failed", http.StatusInternalServerError, "broken", "POST"},
+		{"lookup unreadable", http.StatusOK, "not json", "POST"},
+	}
+	for _, c := range cases {
+		gateway := &fakePushgateway{apiStatus: c.apiStatus, apiBody: c.apiBody}
+		server := httptest.NewServer(gateway)
+		report := &GazeReport{Name: "backup", Hostname: "db1", Status: conf.StatusFailure, ExitCode: 2}
+		if err := RunPushgatewayBehaviour(report, newPushgatewayBehaviourConfig(t, server.URL)); err != nil {
+			t.Errorf("%v: unexpected error: %v", c.name, err)
+		} else if len(gateway.methods) != 1 || gateway.methods[0] != c.method {
+			t.Errorf("%v: expected a single %v but got %v", c.name, c.method, gateway.methods)
+		} else if strings.Contains(gateway.bodies[0], "gaze_last_success_timestamp_seconds") {
+			t.Errorf("%v: expected no last success time in %v", c.name, gateway.bodies[0])
+		}
+		server.Close()
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+// buildRESPCommand encodes a command as an array of bulk strings
+func buildRESPCommand(args ...string) []byte {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("*%d\r\n", len(args)))
+	for _, a := range args {
+		b.WriteString(fmt.Sprintf("$%d\r\n%v\r\n", len(a), a))
+	}
+	return []byte(b.String())
+}
+
+// readRESPReply reads and discards a single reply, returning an error if the reply or any element of it is an error
+func readRESPReply(r *bufio.Reader) error {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return fmt.Errorf("Redis server sent an empty reply")
+	}
+	switch line[0] {
+	case '+', ':':
+		return nil
+	case '-':
+		return fmt.Errorf("Redis server returned an error: %v", line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return err
+		}
+		if n >= 0 {
+			_, err = io.CopyN(ioutil.Discard, r, int64(n)+2)
+		}
+		return err
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			if err := readRESPReply(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("Redis server sent an unexpected reply '%v'", line)
+}
+
+// redisReportFields returns the flat field value pairs stored for a report in the hash and the stream
+func redisReportFields(report *GazeReport, reportJSON []byte) []string {
+	return []string{
+		"ulid", report.Ulid,
+		"name", report.Name,
+		"host", report.Hostname,
+		"status", report.Status,
+		"exit_code", strconv.Itoa(report.ExitCode),
+		"exit_description", report.ExitDescription,
+		"start_time", report.StartTime.Format(time.RFC3339Nano),
+		"end_time", report.EndTime.Format(time.RFC3339Nano),
+		"elapsed_seconds", strconv.FormatFloat(float64(report.ElapsedSeconds), 'f', -1, 32),
+		"tags", strings.Join(report.Tags, ","),
+		"report", string(reportJSON),
+	}
+}
+
+// buildRedisCommands lists the commands to send for a report according to the settings
+func buildRedisCommands(report *GazeReport, config *conf.GazeBehaviourConfig, key string, reportJSON []byte) [][]string {
+	commands := [][]string{}
+	if username, password := config.Settings["username"].(string), config.Settings["password"].(string); password != "" {
+		if username != "" {
+			commands = append(commands, []string{"AUTH", username, password})
+		} else {
+			commands = append(commands, []string{"AUTH", password})
+		}
+	}
+	if db := config.Settings["db"].(int); db != 0 {
+		commands = append(commands, []string{"SELECT", strconv.Itoa(db)})
+	}
+
+	fields := redisReportFields(report, reportJSON)
+	commands = append(commands, append([]string{"HSET", key}, fields...))
+	if ttl := config.Settings["ttl"].(time.Duration); ttl > 0 {
+		commands = append(commands, []string{"EXPIRE", key, strconv.Itoa(int(ttl / time.Second))})
+	}
+	if stream := config.Settings["stream"].(string); stream != "" {
+		xadd := []string{"XADD", stream}
+		if maxLen := config.Settings["stream_max_len"].(int); maxLen > 0 {
+			xadd = append(xadd, "MAXLEN", "~", strconv.Itoa(maxLen))
+		}
+		commands = append(commands, append(append(xadd, "*"), fields...))
+	}
+	if channel := config.Settings["channel"].(string); channel != "" {
+		commands = append(commands, []string{"PUBLISH", channel, string(reportJSON)})
+	}
+	return commands
+}
+
+func RunRedisBehaviour(report *GazeReport, config *conf.GazeBehaviourConfig) error {
+	address := config.Settings["address"].(string)
+	key, err := renderReportTemplate("key", config.Settings["key"].(string), report)
+	if err != nil {
+		return err
+	}
+	reportJSON, _ := json.Marshal(withoutOutput(report, config))
+	commands := buildRedisCommands(report, config, key, reportJSON)
+
+	log.Infof("Storing report in redis key '%v' on %v..", key, address)
+	conn, err := dialBehaviourTCP(address, config.Settings["tls"].(bool), config.Settings["insecure_skip_verify"].(bool))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// the commands are pipelined and then every reply is checked in order
+	var pipeline []byte
+	for _, c := range commands {
+		pipeline = append(pipeline, buildRESPCommand(c...)...)
+	}
+	if _, err := conn.Write(pipeline); err != nil {
+		return err
+	}
+	reader := bufio.NewReader(conn)
+	for _, c := range commands {
+		if err := readRESPReply(reader); err != nil {
+			return fmt.Errorf("%v failed: %v", c[0], err.Error())
+		}
+	}
+	return nil
+}
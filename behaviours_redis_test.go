@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+func TestBuildRESPCommand(t *testing.T) {
+	actual := string(buildRESPCommand("HSET", "gaze:last", "report", "line1\r\nline2", ""))
+	expected := "*5\r\n$4\r\nHSET\r\n$9\r\ngaze:last\r\n$6\r\nreport\r\n$12\r\nline1\r\nline2\r\n$0\r\n\r\n"
+	if actual != expected {
+		t.Errorf("expected %q but got %q", expected, actual)
+	}
+}
+
+func TestReadRESPReply(t *testing.T) {
+	for input, expectedErr := range map[string]string{
+		"+OK\r\n":                            "",
+		":11\r\n":                            "",
+		"$5\r\nhello\r\n":                    "",
+		"$-1\r\n":                            "",
+		"*-1\r\n":                            "",
+		"*0\r\n":                             "",
+		"*2\r\n*2\r\n+OK\r\n$-1\r\n:1\r\n":   "",
+		"-ERR unknown command 'XADD'\r\n":    "Redis server returned an error: ERR unknown command 'XADD'",
+		"*2\r\n:1\r\n*1\r\n-WRONGTYPE x\r\n": "Redis server returned an error: WRONGTYPE x",
+		"\r\n":                               "Redis server sent an empty reply",
+		"?what\r\n":                          "Redis server sent an unexpected reply '?what'",
+	} {
+		// each reply must be read completely so that the next one in the pipeline starts in the right place
+		r := bufio.NewReader(strings.NewReader(input + "+NEXT\r\n"))
+		err := readRESPReply(r)
+		if expectedErr == "" {
+			if err != nil {
+				t.Errorf("%q: unexpected error %v", input, err)
+			} else if next, _ := r.ReadString('\n'); next != "+NEXT\r\n" {
+				t.Errorf("%q: reply was not fully read, next line is %q", input, next)
+			}
+		} else if err == nil || err.Error() != expectedErr {
+			t.Errorf("%q: expected error '%v' but got %v", input, expectedErr, err)
+		}
+	}
+}
+
+// startFakeRedisServer accepts a single connection, decodes each command, and answers it with the reply for its name
+// or +OK, sending the commands it saw down the returned channel once the client disconnects
+func startFakeRedisServer(t *testing.T, replies map[string]string) (string, chan [][]string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := make(chan [][]string, 1)
+	go func() {
+		defer listener.Close()
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		commands := make([][]string, 0)
+		defer func() { result <- commands }()
+		r := bufio.NewReader(conn)
+		readLength := func(prefix byte) int {
+			line, err := r.ReadString('\n')
+			if err != nil || line[0] != prefix {
+				return -1
+			}
+			n, _ := strconv.Atoi(strings.TrimRight(line[1:], "\r\n"))
+			return n
+		}
+		for {
+			n := readLength('*')
+			if n < 0 {
+				return
+			}
+			command := make([]string, n)
+			for i := range command {
+				arg := make([]byte, readLength('$')+2)
+				if _, err := io.ReadFull(r, arg); err != nil {
+					return
+				}
+				command[i] = string(arg[:len(arg)-2])
+			}
+			commands = append(commands, command)
+			reply, ok := replies[command[0]]
+			if !ok {
+				reply = "+OK\r\n"
+			}
+			conn.Write([]byte(reply))
+		}
+	}()
+	return listener.Addr().String(), result
+}
+
+func newRedisBehaviourConfig(t *testing.T, address string, settings map[string]interface{}) *conf.GazeBehaviourConfig {
+	config := &conf.GazeBehaviourConfig{Type: "redis", Settings: map[string]interface{}{"address": address}}
+	for k, v := range settings {
+		config.Settings[k] = v
+	}
+	if err := conf.ValidateGazeRedisBehaviour(config); err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+func TestRedisBehaviourPipeline(t *testing.T) {
+	address, result := startFakeRedisServer(t, map[string]string{
+		"HSET":    ":11\r\n",
+		"EXPIRE":  ":1\r\n",
+		"XADD":    "$15\r\n1700000000000-0\r\n",
+		"PUBLISH": ":0\r\n",
+	})
+	config := newRedisBehaviourConfig(t, address, map[string]interface{}{"password": "secret", "channel": "gaze-events", "db": 2})
+	report := &GazeReport{Ulid: "01BX5ZZKBKACTAV9WEVGEMMVRZ", Name: "backup", Hostname: "host1", Status: conf.StatusSuccess}
+	if err := RunRedisBehaviour(report, config); err != nil {
+		t.Fatal(err)
+	}
+	commands := <-result
+
+	names := make([]string, 0, len(commands))
+	for _, c := range commands {
+		names = append(names, c[0])
+	}
+	if strings.Join(names, ",") != "AUTH,SELECT,HSET,EXPIRE,XADD,PUBLISH" {
+		t.Fatalf("unexpected commands %v", names)
+	}
+	if strings.Join(commands[0], " ") != "AUTH secret" || strings.Join(commands[1], " ") != "SELECT 2" {
+		t.Errorf("unexpected auth or select %q %q", commands[0], commands[1])
+	}
+	// the default ttl of 168h expires the hash after a week without a run
+	if strings.Join(commands[3], " ") != "EXPIRE gaze:last:host1:backup 604800" {
+		t.Errorf("unexpected expire %q", commands[3])
+	}
+	if strings.Join(commands[4][:6], " ") != "XADD gaze:runs MAXLEN ~ 10000 *" || commands[4][7] != report.Ulid {
+		t.Errorf("unexpected xadd %q", commands[4])
+	}
+	if commands[5][1] != "gaze-events" || !strings.HasPrefix(commands[5][2], "{\"ulid\":\"01BX5ZZKBKACTAV9WEVGEMMVRZ\"") {
+		t.Errorf("unexpected publish %q", commands[5])
+	}
+}
+
+func TestRedisBehaviourErrors(t *testing.T) {
+	address, result := startFakeRedisServer(t, map[string]string{"EXPIRE": "*2\r\n:1\r\n-ERR nested failure\r\n"})
+	config := newRedisBehaviourConfig(t, address, map[string]interface{}{"ttl": 0, "stream": ""})
+	if config.Settings["ttl"] != time.Duration(0) {
+		t.Errorf("expected a ttl of 0 to disable the expiry but got %v", config.Settings["ttl"])
+	}
+	report := &GazeReport{Ulid: "01BX5ZZKBKACTAV9WEVGEMMVRZ", Name: "backup", Hostname: "host1", Status: conf.StatusSuccess}
+	if err := RunRedisBehaviour(report, config); err != nil {
+		t.Fatal(err)
+	}
+	if commands := <-result; len(commands) != 1 || commands[0][0] != "HSET" {
+		t.Errorf("expected only HSET without a ttl or stream but got %q", commands)
+	}
+
+	address, _ = startFakeRedisServer(t, map[string]string{"EXPIRE": "*2\r\n:1\r\n-ERR nested failure\r\n"})
+	config = newRedisBehaviourConfig(t, address, map[string]interface{}{"ttl": "1h"})
+	err := RunRedisBehaviour(report, config)
+	if err == nil || err.Error() != "EXPIRE failed: Redis server returned an error: ERR nested failure" {
+		t.Errorf("expected the nested error from EXPIRE but got %v", err)
+	}
+}
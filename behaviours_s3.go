@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+// s3Credentials are the keys used to sign requests, taken from the settings or the standard AWS environment variables
+type s3Credentials struct {
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+}
+
+func s3CredentialsFrom(config *conf.GazeBehaviourConfig) (*s3Credentials, error) {
+	creds := &s3Credentials{
+		AccessKey:    config.Settings["access_key"].(string),
+		SecretKey:    config.Settings["secret_key"].(string),
+		SessionToken: config.Settings["session_token"].(string),
+	}
+	if creds.AccessKey == "" && creds.SecretKey == "" {
+		creds.AccessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+		creds.SecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		creds.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	if creds.AccessKey == "" || creds.SecretKey == "" {
+		return nil, fmt.Errorf("no s3 credentials in the settings or the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY variables")
+	}
+	return creds, nil
+}
+
+// s3EscapePath uri encodes everything but the unreserved characters and the slashes, the way sigv4 expects
+func s3EscapePath(path string) string {
+	var buff bytes.Buffer
+	for _, c := range []byte(path) {
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') || strings.IndexByte("-_.~/", c) >= 0 {
+			buff.WriteByte(c)
+		} else {
+			fmt.Fprintf(&buff, "%%%02X", c)
+		}
+	}
+	return buff.String()
+}
+
+// s3ObjectURL builds the url of an object, either with the bucket in the path or as a subdomain of the endpoint
+func s3ObjectURL(endpoint string, bucket string, key string, pathStyle bool) (*url.URL, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	path := "/" + strings.TrimPrefix(key, "/")
+	if pathStyle {
+		path = "/" + bucket + path
+	} else {
+		u.Host = bucket + "." + u.Host
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	u.RawPath = s3EscapePath(u.Path)
+	return u, nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// signS3Request adds the AWS signature version 4 headers to the request, covering the host, the x-amz headers, and
+// the hash of the payload.
+func signS3Request(req *http.Request, payload []byte, region string, creds *s3Credentials, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256.Sum256(payload)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "content-type" {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders bytes.Buffer
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := day + "/" + region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%v/%v, SignedHeaders=%v, Signature=%v",
+		creds.AccessKey, scope, signedHeaders, signature,
+	))
+}
+
+// putS3Object uploads a single object and returns its url
+func putS3Object(
+	config *conf.GazeBehaviourConfig, creds *s3Credentials, key string, contentType string, body []byte,
+) (string, error) {
+	u, err := s3ObjectURL(
+		config.Settings["endpoint"].(string), config.Settings["bucket"].(string), key,
+		config.Settings["path_style"].(bool),
+	)
+	if err != nil {
+		return "", err
+	}
+	log.Infof("Uploading %v bytes to %v..", len(body), u)
+	req, err := http.NewRequest("PUT", u.String(), bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", contentType)
+	signS3Request(req, body, config.Settings["region"].(string), creds, time.Now())
+	if _, err := doBehaviourRequest(req); err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func gzipBytes(data []byte) ([]byte, error) {
+	var buff bytes.Buffer
+	w := gzip.NewWriter(&buff)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buff.Bytes(), nil
+}
+
+// RunS3Behaviour uploads the gzipped captured output and then the report, recording the object urls in the report
+// artifacts so that the behaviours that run afterwards can link to them.
+func RunS3Behaviour(report *GazeReport, config *conf.GazeBehaviourConfig) error {
+	creds, err := s3CredentialsFrom(config)
+	if err != nil {
+		return err
+	}
+	prefix, err := renderReportTemplate("key", config.Settings["key"].(string), report)
+	if err != nil {
+		return err
+	}
+	prefix = strings.Trim(prefix, "/")
+
+	if report.CapturedOutput != "" {
+		compressed, err := gzipBytes([]byte(report.CapturedOutput))
+		if err != nil {
+			return err
+		}
+		outputURL, err := putS3Object(config, creds, prefix+"/output.log.gz", "application/gzip", compressed)
+		if err != nil {
+			return err
+		}
+		report.addArtifact("output", outputURL)
+	}
+
+	reportURL, err := s3ObjectURL(
+		config.Settings["endpoint"].(string), config.Settings["bucket"].(string), prefix+"/report.json",
+		config.Settings["path_style"].(bool),
+	)
+	if err != nil {
+		return err
+	}
+	// the uploaded report links to itself, but the link is only kept for later behaviours if the upload works
+	report.addArtifact("report", reportURL.String())
+	data, _ := json.Marshal(withoutOutput(report, config))
+	if _, err := putS3Object(config, creds, prefix+"/report.json", "application/json", data); err != nil {
+		delete(report.Artifacts, "report")
+		return err
+	}
+	return nil
+}
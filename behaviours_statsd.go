@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+// statsdTag removes the characters that have meaning in the DogStatsD tag section
+func statsdTag(tag string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ',' || r == '|' || r == '#' || r == '\n' || r == ' ' {
+			return '_'
+		}
+		return r
+	}, tag)
+}
+
+// buildStatsdLines formats the report metrics as statsd lines, timers are sent in milliseconds
+func buildStatsdLines(report *GazeReport, prefix string, withTags bool) []string {
+	suffix := ""
+	if withTags && len(report.Tags) > 0 {
+		tags := make([]string, len(report.Tags))
+		for i, t := range report.Tags {
+			tags[i] = statsdTag(t)
+		}
+		suffix = "|#" + strings.Join(tags, ",")
+	}
+	lines := []string{}
+	for _, m := range collectReportMetrics(report) {
+		value, kind := m.Value, "g"
+		switch m.Kind {
+		case metricKindCounter:
+			kind = "c"
+		case metricKindTimer:
+			value, kind = m.Value*1000, "ms"
+		}
+		lines = append(lines, fmt.Sprintf(
+			"%v:%v|%v%v", joinMetricPath(prefix, m.Name), strconv.FormatFloat(value, 'f', -1, 64), kind, suffix,
+		))
+	}
+	return lines
+}
+
+// packStatsdLines groups lines into newline separated packets no larger than the max size where possible
+func packStatsdLines(lines []string, maxSize int) [][]byte {
+	packets := [][]byte{}
+	var current bytes.Buffer
+	for _, l := range lines {
+		if current.Len() > 0 && current.Len()+1+len(l) > maxSize {
+			packets = append(packets, append([]byte{}, current.Bytes()...))
+			current.Reset()
+		}
+		if current.Len() > 0 {
+			current.WriteByte('\n')
+		}
+		current.WriteString(l)
+	}
+	if current.Len() > 0 {
+		packets = append(packets, current.Bytes())
+	}
+	return packets
+}
+
+func RunStatsdBehaviour(report *GazeReport, config *conf.GazeBehaviourConfig) error {
+	address := config.Settings["address"].(string)
+	prefix, err := renderMetricPrefix(report, config)
+	if err != nil {
+		return err
+	}
+	lines := buildStatsdLines(report, prefix, config.Settings["tags"].(bool))
+
+	log.Infof("Sending %v statsd metrics to %v..", len(lines), address)
+	conn, err := net.DialTimeout("udp", address, behaviourHTTPTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(behaviourHTTPTimeout))
+	for _, packet := range packStatsdLines(lines, config.Settings["max_packet_size"].(int)) {
+		if _, err := conn.Write(packet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
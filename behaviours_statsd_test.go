@@ -0,0 +1,83 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+func TestStatsdTag(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected string
+	}{
+		{"env:prod", "env:prod"},
+		{"a,b", "a_b"},
+		{"a|b#c", "a_b_c"},
+		{"two words\nand a line", "two_words_and_a_line"},
+	}
+	for _, c := range cases {
+		if actual := statsdTag(c.input); actual != c.expected {
+			t.Errorf("%q: expected '%v' but got '%v'", c.input, c.expected, actual)
+		}
+	}
+}
+
+func TestBuildStatsdLines(t *testing.T) {
+	report := &GazeReport{
+		ElapsedSeconds: 1.5,
+		Status:         conf.StatusSuccess,
+		Attempts:       []*GazeAttempt{{}},
+		Metrics:        map[string]float64{"rows": 0.25},
+		Tags:           []string{"env:prod", "a,b"},
+	}
+	expected := []string{
+		"gaze.duration_seconds:1500|ms",
+		"gaze.exit_code:0|g",
+		"gaze.attempts:1|g",
+		"gaze.runs:1|c",
+		"gaze.successes:1|c",
+		"gaze.warnings:0|c",
+		"gaze.failures:0|c",
+		"gaze.metrics.rows:0.25|g",
+	}
+	if actual := buildStatsdLines(report, "gaze", false); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v but got %v", expected, actual)
+	}
+
+	withTags := buildStatsdLines(report, "", true)
+	if withTags[0] != "duration_seconds:1500|ms|#env:prod,a_b" || withTags[7] != "metrics.rows:0.25|g|#env:prod,a_b" {
+		t.Errorf("unexpected tagged lines %v", withTags)
+	}
+
+	report.Tags = nil
+	if actual := buildStatsdLines(report, "", true); actual[0] != "duration_seconds:1500|ms" {
+		t.Errorf("expected no tag section without tags but got %v", actual[0])
+	}
+}
+
+func TestPackStatsdLines(t *testing.T) {
+	cases := []struct {
+		name     string
+		lines    []string
+		maxSize  int
+		expected []string
+	}{
+		{"empty", []string{}, 10, []string{}},
+		{"single", []string{"a:1|c"}, 10, []string{"a:1|c"}},
+		{"fits exactly", []string{"a:1|c", "b:1|c"}, 11, []string{"a:1|c\nb:1|c"}},
+		{"one over", []string{"a:1|c", "b:1|c"}, 10, []string{"a:1|c", "b:1|c"}},
+		{"oversized line kept whole", []string{"a:1|c", "long:12345|g", "b:1|c"}, 8, []string{"a:1|c", "long:12345|g", "b:1|c"}},
+		{"several packets", []string{"a:1|c", "b:1|c", "c:1|c"}, 12, []string{"a:1|c\nb:1|c", "c:1|c"}},
+	}
+	for _, c := range cases {
+		actual := []string{}
+		for _, p := range packStatsdLines(c.lines, c.maxSize) {
+			actual = append(actual, string(p))
+		}
+		if !reflect.DeepEqual(actual, c.expected) {
+			t.Errorf("%v: expected %q but got %q", c.name, c.expected, actual)
+		}
+	}
+}
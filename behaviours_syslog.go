@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+// syslogSDID is the structured data id used for report fields, using the enterprise number reserved for examples
+const syslogSDID = "gaze@32473"
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7, "uucp": 8,
+	"cron": 9, "authpriv": 10, "ftp": 11, "local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20,
+	"local5": 21, "local6": 22, "local7": 23,
+}
+
+// syslogSeverity maps a report status to a syslog severity
+func syslogSeverity(status string) int {
+	switch status {
+	case conf.StatusFailure:
+		return 3 // err
+	case conf.StatusWarning:
+		return 4 // warning
+	case conf.StatusRunning:
+		return 5 // notice
+	}
+	return 6 // info
+}
+
+// syslogParamName makes a string safe for use as an RFC 5424 structured data parameter name
+func syslogParamName(name string) string {
+	cleaned := strings.Map(func(r rune) rune {
+		if r <= 32 || r >= 127 || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, name)
+	if len(cleaned) > 32 {
+		cleaned = cleaned[:32]
+	}
+	return cleaned
+}
+
+// syslogParamValue escapes a structured data parameter value
+func syslogParamValue(value string) string {
+	return strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "]", "\\]").Replace(value)
+}
+
+// syslogHeaderValue makes a header field safe, using the nil value for empty strings
+func syslogHeaderValue(value string, maxLength int) string {
+	cleaned := strings.Map(func(r rune) rune {
+		if r <= 32 || r >= 127 {
+			return '_'
+		}
+		return r
+	}, value)
+	if cleaned == "" {
+		return "-"
+	}
+	if len(cleaned) > maxLength {
+		cleaned = cleaned[:maxLength]
+	}
+	return cleaned
+}
+
+// buildSyslogStructuredData builds the structured data element containing the report fields
+func buildSyslogStructuredData(report *GazeReport) string {
+	params := [][2]string{
+		{"ulid", report.Ulid},
+		{"name", report.Name},
+		{"status", report.Status},
+		{"exit_code", strconv.Itoa(report.ExitCode)},
+		{"elapsed_seconds", strconv.FormatFloat(float64(report.ElapsedSeconds), 'f', -1, 32)},
+		{"tags", strings.Join(report.Tags, ",")},
+		{"attempts", strconv.Itoa(len(report.Attempts))},
+	}
+	if report.LimitHit != "" {
+		params = append(params, [2]string{"limit_hit", report.LimitHit})
+	}
+	keys := make([]string, 0, len(report.Metrics)+len(report.Fields))
+	for k := range report.Metrics {
+		keys = append(keys, k)
+	}
+	for k := range report.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if v, ok := report.Metrics[k]; ok {
+			params = append(params, [2]string{k, strconv.FormatFloat(v, 'f', -1, 64)})
+		} else {
+			params = append(params, [2]string{k, report.Fields[k]})
+		}
+	}
+
+	var sd strings.Builder
+	sd.WriteString("[" + syslogSDID)
+	for _, p := range params {
+		sd.WriteString(fmt.Sprintf(" %v=\"%v\"", syslogParamName(p[0]), syslogParamValue(p[1])))
+	}
+	sd.WriteString("]")
+	return sd.String()
+}
+
+// buildSyslogMessage formats the report as an RFC 5424 message
+func buildSyslogMessage(report *GazeReport, facility int, appName string, includeOutput bool) string {
+	timestamp := report.EndTime
+	if report.Status == conf.StatusRunning {
+		timestamp = time.Now()
+	}
+	msg := fmt.Sprintf("%v %v: %v", report.Name, report.Status, report.ExitDescription)
+	if includeOutput && report.OutputTail != "" {
+		msg += "\n" + strings.TrimRight(report.OutputTail, "\n")
+	}
+	return fmt.Sprintf(
+		"<%d>1 %v %v %v %d %v %v %v",
+		facility*8+syslogSeverity(report.Status),
+		timestamp.Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogHeaderValue(report.Hostname, 255),
+		syslogHeaderValue(appName, 48),
+		os.Getpid(),
+		syslogHeaderValue(report.Status, 32),
+		buildSyslogStructuredData(report),
+		msg,
+	)
+}
+
+// dialSyslog connects to the local socket, trying datagram before stream, or to the remote server. It also returns
+// whether the connection is a stream and so needs framing.
+func dialSyslog(network string, address string) (net.Conn, bool, error) {
+	if network == "unix" {
+		if conn, err := net.DialTimeout("unixgram", address, behaviourHTTPTimeout); err == nil {
+			return conn, false, nil
+		}
+		conn, err := net.DialTimeout("unix", address, behaviourHTTPTimeout)
+		return conn, true, err
+	}
+	conn, err := net.DialTimeout(network, address, behaviourHTTPTimeout)
+	return conn, network == "tcp", err
+}
+
+func RunSyslogBehaviour(report *GazeReport, config *conf.GazeBehaviourConfig) error {
+	network := config.Settings["network"].(string)
+	address := config.Settings["address"].(string)
+	facility := syslogFacilities[config.Settings["facility"].(string)]
+	appName := config.Settings["app_name"].(string)
+
+	msg := buildSyslogMessage(report, facility, appName, config.IncludeOutput)
+
+	log.Infof("Sending syslog message to %v %v..", network, address)
+	conn, stream, err := dialSyslog(network, address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(behaviourHTTPTimeout))
+
+	if stream {
+		// octet counting framing from RFC 6587
+		msg = fmt.Sprintf("%d %v", len(msg), msg)
+	}
+	_, err = conn.Write([]byte(msg))
+	return err
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+func TestSyslogEscaping(t *testing.T) {
+	if actual := syslogParamName(`a b=c]"d` + strings.Repeat("x", 40)); actual != `a_b_c__d`+strings.Repeat("x", 24) {
+		t.Errorf("unexpected param name '%v'", actual)
+	}
+	if actual := syslogParamValue(`C:\dir "quoted" [x]`); actual != `C:\\dir \"quoted\" [x\]` {
+		t.Errorf("unexpected param value '%v'", actual)
+	}
+	if actual := syslogHeaderValue("", 10); actual != "-" {
+		t.Errorf("expected the nil value but got '%v'", actual)
+	}
+	if actual := syslogHeaderValue("my host é", 6); actual != "my_hos" {
+		t.Errorf("unexpected header value '%v'", actual)
+	}
+}
+
+func TestBuildSyslogMessage(t *testing.T) {
+	report := &GazeReport{
+		Ulid: "01BX5ZZKBKACTAV9WEVGEMMVRZ", Name: "backup", Hostname: "host1", Status: conf.StatusFailure,
+		ExitCode: 2, ExitDescription: "Execution failed with code 2", ElapsedSeconds: 1.5,
+		EndTime: time.Date(2026, 1, 2, 3, 4, 5, 600000000, time.UTC), Tags: []string{"a", "b"},
+		Metrics: map[string]float64{"rows": 3}, Fields: map[string]string{"db": `x"y`}, OutputTail: "last line\n",
+		Attempts: []*GazeAttempt{{Number: 1}},
+	}
+	expected := fmt.Sprintf(
+		`<75>1 2026-01-02T03:04:05.600000Z host1 gaze %d failure [gaze@32473 ulid="01BX5ZZKBKACTAV9WEVGEMMVRZ" `+
+			`name="backup" status="failure" exit_code="2" elapsed_seconds="1.5" tags="a,b" attempts="1" db="x\"y" rows="3"] `+
+			"backup failure: Execution failed with code 2\nlast line", os.Getpid(),
+	)
+	if actual := buildSyslogMessage(report, syslogFacilities["cron"], "gaze", true); actual != expected {
+		t.Errorf("expected:\n%v\nbut got:\n%v", expected, actual)
+	}
+}
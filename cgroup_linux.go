@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+// cpuMaxPeriod is the cpu.max period in microseconds that the configured number of cpus is scaled against
+const cpuMaxPeriod = 100000
+
+var cgroupNameCleaner = regexp.MustCompile("[^\\w\\-\\.]+")
+
+// transientCgroup is a cgroup v2 directory created for a single execution of the command
+type transientCgroup struct {
+	path          string
+	dir           *os.File
+	killLeftovers bool
+}
+
+func writeCgroupFile(cgroupPath, name, content string) error {
+	return ioutil.WriteFile(filepath.Join(cgroupPath, name), []byte(content), 0644)
+}
+
+// createTransientCgroup creates a new cgroup under the configured parent and applies the configured limits to it.
+func createTransientCgroup(config *conf.GazeCgroupConfig, name string) (*transientCgroup, error) {
+	if err := os.MkdirAll(config.Parent, 0755); err != nil {
+		return nil, fmt.Errorf("Could not create cgroup parent '%v': %v", config.Parent, err.Error())
+	}
+
+	// make sure the controllers we need are delegated to children of the parent
+	controllers := make([]string, 0)
+	if config.MemoryMax != nil {
+		controllers = append(controllers, "+memory")
+	}
+	if config.CPUMax != nil {
+		controllers = append(controllers, "+cpu")
+	}
+	if config.PidsMax != nil {
+		controllers = append(controllers, "+pids")
+	}
+	if len(controllers) > 0 {
+		if err := writeCgroupFile(config.Parent, "cgroup.subtree_control", strings.Join(controllers, " ")); err != nil {
+			// cgroup v2 does not allow a cgroup with member processes to delegate controllers to its children
+			if errors.Is(err, syscall.EBUSY) {
+				return nil, fmt.Errorf(
+					"Could not enable cgroup controllers %v: cgroup parent '%v' has processes in it, use a parent "+
+						"that only contains other cgroups", controllers, config.Parent,
+				)
+			}
+			return nil, fmt.Errorf("Could not enable cgroup controllers %v: %v", controllers, err.Error())
+		}
+	}
+
+	cgroupName := fmt.Sprintf("%v-%d-%d", cgroupNameCleaner.ReplaceAllString(name, "_"), os.Getpid(), time.Now().UnixNano())
+	cgroupPath := filepath.Join(config.Parent, cgroupName)
+	if err := os.Mkdir(cgroupPath, 0755); err != nil {
+		return nil, fmt.Errorf("Could not create cgroup '%v': %v", cgroupPath, err.Error())
+	}
+	cg := &transientCgroup{path: cgroupPath, killLeftovers: config.KillLeftovers}
+
+	var err error
+	if config.MemoryMax != nil {
+		err = writeCgroupFile(cgroupPath, "memory.max", strconv.FormatUint(uint64(*config.MemoryMax), 10))
+	}
+	if err == nil && config.CPUMax != nil {
+		quota := int64(*config.CPUMax * cpuMaxPeriod)
+		err = writeCgroupFile(cgroupPath, "cpu.max", fmt.Sprintf("%d %d", quota, cpuMaxPeriod))
+	}
+	if err == nil && config.PidsMax != nil {
+		err = writeCgroupFile(cgroupPath, "pids.max", strconv.FormatUint(*config.PidsMax, 10))
+	}
+	if err == nil {
+		cg.dir, err = os.Open(cgroupPath)
+	}
+	if err != nil {
+		cg.remove()
+		return nil, fmt.Errorf("Could not configure cgroup '%v': %v", cgroupPath, err.Error())
+	}
+	return cg, nil
+}
+
+// attach arranges for the command to be started directly inside the cgroup
+func (cg *transientCgroup) attach(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(cg.dir.Fd())
+}
+
+// readFlatKeyed reads cgroup files of the form "key value" per line
+func readFlatKeyed(path string) map[string]int64 {
+	output := make(map[string]int64)
+	f, err := os.Open(path)
+	if err != nil {
+		return output
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.Fields(scanner.Text())
+		if len(parts) == 2 {
+			if v, err := strconv.ParseInt(parts[1], 10, 64); err == nil {
+				output[parts[0]] = v
+			}
+		}
+	}
+	return output
+}
+
+// collect reads the usage statistics of the cgroup. Files that do not exist because a controller is not enabled are
+// skipped.
+func (cg *transientCgroup) collect() *GazeCgroupUsage {
+	output := new(GazeCgroupUsage)
+	if raw, err := ioutil.ReadFile(filepath.Join(cg.path, "memory.peak")); err == nil {
+		if v, err := strconv.ParseInt(strings.TrimSpace(string(raw)), 10, 64); err == nil {
+			output.MemoryPeakBytes = v
+		}
+	}
+	memoryEvents := readFlatKeyed(filepath.Join(cg.path, "memory.events"))
+	output.OOMKills = memoryEvents["oom_kill"]
+	pidsEvents := readFlatKeyed(filepath.Join(cg.path, "pids.events"))
+	output.PidsMaxEvents = pidsEvents["max"]
+	cpuStat := readFlatKeyed(filepath.Join(cg.path, "cpu.stat"))
+	output.CPUUsageSeconds = float64(cpuStat["usage_usec"]) / 1e6
+	output.CPUUserSeconds = float64(cpuStat["user_usec"]) / 1e6
+	output.CPUSystemSeconds = float64(cpuStat["system_usec"]) / 1e6
+	output.CPUThrottledSeconds = float64(cpuStat["throttled_usec"]) / 1e6
+	return output
+}
+
+// remove deletes the cgroup once the command has exited. Processes that the command left running keep the cgroup
+// busy, and they are only killed when kill_leftovers is set, otherwise the cgroup is left for them.
+func (cg *transientCgroup) remove() {
+	if cg.dir != nil {
+		cg.dir.Close()
+	}
+	err := syscall.Rmdir(cg.path)
+	if err == nil || os.IsNotExist(err) {
+		return
+	}
+	if !errors.Is(err, syscall.EBUSY) {
+		log.Warningf("Could not remove cgroup '%v': %v", cg.path, err.Error())
+		return
+	}
+	if !cg.killLeftovers {
+		log.Warningf("Processes are still running in cgroup '%v', leaving it in place", cg.path)
+		return
+	}
+	log.Warningf("Killing the processes still running in cgroup '%v'", cg.path)
+	if err := writeCgroupFile(cg.path, "cgroup.kill", "1"); err != nil && !os.IsNotExist(err) {
+		log.Warningf("Could not kill processes remaining in cgroup '%v': %v", cg.path, err.Error())
+	}
+	// the kill is asynchronous so the directory may take a moment to become removable
+	for i := 0; i < 50; i++ {
+		if err = syscall.Rmdir(cg.path); err == nil || os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	log.Warningf("Could not remove cgroup '%v': %v", cg.path, err.Error())
+}
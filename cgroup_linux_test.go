@@ -0,0 +1,69 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+func TestCreateTransientCgroupWritesLimits(t *testing.T) {
+	// a plain directory stands in for the cgroup filesystem, the kernel would otherwise create the interface files
+	parent := filepath.Join(t.TempDir(), "gaze")
+	memoryMax, cpuMax, pidsMax := conf.ByteSize(1<<30), 1.5, uint64(200)
+	config := &conf.GazeCgroupConfig{Parent: parent, MemoryMax: &memoryMax, CPUMax: &cpuMax, PidsMax: &pidsMax}
+	cg, err := createTransientCgroup(config, "nightly backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cg.dir.Close()
+	if !strings.HasPrefix(filepath.Base(cg.path), "nightly_backup-") || filepath.Dir(cg.path) != parent {
+		t.Errorf("unexpected cgroup path '%v'", cg.path)
+	}
+	for name, expected := range map[string]string{
+		filepath.Join(parent, "cgroup.subtree_control"): "+memory +cpu +pids",
+		filepath.Join(cg.path, "memory.max"):            "1073741824",
+		filepath.Join(cg.path, "cpu.max"):               "150000 100000",
+		filepath.Join(cg.path, "pids.max"):              "200",
+	} {
+		if raw, err := ioutil.ReadFile(name); err != nil || string(raw) != expected {
+			t.Errorf("expected %v to contain '%v' but got '%s' (%v)", name, expected, raw, err)
+		}
+	}
+}
+
+func TestTransientCgroupCollect(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"memory.peak":   "52428800\n",
+		"memory.events": "low 0\nhigh 0\nmax 3\noom 1\noom_kill 1\n",
+		"pids.events":   "max 2\n",
+		"cpu.stat":      "usage_usec 2500000\nuser_usec 2000000\nsystem_usec 500000\nthrottled_usec 1000000\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	usage := (&transientCgroup{path: dir}).collect()
+	expected := GazeCgroupUsage{
+		MemoryPeakBytes: 52428800, OOMKills: 1, PidsMaxEvents: 2,
+		CPUUsageSeconds: 2.5, CPUUserSeconds: 2, CPUSystemSeconds: 0.5, CPUThrottledSeconds: 1,
+	}
+	if *usage != expected {
+		t.Errorf("expected %+v but got %+v", expected, *usage)
+	}
+}
+
+func TestTransientCgroupRemove(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cg")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	(&transientCgroup{path: dir}).remove()
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("expected the empty cgroup to be removed but got %v", err)
+	}
+}
@@ -0,0 +1,27 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+type transientCgroup struct {
+	path string
+}
+
+func createTransientCgroup(config *conf.GazeCgroupConfig, name string) (*transientCgroup, error) {
+	return nil, fmt.Errorf("cgroups are only supported on linux")
+}
+
+func (cg *transientCgroup) attach(cmd *exec.Cmd) {}
+
+func (cg *transientCgroup) collect() *GazeCgroupUsage {
+	return nil
+}
+
+func (cg *transientCgroup) remove() {}
@@ -3,8 +3,16 @@ package conf
 import (
 	"fmt"
 	"io/ioutil"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
 
 	"reflect"
 
@@ -14,16 +22,273 @@ import (
 
 var log = logging.MustGetLogger("gaze.conf")
 
+// TemplateFuncs are the extra functions available in behaviour settings that are templated over the report
+var TemplateFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"date": func(layout string, t time.Time) string {
+		return t.Format(layout)
+	},
+}
+
 type GazeBehaviourConfig struct {
 	Type          string                 `yaml:"type"`
 	When          string                 `yaml:"when"`
 	IncludeOutput bool                   `yaml:"include_output"`
 	Settings      map[string]interface{} `yaml:"settings"`
+
+	// HeartbeatInterval causes in-progress reports to be sent to the behaviour while the command is running
+	HeartbeatInterval string        `yaml:"heartbeat_interval"`
+	HeartbeatDuration time.Duration `yaml:"-"`
+}
+
+// DefaultEmailSubject is the subject template used by the email behaviour when none is configured
+const DefaultEmailSubject = "[gaze] {{.Name}} {{.Status}} on {{.Hostname}}"
+
+// DefaultEmailBody is the body template used by the email behaviour when none is configured
+const DefaultEmailBody = `Task:        {{.Name}}
+Host:        {{.Hostname}}
+Status:      {{.Status}}
+Exit Code:   {{.ExitCode}}
+Description: {{.ExitDescription}}
+Command:     {{join .Command " "}}
+Start Time:  {{date "2006-01-02T15:04:05Z07:00" .StartTime}}
+End Time:    {{date "2006-01-02T15:04:05Z07:00" .EndTime}}
+Elapsed:     {{.ElapsedSeconds}}s
+Tags:        {{join .Tags ", "}}
+Ulid:        {{.Ulid}}
+{{if .OutputTail}}
+Output tail:
+{{.OutputTail}}{{end}}`
+
+// DefaultMetricPrefix is the prefix template used by the statsd and graphite behaviours when none is configured
+const DefaultMetricPrefix = "gaze.{{.Name}}"
+
+// DefaultElasticsearchIndex is the index template used by the elasticsearch behaviour, giving one index per day
+const DefaultElasticsearchIndex = `gaze-{{date "2006.01.02" .StartTime}}`
+
+// DefaultChatTitle is the title template used by the chat behaviour when none is configured
+const DefaultChatTitle = "{{.Name}} {{.Status}} on {{.Hostname}}"
+
+// DefaultAlertSummary is the summary template used by the alert behaviour when none is configured
+const DefaultAlertSummary = "{{.Name}} on {{.Hostname}}: {{.ExitDescription}}"
+
+// DefaultAlertDedupKey is the PagerDuty dedup key template, the same task on the same host always maps to one incident
+const DefaultAlertDedupKey = "gaze/{{.Hostname}}/{{.Name}}"
+
+// DefaultAlertExpiresAfter is how long a firing Alertmanager alert lasts without another run, long enough to outlast a
+// daily schedule
+const DefaultAlertExpiresAfter = "26h"
+
+// DefaultMQTTTopic, DefaultNATSSubject, and DefaultAMQPRoutingKey are the destination templates used by the message
+// queue behaviours when none are configured
+const (
+	DefaultMQTTTopic      = "gaze/{{.Name}}/{{.Status}}"
+	DefaultNATSSubject    = "gaze.{{.Name}}.{{.Status}}"
+	DefaultAMQPRoutingKey = "gaze.{{.Name}}.{{.Status}}"
+)
+
+// DefaultRedisKey is the hash key template used by the redis behaviour, holding the latest report of each task on each
+// host
+const DefaultRedisKey = "gaze:last:{{.Hostname}}:{{.Name}}"
+
+// DefaultS3Key is the object prefix template used by the s3 behaviour, grouping the uploads of each task by day
+const DefaultS3Key = `{{.Name}}/{{date "2006/01/02" .StartTime}}/{{.Ulid}}`
+
+// ByteSize is a number of bytes that can be written in the config either as a plain integer or as a string with a
+// K, M, G, or T suffix (powers of 1024)
+type ByteSize uint64
+
+// UnmarshalYAML parses both the integer and suffixed string forms
+func (b *ByteSize) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var n uint64
+	if err := unmarshal(&n); err == nil {
+		*b = ByteSize(n)
+		return nil
+	}
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	n, err := parseByteSize(s)
+	if err != nil {
+		return err
+	}
+	*b = ByteSize(n)
+	return nil
+}
+
+func parseByteSize(input string) (uint64, error) {
+	s := strings.ToUpper(strings.TrimSpace(input))
+	s = strings.TrimSuffix(s, "B")
+	multiplier := uint64(1)
+	if len(s) > 0 {
+		switch s[len(s)-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		case 'T':
+			multiplier = 1 << 40
+		}
+		if multiplier > 1 {
+			s = s[:len(s)-1]
+		}
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Could not parse byte size '%v'", input)
+	}
+	return n * multiplier, nil
+}
+
+// GazeLimitsConfig holds the niceness, io scheduling, and resource limits applied to the command before it is
+// executed. Nil fields are left as inherited from gaze.
+type GazeLimitsConfig struct {
+	Nice         *int      `yaml:"nice" json:"nice,omitempty"`
+	IOClass      string    `yaml:"io_class" json:"io_class,omitempty"`
+	IOLevel      *int      `yaml:"io_level" json:"io_level,omitempty"`
+	AddressSpace *ByteSize `yaml:"address_space" json:"address_space,omitempty"`
+	OpenFiles    *uint64   `yaml:"open_files" json:"open_files,omitempty"`
+	CPUSeconds   *uint64   `yaml:"cpu_seconds" json:"cpu_seconds,omitempty"`
+	CoreSize     *ByteSize `yaml:"core_size" json:"core_size,omitempty"`
+}
+
+// GazeCgroupConfig controls the transient cgroup v2 that the command is placed in. Nil limits are left unset.
+type GazeCgroupConfig struct {
+	Parent        string    `yaml:"parent" json:"parent,omitempty"`
+	MemoryMax     *ByteSize `yaml:"memory_max" json:"memory_max,omitempty"`
+	CPUMax        *float64  `yaml:"cpu_max" json:"cpu_max,omitempty"`
+	PidsMax       *uint64   `yaml:"pids_max" json:"pids_max,omitempty"`
+	KillLeftovers bool      `yaml:"kill_leftovers" json:"kill_leftovers,omitempty"`
+}
+
+// GazeRetriesConfig controls re-running of the command when it fails. If neither exit codes nor output patterns are
+// given then every failure is retried.
+type GazeRetriesConfig struct {
+	Count          int      `yaml:"count"`
+	Delay          string   `yaml:"delay"`
+	Backoff        float64  `yaml:"backoff"`
+	MaxDelay       string   `yaml:"max_delay"`
+	ExitCodes      []int    `yaml:"exit_codes"`
+	OutputPatterns []string `yaml:"output_patterns"`
+
+	DelayDuration    time.Duration    `yaml:"-"`
+	MaxDelayDuration time.Duration    `yaml:"-"`
+	OutputRegexes    []*regexp.Regexp `yaml:"-" json:"-"`
+}
+
+// The statuses that an execution can be mapped to
+const (
+	StatusSuccess = "success"
+	StatusWarning = "warning"
+	StatusFailure = "failure"
+	// StatusRunning is only used for in-progress reports
+	StatusRunning = "running"
+)
+
+// GazeStatusRule maps an inclusive range of exit codes to a status
+type GazeStatusRule struct {
+	Low    int
+	High   int
+	Status string
+}
+
+// GazeExtractorConfig describes how to pull metrics and fields out of the captured output. The type is one of
+// regex (named capture groups), json (lines that are json objects), or logfmt (key=value pairs).
+type GazeExtractorConfig struct {
+	Type    string         `yaml:"type"`
+	Pattern string         `yaml:"pattern"`
+	Prefix  string         `yaml:"prefix"`
+	Regex   *regexp.Regexp `yaml:"-" json:"-"`
+}
+
+// GazeTaskConfig holds overrides that apply only to the task with the matching name
+type GazeTaskConfig struct {
+	StatusMap   map[string]string `yaml:"status_map"`
+	StatusRules []*GazeStatusRule `yaml:"-" json:"-"`
+
+	// output assertions that turn an otherwise successful execution into a failure
+	FailIfOutputMatches  []string         `yaml:"fail_if_output_matches"`
+	RequireOutputMatches []string         `yaml:"require_output_matches"`
+	FailIfOutputEmpty    bool             `yaml:"fail_if_output_empty"`
+	FailIfStderrNonEmpty bool             `yaml:"fail_if_stderr_nonempty"`
+	FailIfOutputRegexes  []*regexp.Regexp `yaml:"-" json:"-"`
+	RequireOutputRegexes []*regexp.Regexp `yaml:"-" json:"-"`
+
+	Extractors []*GazeExtractorConfig `yaml:"extractors"`
 }
 
 type GazeConfig struct {
 	Behaviours map[string]*GazeBehaviourConfig `yaml:"behaviours"`
 	Tags       []string                        `yaml:"tags"`
+	Limits     *GazeLimitsConfig               `yaml:"limits"`
+	Cgroup     *GazeCgroupConfig               `yaml:"cgroup"`
+
+	// Splay is the maximum random delay before the command is started
+	Splay               string        `yaml:"splay"`
+	SplayDuration       time.Duration `yaml:"-"`
+	SplayHostnameSeeded bool          `yaml:"splay_hostname_seeded"`
+
+	Retries *GazeRetriesConfig `yaml:"retries"`
+
+	StatusMap   map[string]string          `yaml:"status_map"`
+	StatusRules []*GazeStatusRule          `yaml:"-" json:"-"`
+	Tasks       map[string]*GazeTaskConfig `yaml:"tasks"`
+
+	Extractors []*GazeExtractorConfig `yaml:"extractors"`
+}
+
+// ExtractorsFor returns the global extractors followed by any for the named task
+func (c *GazeConfig) ExtractorsFor(name string) []*GazeExtractorConfig {
+	output := make([]*GazeExtractorConfig, 0)
+	if c != nil {
+		output = append(output, c.Extractors...)
+	}
+	if task := c.Task(name); task != nil {
+		output = append(output, task.Extractors...)
+	}
+	return output
+}
+
+// Task returns the overrides for the named task or nil if there are none
+func (c *GazeConfig) Task(name string) *GazeTaskConfig {
+	if c == nil {
+		return nil
+	}
+	return c.Tasks[name]
+}
+
+func matchStatusRules(rules []*GazeStatusRule, exitCode int) (string, bool) {
+	// rules are sorted from narrowest to widest so the most specific match wins
+	for _, r := range rules {
+		if exitCode >= r.Low && exitCode <= r.High {
+			return r.Status, true
+		}
+	}
+	return "", false
+}
+
+// StatusForExitCode maps an exit code to a status using the task overrides first, then the global status map, and
+// finally the default of 0 being a success and everything else a failure.
+func (c *GazeConfig) StatusForExitCode(name string, exitCode int) string {
+	if task := c.Task(name); task != nil {
+		if status, ok := matchStatusRules(task.StatusRules, exitCode); ok {
+			return status
+		}
+	}
+	if c != nil {
+		if status, ok := matchStatusRules(c.StatusRules, exitCode); ok {
+			return status
+		}
+	}
+	if exitCode == 0 {
+		return StatusSuccess
+	}
+	return StatusFailure
 }
 
 // Load the config information from the file on disk
@@ -91,7 +356,8 @@ func GenerateExample() *GazeConfig {
 	return &output
 }
 
-func stringIn(containee string, container *[]string) bool {
+// StringIn checks whether the string is one of the given strings
+func StringIn(containee string, container *[]string) bool {
 	for _, s := range *container {
 		if s == containee {
 			return true
@@ -130,7 +396,7 @@ func validateStringSettingAllowed(input *GazeBehaviourConfig, name string, allow
 	if err := validateStringSetting(input, name); err != nil {
 		return err
 	}
-	if !stringIn(input.Settings[name].(string), allowed) {
+	if !StringIn(input.Settings[name].(string), allowed) {
 		return fmt.Errorf("Behaviour of type '%v' setting '%v' must be one of '%v'", input.Type, name, &allowed)
 	}
 	return nil
@@ -140,12 +406,111 @@ func validateStringSettingWithDefaultAllowed(input *GazeBehaviourConfig, name st
 	if err := validateStringSettingWithDefault(input, name, defaultValue); err != nil {
 		return err
 	}
-	if !stringIn(input.Settings[name].(string), allowed) {
+	if !StringIn(input.Settings[name].(string), allowed) {
 		return fmt.Errorf("Behaviour of type '%v' setting '%v' must be one of '%v'", input.Type, name, &allowed)
 	}
 	return nil
 }
 
+func validateBoolSettingWithDefault(input *GazeBehaviourConfig, name string, defaultValue bool) error {
+	v, ok := input.Settings[name]
+	if ok {
+		b, ok := v.(bool)
+		if ok {
+			input.Settings[name] = b
+			return nil
+		}
+		return fmt.Errorf("Behaviour of type '%v' setting '%v' must be true or false", input.Type, name)
+	}
+	input.Settings[name] = defaultValue
+	return nil
+}
+
+func validateIntSettingWithDefault(input *GazeBehaviourConfig, name string, defaultValue int) error {
+	v, ok := input.Settings[name]
+	if ok {
+		i, ok := v.(int)
+		if ok {
+			input.Settings[name] = i
+			return nil
+		}
+		return fmt.Errorf("Behaviour of type '%v' setting '%v' must be an integer", input.Type, name)
+	}
+	input.Settings[name] = defaultValue
+	return nil
+}
+
+// validateStringListSetting converts a required list of strings, a single string is treated as a list of one
+func validateStringListSetting(input *GazeBehaviourConfig, name string) error {
+	v, ok := input.Settings[name]
+	if !ok {
+		return fmt.Errorf("Behaviour of type '%v' must have a '%v' list", input.Type, name)
+	}
+	if s, ok := v.(string); ok {
+		input.Settings[name] = []string{s}
+		return nil
+	}
+	raw, ok := v.([]interface{})
+	if !ok || len(raw) == 0 {
+		return fmt.Errorf("Behaviour of type '%v' setting '%v' must be a list of strings", input.Type, name)
+	}
+	converted := make([]string, len(raw))
+	for i, r := range raw {
+		if converted[i], ok = r.(string); !ok {
+			return fmt.Errorf("Behaviour of type '%v' setting '%v' must contain only strings", input.Type, name)
+		}
+	}
+	input.Settings[name] = converted
+	return nil
+}
+
+// validateStringMapSettingWithDefault converts an optional map of strings, defaulting to an empty map
+func validateStringMapSettingWithDefault(input *GazeBehaviourConfig, name string) error {
+	v, ok := input.Settings[name]
+	if !ok {
+		input.Settings[name] = make(map[string]string)
+		return nil
+	}
+	raw, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return fmt.Errorf("Behaviour of type '%v' setting '%v' must be a map of strings", input.Type, name)
+	}
+	converted := make(map[string]string)
+	for k, v := range raw {
+		kv, kok := k.(string)
+		vv, vok := v.(string)
+		if !kok || !vok {
+			return fmt.Errorf("Behaviour of type '%v' setting '%v' can only contain string-string pairs", input.Type, name)
+		}
+		converted[kv] = vv
+	}
+	input.Settings[name] = converted
+	return nil
+}
+
+// validateTemplateSettingWithDefault checks that the setting is a valid template over the report fields
+func validateTemplateSettingWithDefault(input *GazeBehaviourConfig, name string, defaultValue string) error {
+	if err := validateStringSettingWithDefault(input, name, defaultValue); err != nil {
+		return err
+	}
+	if _, err := template.New(name).Funcs(TemplateFuncs).Parse(input.Settings[name].(string)); err != nil {
+		return fmt.Errorf("Behaviour of type '%v' setting '%v' is not a valid template: %v", input.Type, name, err.Error())
+	}
+	return nil
+}
+
+// validateAddressSettingWithDefaultPort checks a required host:port setting, adding the default port when missing
+func validateAddressSettingWithDefaultPort(input *GazeBehaviourConfig, name string, defaultPort string) error {
+	if err := validateStringSetting(input, name); err != nil {
+		return err
+	}
+	address := input.Settings[name].(string)
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		input.Settings[name] = net.JoinHostPort(address, defaultPort)
+	}
+	return nil
+}
+
 func ValidateGazeCommandBehaviour(input *GazeBehaviourConfig) error {
 	if err := validateStringSetting(input, "command"); err != nil {
 		return err
@@ -211,21 +576,697 @@ func ValidateGazeWebBehaviour(input *GazeBehaviourConfig) error {
 	return nil
 }
 
+func ValidateGazePingBehaviour(input *GazeBehaviourConfig) error {
+	if err := validateStringSetting(input, "base_url"); err != nil {
+		return err
+	}
+	input.Settings["base_url"] = strings.TrimSuffix(input.Settings["base_url"].(string), "/")
+	for _, name := range []string{"send_start", "use_exit_code", "run_id"} {
+		if err := validateBoolSettingWithDefault(input, name, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ValidateGazeEmailBehaviour(input *GazeBehaviourConfig) error {
+	if err := validateStringSetting(input, "host"); err != nil {
+		return err
+	}
+	validTLS := []string{"starttls", "tls", "none"}
+	if err := validateStringSettingWithDefaultAllowed(input, "tls", "starttls", &validTLS); err != nil {
+		return err
+	}
+	defaultPorts := map[string]int{"starttls": 587, "tls": 465, "none": 25}
+	if err := validateIntSettingWithDefault(input, "port", defaultPorts[input.Settings["tls"].(string)]); err != nil {
+		return err
+	}
+	validAuths := []string{"plain", "login"}
+	if err := validateStringSettingWithDefaultAllowed(input, "auth", "plain", &validAuths); err != nil {
+		return err
+	}
+	for _, name := range []string{"username", "password"} {
+		if err := validateStringSettingWithDefault(input, name, ""); err != nil {
+			return err
+		}
+	}
+	if err := validateStringSetting(input, "from"); err != nil {
+		return err
+	}
+	if err := validateStringListSetting(input, "to"); err != nil {
+		return err
+	}
+	if err := validateTemplateSettingWithDefault(input, "subject", DefaultEmailSubject); err != nil {
+		return err
+	}
+	if err := validateTemplateSettingWithDefault(input, "body", DefaultEmailBody); err != nil {
+		return err
+	}
+	for _, name := range []string{"attach_output", "insecure_skip_verify"} {
+		if err := validateBoolSettingWithDefault(input, name, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ValidateGazeSyslogBehaviour(input *GazeBehaviourConfig) error {
+	validNetworks := []string{"unix", "udp", "tcp"}
+	if err := validateStringSettingWithDefaultAllowed(input, "network", "unix", &validNetworks); err != nil {
+		return err
+	}
+	if input.Settings["network"] == "unix" {
+		if err := validateStringSettingWithDefault(input, "address", "/dev/log"); err != nil {
+			return err
+		}
+	} else if err := validateAddressSettingWithDefaultPort(input, "address", "514"); err != nil {
+		return err
+	}
+	validFacilities := []string{
+		"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news", "uucp", "cron", "authpriv", "ftp",
+		"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+	}
+	if err := validateStringSettingWithDefaultAllowed(input, "facility", "user", &validFacilities); err != nil {
+		return err
+	}
+	return validateStringSettingWithDefault(input, "app_name", "gaze")
+}
+
+func ValidateGazeJournaldBehaviour(input *GazeBehaviourConfig) error {
+	if err := validateStringSettingWithDefault(input, "socket", "/run/systemd/journal/socket"); err != nil {
+		return err
+	}
+	return validateStringSettingWithDefault(input, "identifier", "gaze")
+}
+
+func ValidateGazeStatsdBehaviour(input *GazeBehaviourConfig) error {
+	if _, ok := input.Settings["address"]; !ok {
+		input.Settings["address"] = "127.0.0.1"
+	}
+	if err := validateAddressSettingWithDefaultPort(input, "address", "8125"); err != nil {
+		return err
+	}
+	if err := validateTemplateSettingWithDefault(input, "prefix", DefaultMetricPrefix); err != nil {
+		return err
+	}
+	if err := validateBoolSettingWithDefault(input, "tags", true); err != nil {
+		return err
+	}
+	if err := validateIntSettingWithDefault(input, "max_packet_size", 1432); err != nil {
+		return err
+	}
+	if input.Settings["max_packet_size"].(int) < 64 {
+		return fmt.Errorf("Behaviour of type '%v' setting 'max_packet_size' must be at least 64", input.Type)
+	}
+	return nil
+}
+
+func ValidateGazeGraphiteBehaviour(input *GazeBehaviourConfig) error {
+	if err := validateAddressSettingWithDefaultPort(input, "address", "2003"); err != nil {
+		return err
+	}
+	return validateTemplateSettingWithDefault(input, "prefix", DefaultMetricPrefix)
+}
+
+func ValidateGazePrometheusTextfileBehaviour(input *GazeBehaviourConfig) error {
+	if err := validateStringSetting(input, "directory"); err != nil {
+		return err
+	}
+	// an empty filename is derived from the task name when the behaviour runs
+	if err := validateStringSettingWithDefault(input, "filename", ""); err != nil {
+		return err
+	}
+	filename := input.Settings["filename"].(string)
+	if filename != "" && (!strings.HasSuffix(filename, ".prom") || strings.ContainsRune(filename, '/')) {
+		return fmt.Errorf("Behaviour of type '%v' setting 'filename' must be a file name ending in '.prom'", input.Type)
+	}
+	return nil
+}
+
+func ValidateGazePushgatewayBehaviour(input *GazeBehaviourConfig) error {
+	if err := validateStringSetting(input, "url"); err != nil {
+		return err
+	}
+	input.Settings["url"] = strings.TrimSuffix(input.Settings["url"].(string), "/")
+	for _, name := range []string{"username", "password"} {
+		if err := validateStringSettingWithDefault(input, name, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ValidateGazeInfluxBehaviour(input *GazeBehaviourConfig) error {
+	validAPIs := []string{"v1", "v2", "udp"}
+	if err := validateStringSettingWithDefaultAllowed(input, "api", "v2", &validAPIs); err != nil {
+		return err
+	}
+	api := input.Settings["api"].(string)
+	if api == "udp" {
+		if err := validateAddressSettingWithDefaultPort(input, "address", "8089"); err != nil {
+			return err
+		}
+	} else {
+		if err := validateStringSetting(input, "url"); err != nil {
+			return err
+		}
+		input.Settings["url"] = strings.TrimSuffix(input.Settings["url"].(string), "/")
+	}
+	required := map[string][]string{"v1": {"database"}, "v2": {"org", "bucket"}}
+	for _, name := range required[api] {
+		if err := validateStringSetting(input, name); err != nil {
+			return err
+		}
+	}
+	for _, name := range []string{"retention_policy", "token", "username", "password"} {
+		if err := validateStringSettingWithDefault(input, name, ""); err != nil {
+			return err
+		}
+	}
+	validPrecisions := []string{"ns", "us", "ms", "s"}
+	if err := validateStringSettingWithDefaultAllowed(input, "precision", "s", &validPrecisions); err != nil {
+		return err
+	}
+	return validateStringSettingWithDefault(input, "measurement", "gaze")
+}
+
+func ValidateGazeOTLPBehaviour(input *GazeBehaviourConfig) error {
+	if err := validateStringSettingWithDefault(input, "url", "http://localhost:4318"); err != nil {
+		return err
+	}
+	input.Settings["url"] = strings.TrimSuffix(input.Settings["url"].(string), "/")
+	validProtocols := []string{"protobuf", "json"}
+	if err := validateStringSettingWithDefaultAllowed(input, "protocol", "protobuf", &validProtocols); err != nil {
+		return err
+	}
+	if err := validateStringMapSettingWithDefault(input, "headers"); err != nil {
+		return err
+	}
+	if err := validateBoolSettingWithDefault(input, "metrics", false); err != nil {
+		return err
+	}
+	return validateStringSettingWithDefault(input, "service_name", "gaze")
+}
+
+func ValidateGazeLokiBehaviour(input *GazeBehaviourConfig) error {
+	if err := validateStringSetting(input, "url"); err != nil {
+		return err
+	}
+	input.Settings["url"] = strings.TrimSuffix(input.Settings["url"].(string), "/")
+	for _, name := range []string{"tenant_id", "username", "password"} {
+		if err := validateStringSettingWithDefault(input, name, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ValidateGazeElasticsearchBehaviour(input *GazeBehaviourConfig) error {
+	if err := validateStringSetting(input, "url"); err != nil {
+		return err
+	}
+	input.Settings["url"] = strings.TrimSuffix(input.Settings["url"].(string), "/")
+	if err := validateTemplateSettingWithDefault(input, "index", DefaultElasticsearchIndex); err != nil {
+		return err
+	}
+	for _, name := range []string{"api_key", "username", "password"} {
+		if err := validateStringSettingWithDefault(input, name, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ValidateGazeGELFBehaviour(input *GazeBehaviourConfig) error {
+	validNetworks := []string{"udp", "tcp"}
+	if err := validateStringSettingWithDefaultAllowed(input, "network", "udp", &validNetworks); err != nil {
+		return err
+	}
+	if err := validateAddressSettingWithDefaultPort(input, "address", "12201"); err != nil {
+		return err
+	}
+	if err := validateBoolSettingWithDefault(input, "compress", true); err != nil {
+		return err
+	}
+	if err := validateIntSettingWithDefault(input, "chunk_size", 1420); err != nil {
+		return err
+	}
+	if input.Settings["chunk_size"].(int) < 64 {
+		return fmt.Errorf("Behaviour of type '%v' setting 'chunk_size' must be at least 64", input.Type)
+	}
+	return nil
+}
+
+func ValidateGazeChatBehaviour(input *GazeBehaviourConfig) error {
+	validFlavours := []string{"slack", "mattermost", "discord", "teams", "ntfy"}
+	if err := validateStringSettingAllowed(input, "flavour", &validFlavours); err != nil {
+		return err
+	}
+	if err := validateStringSetting(input, "url"); err != nil {
+		return err
+	}
+	if err := validateTemplateSettingWithDefault(input, "title", DefaultChatTitle); err != nil {
+		return err
+	}
+	validCards := []string{"adaptive_card", "message_card"}
+	if err := validateStringSettingWithDefaultAllowed(input, "card", "adaptive_card", &validCards); err != nil {
+		return err
+	}
+	for _, name := range []string{"username", "token"} {
+		if err := validateStringSettingWithDefault(input, name, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ValidateGazeAlertBehaviour(input *GazeBehaviourConfig) error {
+	// the alert resolves itself on the next good run, which never happens if it only runs for some statuses
+	if input.When != "always" {
+		return fmt.Errorf("Behaviour of type '%v' must have a 'when' of always so that it can resolve the alert", input.Type)
+	}
+	validServices := []string{"pagerduty", "alertmanager"}
+	if err := validateStringSettingAllowed(input, "service", &validServices); err != nil {
+		return err
+	}
+	if input.Settings["service"] == "pagerduty" {
+		if err := validateStringSettingWithDefault(input, "url", "https://events.pagerduty.com/v2/enqueue"); err != nil {
+			return err
+		}
+		if err := validateStringSetting(input, "routing_key"); err != nil {
+			return err
+		}
+		if err := validateTemplateSettingWithDefault(input, "dedup_key", DefaultAlertDedupKey); err != nil {
+			return err
+		}
+		validSeverities := []string{"critical", "error", "warning", "info"}
+		if err := validateStringSettingWithDefaultAllowed(input, "severity", "error", &validSeverities); err != nil {
+			return err
+		}
+	} else {
+		if err := validateStringSetting(input, "url"); err != nil {
+			return err
+		}
+		input.Settings["url"] = strings.TrimSuffix(input.Settings["url"].(string), "/")
+		if err := validateStringSettingWithDefault(input, "alert_name", "GazeTaskFailed"); err != nil {
+			return err
+		}
+		if err := validateStringSettingWithDefault(input, "severity", "error"); err != nil {
+			return err
+		}
+		// firing alerts always get an end time since alertmanager resolves alerts without one after its resolve_timeout
+		if err := validateStringSettingWithDefault(input, "expires_after", DefaultAlertExpiresAfter); err != nil {
+			return err
+		}
+		d, err := time.ParseDuration(input.Settings["expires_after"].(string))
+		if err != nil || d <= 0 {
+			return fmt.Errorf("Behaviour of type '%v' setting 'expires_after' must be a positive duration", input.Type)
+		}
+		input.Settings["expires_after"] = d
+	}
+	if err := validateTemplateSettingWithDefault(input, "summary", DefaultAlertSummary); err != nil {
+		return err
+	}
+	if err := validateBoolSettingWithDefault(input, "trigger_on_warning", false); err != nil {
+		return err
+	}
+	for _, name := range []string{"username", "password"} {
+		if err := validateStringSettingWithDefault(input, name, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateBrokerSettings checks the connection settings shared by the message queue behaviours, the port of the
+// address defaults to the plain or tls port of the protocol
+func validateBrokerSettings(input *GazeBehaviourConfig, plainPort string, tlsPort string) error {
+	for _, name := range []string{"tls", "insecure_skip_verify"} {
+		if err := validateBoolSettingWithDefault(input, name, false); err != nil {
+			return err
+		}
+	}
+	defaultPort := plainPort
+	if input.Settings["tls"].(bool) {
+		defaultPort = tlsPort
+	}
+	return validateAddressSettingWithDefaultPort(input, "address", defaultPort)
+}
+
+func ValidateGazeMQTTBehaviour(input *GazeBehaviourConfig) error {
+	if err := validateBrokerSettings(input, "1883", "8883"); err != nil {
+		return err
+	}
+	if err := validateTemplateSettingWithDefault(input, "topic", DefaultMQTTTopic); err != nil {
+		return err
+	}
+	if err := validateIntSettingWithDefault(input, "qos", 0); err != nil {
+		return err
+	}
+	if qos := input.Settings["qos"].(int); qos < 0 || qos > 2 {
+		return fmt.Errorf("Behaviour of type '%v' setting 'qos' must be 0, 1, or 2", input.Type)
+	}
+	if err := validateBoolSettingWithDefault(input, "retain", false); err != nil {
+		return err
+	}
+	for _, name := range []string{"username", "password", "client_id"} {
+		if err := validateStringSettingWithDefault(input, name, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ValidateGazeNATSBehaviour(input *GazeBehaviourConfig) error {
+	if err := validateBrokerSettings(input, "4222", "4222"); err != nil {
+		return err
+	}
+	if err := validateTemplateSettingWithDefault(input, "subject", DefaultNATSSubject); err != nil {
+		return err
+	}
+	for _, name := range []string{"username", "password", "token"} {
+		if err := validateStringSettingWithDefault(input, name, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ValidateGazeAMQPBehaviour(input *GazeBehaviourConfig) error {
+	if err := validateBrokerSettings(input, "5672", "5671"); err != nil {
+		return err
+	}
+	if err := validateStringSettingWithDefault(input, "exchange", "amq.topic"); err != nil {
+		return err
+	}
+	if err := validateTemplateSettingWithDefault(input, "routing_key", DefaultAMQPRoutingKey); err != nil {
+		return err
+	}
+	if err := validateStringSettingWithDefault(input, "vhost", "/"); err != nil {
+		return err
+	}
+	for _, name := range []string{"username", "password"} {
+		if err := validateStringSettingWithDefault(input, name, "guest"); err != nil {
+			return err
+		}
+	}
+	return validateBoolSettingWithDefault(input, "persistent", true)
+}
+
+func ValidateGazeRedisBehaviour(input *GazeBehaviourConfig) error {
+	if _, ok := input.Settings["address"]; !ok {
+		input.Settings["address"] = "127.0.0.1"
+	}
+	if err := validateBrokerSettings(input, "6379", "6379"); err != nil {
+		return err
+	}
+	if err := validateTemplateSettingWithDefault(input, "key", DefaultRedisKey); err != nil {
+		return err
+	}
+	// the ttl is kept as a duration where 0 keeps the hash forever, yaml reads a bare number such as 0 or 3600 as an
+	// integer which is taken as seconds
+	if seconds, ok := input.Settings["ttl"].(int); ok {
+		input.Settings["ttl"] = strconv.Itoa(seconds) + "s"
+	}
+	if err := validateStringSettingWithDefault(input, "ttl", "168h"); err != nil {
+		return err
+	}
+	if raw := input.Settings["ttl"].(string); raw == "0" || raw == "" {
+		input.Settings["ttl"] = time.Duration(0)
+	} else if d, err := time.ParseDuration(raw); err == nil && (d == 0 || d >= time.Second) {
+		input.Settings["ttl"] = d
+	} else {
+		return fmt.Errorf("Behaviour of type '%v' setting 'ttl' must be 0 or a duration of at least 1s, like 1h", input.Type)
+	}
+	if err := validateStringSettingWithDefault(input, "stream", "gaze:runs"); err != nil {
+		return err
+	}
+	if err := validateIntSettingWithDefault(input, "stream_max_len", 10000); err != nil {
+		return err
+	}
+	for _, name := range []string{"channel", "username", "password"} {
+		if err := validateStringSettingWithDefault(input, name, ""); err != nil {
+			return err
+		}
+	}
+	return validateIntSettingWithDefault(input, "db", 0)
+}
+
+func ValidateGazeS3Behaviour(input *GazeBehaviourConfig) error {
+	if err := validateStringSetting(input, "bucket"); err != nil {
+		return err
+	}
+	if err := validateStringSettingWithDefault(input, "region", "us-east-1"); err != nil {
+		return err
+	}
+	region := input.Settings["region"].(string)
+	if err := validateStringSettingWithDefault(input, "endpoint", "https://s3."+region+".amazonaws.com"); err != nil {
+		return err
+	}
+	endpoint, err := url.Parse(input.Settings["endpoint"].(string))
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return fmt.Errorf("Behaviour of type '%v' setting 'endpoint' must be an http or https url", input.Type)
+	}
+	if err := validateBoolSettingWithDefault(input, "path_style", false); err != nil {
+		return err
+	}
+	if err := validateTemplateSettingWithDefault(input, "key", DefaultS3Key); err != nil {
+		return err
+	}
+	for _, name := range []string{"access_key", "secret_key", "session_token"} {
+		if err := validateStringSettingWithDefault(input, name, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateLimits checks the ranges of the niceness and io scheduling settings
+func ValidateLimits(input *GazeLimitsConfig) error {
+	if input.Nice != nil && (*input.Nice < -20 || *input.Nice > 19) {
+		return fmt.Errorf("Limits 'nice' must be between -20 and 19")
+	}
+	validIOClasses := []string{"", "realtime", "best-effort", "idle"}
+	if !StringIn(input.IOClass, &validIOClasses) {
+		return fmt.Errorf("Limits 'io_class' must be one of %v", validIOClasses[1:])
+	}
+	if input.IOLevel != nil {
+		if input.IOClass == "" || input.IOClass == "idle" {
+			return fmt.Errorf("Limits 'io_level' requires an 'io_class' of realtime or best-effort")
+		}
+		if *input.IOLevel < 0 || *input.IOLevel > 7 {
+			return fmt.Errorf("Limits 'io_level' must be between 0 and 7")
+		}
+	}
+	return nil
+}
+
+// ValidateCgroup checks the cgroup limits and fills in the default parent
+func ValidateCgroup(input *GazeCgroupConfig) error {
+	if input.Parent == "" {
+		input.Parent = "/sys/fs/cgroup/gaze"
+	}
+	if !filepath.IsAbs(input.Parent) {
+		return fmt.Errorf("Cgroup 'parent' must be an absolute path")
+	}
+	// the kernel rejects a cpu.max quota below 1000us, which is 0.01 cpus at the 100000us period gaze uses
+	if input.CPUMax != nil && *input.CPUMax < 0.01 {
+		return fmt.Errorf("Cgroup 'cpu_max' must be at least 0.01 cpus")
+	}
+	if input.PidsMax != nil && *input.PidsMax == 0 {
+		return fmt.Errorf("Cgroup 'pids_max' must be greater than 0")
+	}
+	return nil
+}
+
+// ValidateRetries parses the retry durations and patterns and fills in defaults
+func ValidateRetries(input *GazeRetriesConfig) error {
+	if input.Count < 0 {
+		return fmt.Errorf("Retries 'count' must not be negative")
+	}
+	if input.Delay == "" {
+		input.Delay = "10s"
+	}
+	d, err := time.ParseDuration(input.Delay)
+	if err != nil || d < 0 {
+		return fmt.Errorf("Retries 'delay' must be a positive duration like 30s or 10m")
+	}
+	input.DelayDuration = d
+	if input.MaxDelay != "" {
+		d, err = time.ParseDuration(input.MaxDelay)
+		if err != nil || d < 0 {
+			return fmt.Errorf("Retries 'max_delay' must be a positive duration like 30s or 10m")
+		}
+		input.MaxDelayDuration = d
+	}
+	if input.Backoff == 0 {
+		input.Backoff = 1
+	} else if input.Backoff < 1 {
+		return fmt.Errorf("Retries 'backoff' must be at least 1")
+	}
+	if input.OutputRegexes, err = compileRegexes("output_patterns", input.OutputPatterns); err != nil {
+		return fmt.Errorf("Retries %v", err.Error())
+	}
+	return nil
+}
+
+// statusMapKeyPattern matches an exit code or an inclusive range of exit codes, either of which may be negative
+var statusMapKeyPattern = regexp.MustCompile(`^\s*(-?\d+)\s*(?:-\s*(-?\d+)\s*)?$`)
+
+// parseStatusMap converts a map of exit codes or ranges like "3-7" into rules sorted from narrowest to widest
+func parseStatusMap(input map[string]string) ([]*GazeStatusRule, error) {
+	validStatuses := []string{StatusSuccess, StatusWarning, StatusFailure}
+	output := make([]*GazeStatusRule, 0, len(input))
+	for codes, status := range input {
+		if !StringIn(status, &validStatuses) {
+			return nil, fmt.Errorf("Status map value for '%v' must be one of %v", codes, validStatuses)
+		}
+		match := statusMapKeyPattern.FindStringSubmatch(codes)
+		if match == nil {
+			return nil, fmt.Errorf("Status map key '%v' must be an exit code or a range like 3-7", codes)
+		}
+		low, err := strconv.Atoi(match[1])
+		high := low
+		if err == nil && match[2] != "" {
+			high, err = strconv.Atoi(match[2])
+		}
+		if err != nil || high < low {
+			return nil, fmt.Errorf("Status map key '%v' must be an exit code or a range like 3-7", codes)
+		}
+		output = append(output, &GazeStatusRule{Low: low, High: high, Status: status})
+	}
+	sort.Slice(output, func(i, j int) bool {
+		wi, wj := output[i].High-output[i].Low, output[j].High-output[j].Low
+		if wi != wj {
+			return wi < wj
+		}
+		return output[i].Low < output[j].Low
+	})
+	return output, nil
+}
+
+func compileRegexes(setting string, patterns []string) ([]*regexp.Regexp, error) {
+	output := make([]*regexp.Regexp, len(patterns))
+	for i, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("'%v' pattern '%v' is not a valid regex: %v", setting, p, err.Error())
+		}
+		output[i] = re
+	}
+	return output, nil
+}
+
+// ValidateExtractors checks the type of each extractor and compiles the regex patterns
+func ValidateExtractors(input []*GazeExtractorConfig) error {
+	validTypes := []string{"regex", "json", "logfmt"}
+	for _, e := range input {
+		if e == nil || !StringIn(e.Type, &validTypes) {
+			return fmt.Errorf("Extractor 'type' must be one of %v", validTypes)
+		}
+		if e.Type != "regex" {
+			continue
+		}
+		re, err := regexp.Compile(e.Pattern)
+		if err != nil {
+			return fmt.Errorf("Extractor pattern '%v' is not a valid regex: %v", e.Pattern, err.Error())
+		}
+		named := false
+		for _, n := range re.SubexpNames() {
+			named = named || n != ""
+		}
+		if !named {
+			return fmt.Errorf("Extractor pattern '%v' must contain named capture groups like (?P<name>...)", e.Pattern)
+		}
+		e.Regex = re
+	}
+	return nil
+}
+
+// ValidateTask checks the overrides for a single task
+func ValidateTask(input *GazeTaskConfig) error {
+	rules, err := parseStatusMap(input.StatusMap)
+	if err != nil {
+		return err
+	}
+	input.StatusRules = rules
+	if input.FailIfOutputRegexes, err = compileRegexes("fail_if_output_matches", input.FailIfOutputMatches); err != nil {
+		return err
+	}
+	if input.RequireOutputRegexes, err = compileRegexes("require_output_matches", input.RequireOutputMatches); err != nil {
+		return err
+	}
+	return ValidateExtractors(input.Extractors)
+}
+
 // ValidateAndClean a config that has already been loaded
 func ValidateAndClean(cfg *GazeConfig) error {
-	validTypes := []string{"logfile", "command", "web"}
-	validWhens := []string{"always", "failures", "successes"}
+	if cfg.Limits != nil {
+		if err := ValidateLimits(cfg.Limits); err != nil {
+			return err
+		}
+	}
+	if cfg.Cgroup != nil {
+		if err := ValidateCgroup(cfg.Cgroup); err != nil {
+			return err
+		}
+	}
+	if cfg.Splay != "" {
+		d, err := time.ParseDuration(cfg.Splay)
+		if err != nil || d < 0 {
+			return fmt.Errorf("Config 'splay' must be a positive duration like 30s or 10m")
+		}
+		cfg.SplayDuration = d
+	}
+	if cfg.Retries != nil {
+		if err := ValidateRetries(cfg.Retries); err != nil {
+			return err
+		}
+	}
+	rules, err := parseStatusMap(cfg.StatusMap)
+	if err != nil {
+		return err
+	}
+	cfg.StatusRules = rules
+	if err := ValidateExtractors(cfg.Extractors); err != nil {
+		return err
+	}
+	for name, task := range cfg.Tasks {
+		if task == nil {
+			return fmt.Errorf("Task '%v' must not be empty", name)
+		}
+		if err := ValidateTask(task); err != nil {
+			return fmt.Errorf("Task '%v': %v", name, err.Error())
+		}
+	}
+
+	validTypes := []string{
+		"logfile", "command", "web", "ping", "email", "syslog", "journald", "statsd", "graphite", "prometheus_textfile",
+		"pushgateway", "influx", "otlp", "loki", "elasticsearch", "gelf", "chat", "alert", "mqtt", "nats", "amqp",
+		"redis", "s3",
+	}
+	validWhens := []string{"always", "failures", "successes", "warnings", "not_success", "start"}
 
 	for _, behaviour := range cfg.Behaviours {
-		if !stringIn(behaviour.Type, &validTypes) {
+		if !StringIn(behaviour.Type, &validTypes) {
 			return fmt.Errorf("Behaviour 'type' must be one of %v", validTypes)
 		}
 		if behaviour.When == "" {
 			behaviour.When = "always"
 		}
-		if !stringIn(behaviour.When, &validWhens) {
+		if behaviour.Settings == nil {
+			behaviour.Settings = make(map[string]interface{})
+		}
+		if !StringIn(behaviour.When, &validWhens) {
 			return fmt.Errorf("Behaviour 'when' must be one of %v", validWhens)
 		}
+		if behaviour.HeartbeatInterval != "" {
+			d, err := time.ParseDuration(behaviour.HeartbeatInterval)
+			if err != nil || d < time.Second {
+				return fmt.Errorf("Behaviour 'heartbeat_interval' must be a duration of at least 1s")
+			}
+			behaviour.HeartbeatDuration = d
+		}
 		if behaviour.Type == "command" {
 			if err := ValidateGazeCommandBehaviour(behaviour); err != nil {
 				return err
@@ -241,6 +1282,106 @@ func ValidateAndClean(cfg *GazeConfig) error {
 				return err
 			}
 		}
+		if behaviour.Type == "ping" {
+			if err := ValidateGazePingBehaviour(behaviour); err != nil {
+				return err
+			}
+		}
+		if behaviour.Type == "email" {
+			if err := ValidateGazeEmailBehaviour(behaviour); err != nil {
+				return err
+			}
+		}
+		if behaviour.Type == "syslog" {
+			if err := ValidateGazeSyslogBehaviour(behaviour); err != nil {
+				return err
+			}
+		}
+		if behaviour.Type == "journald" {
+			if err := ValidateGazeJournaldBehaviour(behaviour); err != nil {
+				return err
+			}
+		}
+		if behaviour.Type == "statsd" {
+			if err := ValidateGazeStatsdBehaviour(behaviour); err != nil {
+				return err
+			}
+		}
+		if behaviour.Type == "graphite" {
+			if err := ValidateGazeGraphiteBehaviour(behaviour); err != nil {
+				return err
+			}
+		}
+		if behaviour.Type == "prometheus_textfile" {
+			if err := ValidateGazePrometheusTextfileBehaviour(behaviour); err != nil {
+				return err
+			}
+		}
+		if behaviour.Type == "pushgateway" {
+			if err := ValidateGazePushgatewayBehaviour(behaviour); err != nil {
+				return err
+			}
+		}
+		if behaviour.Type == "influx" {
+			if err := ValidateGazeInfluxBehaviour(behaviour); err != nil {
+				return err
+			}
+		}
+		if behaviour.Type == "otlp" {
+			if err := ValidateGazeOTLPBehaviour(behaviour); err != nil {
+				return err
+			}
+		}
+		if behaviour.Type == "loki" {
+			if err := ValidateGazeLokiBehaviour(behaviour); err != nil {
+				return err
+			}
+		}
+		if behaviour.Type == "elasticsearch" {
+			if err := ValidateGazeElasticsearchBehaviour(behaviour); err != nil {
+				return err
+			}
+		}
+		if behaviour.Type == "gelf" {
+			if err := ValidateGazeGELFBehaviour(behaviour); err != nil {
+				return err
+			}
+		}
+		if behaviour.Type == "chat" {
+			if err := ValidateGazeChatBehaviour(behaviour); err != nil {
+				return err
+			}
+		}
+		if behaviour.Type == "alert" {
+			if err := ValidateGazeAlertBehaviour(behaviour); err != nil {
+				return err
+			}
+		}
+		if behaviour.Type == "mqtt" {
+			if err := ValidateGazeMQTTBehaviour(behaviour); err != nil {
+				return err
+			}
+		}
+		if behaviour.Type == "nats" {
+			if err := ValidateGazeNATSBehaviour(behaviour); err != nil {
+				return err
+			}
+		}
+		if behaviour.Type == "amqp" {
+			if err := ValidateGazeAMQPBehaviour(behaviour); err != nil {
+				return err
+			}
+		}
+		if behaviour.Type == "redis" {
+			if err := ValidateGazeRedisBehaviour(behaviour); err != nil {
+				return err
+			}
+		}
+		if behaviour.Type == "s3" {
+			if err := ValidateGazeS3Behaviour(behaviour); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
@@ -0,0 +1,200 @@
+package conf
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateCgroup(t *testing.T) {
+	tiny, small, zero := 0.005, 0.01, uint64(0)
+	cases := []struct {
+		name     string
+		input    *GazeCgroupConfig
+		expected string
+	}{
+		{"defaults", &GazeCgroupConfig{}, ""},
+		{"relative parent", &GazeCgroupConfig{Parent: "gaze"}, "Cgroup 'parent' must be an absolute path"},
+		{"quota below the kernel minimum", &GazeCgroupConfig{CPUMax: &tiny}, "Cgroup 'cpu_max' must be at least 0.01 cpus"},
+		{"smallest quota", &GazeCgroupConfig{CPUMax: &small}, ""},
+		{"no pids", &GazeCgroupConfig{PidsMax: &zero}, "Cgroup 'pids_max' must be greater than 0"},
+	}
+	for _, c := range cases {
+		err := ValidateCgroup(c.input)
+		if (err == nil && c.expected != "") || (err != nil && err.Error() != c.expected) {
+			t.Errorf("%v: expected '%v' but got %v", c.name, c.expected, err)
+		}
+	}
+	input := &GazeCgroupConfig{}
+	ValidateCgroup(input)
+	if input.Parent != "/sys/fs/cgroup/gaze" {
+		t.Errorf("expected the default parent but got '%v'", input.Parent)
+	}
+}
+
+func TestValidateSplay(t *testing.T) {
+	for input, expected := range map[string]time.Duration{"": 0, "0s": 0, "90s": 90 * time.Second, "1h30m": 90 * time.Minute} {
+		cfg := &GazeConfig{Splay: input}
+		if err := ValidateAndClean(cfg); err != nil || cfg.SplayDuration != expected {
+			t.Errorf("'%v': expected %v but got %v (%v)", input, expected, cfg.SplayDuration, err)
+		}
+	}
+	for _, input := range []string{"-5s", "ten minutes", "10"} {
+		if err := ValidateAndClean(&GazeConfig{Splay: input}); err == nil {
+			t.Errorf("'%v': expected an error", input)
+		}
+	}
+}
+
+func TestValidateRetries(t *testing.T) {
+	input := &GazeRetriesConfig{Count: 3, MaxDelay: "5m", OutputPatterns: []string{"timed? out"}}
+	if err := ValidateRetries(input); err != nil {
+		t.Fatal(err)
+	}
+	if input.DelayDuration != 10*time.Second || input.MaxDelayDuration != 5*time.Minute || input.Backoff != 1 {
+		t.Errorf("unexpected defaults %+v", input)
+	}
+	if len(input.OutputRegexes) != 1 || !input.OutputRegexes[0].MatchString("request time out") {
+		t.Errorf("expected the output pattern to be compiled")
+	}
+	for _, invalid := range []*GazeRetriesConfig{
+		{Count: -1},
+		{Delay: "-1s"},
+		{MaxDelay: "soon"},
+		{Backoff: 0.5},
+		{OutputPatterns: []string{"("}},
+	} {
+		if err := ValidateRetries(invalid); err == nil {
+			t.Errorf("expected an error for %+v", invalid)
+		}
+	}
+}
+
+func TestStatusForExitCode(t *testing.T) {
+	cfg := &GazeConfig{
+		StatusMap: map[string]string{"1": "warning", "2-10": "warning", "5": "failure", "-1": "warning", "-5--2": "success"},
+		Tasks:     map[string]*GazeTaskConfig{"backup": {StatusMap: map[string]string{"24": "success", "1": "failure"}}},
+	}
+	if err := ValidateAndClean(cfg); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		task     string
+		exitCode int
+		expected string
+	}{
+		{"other", 0, StatusSuccess},
+		{"other", 1, StatusWarning},
+		{"other", 7, StatusWarning},
+		{"other", 5, StatusFailure},
+		{"other", 11, StatusFailure},
+		{"other", 24, StatusFailure},
+		{"other", -1, StatusWarning},
+		{"other", -3, StatusSuccess},
+		{"other", -6, StatusFailure},
+		{"backup", 24, StatusSuccess},
+		{"backup", 1, StatusFailure},
+		{"backup", 3, StatusWarning},
+	}
+	for _, c := range cases {
+		if actual := cfg.StatusForExitCode(c.task, c.exitCode); actual != c.expected {
+			t.Errorf("%v %d: expected %v but got %v", c.task, c.exitCode, c.expected, actual)
+		}
+	}
+	if status := (*GazeConfig)(nil).StatusForExitCode("other", 3); status != StatusFailure {
+		t.Errorf("expected the default status without a config but got %v", status)
+	}
+}
+
+func TestParseStatusMapErrors(t *testing.T) {
+	for key, status := range map[string]string{
+		"7-3":  "warning",
+		"3-":   "warning",
+		"x":    "warning",
+		"1,2":  "warning",
+		"--1":  "warning",
+		"4":    "ok",
+		"1-2-": "failure",
+	} {
+		if _, err := parseStatusMap(map[string]string{key: status}); err == nil {
+			t.Errorf("'%v: %v': expected an error", key, status)
+		}
+	}
+	rules, err := parseStatusMap(map[string]string{" -10 - -1 ": "warning", "0-100": "success", "3": "failure"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// rules are sorted from narrowest to widest
+	expected := []GazeStatusRule{{3, 3, StatusFailure}, {-10, -1, StatusWarning}, {0, 100, StatusSuccess}}
+	if len(rules) != len(expected) {
+		t.Fatalf("expected %d rules but got %d", len(expected), len(rules))
+	}
+	for i := range expected {
+		if *rules[i] != expected[i] {
+			t.Errorf("expected rule %d to be %+v but got %+v", i, expected[i], *rules[i])
+		}
+	}
+}
+
+func TestValidateAlertExpiresAfter(t *testing.T) {
+	cases := []struct {
+		name     string
+		value    interface{}
+		expected time.Duration
+		valid    bool
+	}{
+		{"default", nil, 26 * time.Hour, true},
+		{"duration", "90m", 90 * time.Minute, true},
+		{"empty", "", 0, false},
+		{"zero", "0s", 0, false},
+		{"negative", "-1h", 0, false},
+		{"not a duration", "tomorrow", 0, false},
+		{"number", 3600, 0, false},
+	}
+	for _, c := range cases {
+		input := &GazeBehaviourConfig{Type: "alert", When: "always", Settings: map[string]interface{}{
+			"service": "alertmanager", "url": "http://alertmanager:9093",
+		}}
+		if c.value != nil {
+			input.Settings["expires_after"] = c.value
+		}
+		err := ValidateGazeAlertBehaviour(input)
+		if (err == nil) != c.valid {
+			t.Errorf("%v: expected valid %v but got %v", c.name, c.valid, err)
+		} else if c.valid && input.Settings["expires_after"] != c.expected {
+			t.Errorf("%v: expected %v but got %v", c.name, c.expected, input.Settings["expires_after"])
+		}
+	}
+}
+
+func TestValidateRedisTTL(t *testing.T) {
+	cases := []struct {
+		name     string
+		value    interface{}
+		expected time.Duration
+		valid    bool
+	}{
+		{"default", nil, 168 * time.Hour, true},
+		{"duration", "1h", time.Hour, true},
+		{"zero number", 0, 0, true},
+		{"zero string", "0", 0, true},
+		{"zero duration", "0s", 0, true},
+		{"empty", "", 0, true},
+		{"seconds", 3600, time.Hour, true},
+		{"negative seconds", -1, 0, false},
+		{"under a second", "500ms", 0, false},
+		{"not a duration", "a week", 0, false},
+		{"float", 1.5, 0, false},
+	}
+	for _, c := range cases {
+		input := &GazeBehaviourConfig{Type: "redis", Settings: map[string]interface{}{}}
+		if c.value != nil {
+			input.Settings["ttl"] = c.value
+		}
+		err := ValidateGazeRedisBehaviour(input)
+		if (err == nil) != c.valid {
+			t.Errorf("%v: expected valid %v but got %v", c.name, c.valid, err)
+		} else if c.valid && input.Settings["ttl"] != c.expected {
+			t.Errorf("%v: expected %v but got %v", c.name, c.expected, input.Settings["ttl"])
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+// addExtractedValue stores numeric values as metrics and everything else as fields. NaN and infinities can't be
+// represented in json so they are kept as strings.
+func addExtractedValue(metrics map[string]float64, fields map[string]string, key string, value string) {
+	if f, err := strconv.ParseFloat(value, 64); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+		metrics[key] = f
+		delete(fields, key)
+	} else {
+		fields[key] = value
+		delete(metrics, key)
+	}
+}
+
+func extractRegex(extractor *conf.GazeExtractorConfig, output string, metrics map[string]float64, fields map[string]string) {
+	names := extractor.Regex.SubexpNames()
+	for _, match := range extractor.Regex.FindAllStringSubmatchIndex(output, -1) {
+		for i, name := range names {
+			// optional groups that took no part in the match don't overwrite earlier values
+			if name != "" && match[2*i] >= 0 {
+				addExtractedValue(metrics, fields, extractor.Prefix+name, output[match[2*i]:match[2*i+1]])
+			}
+		}
+	}
+}
+
+func extractJSONLines(extractor *conf.GazeExtractorConfig, output string, metrics map[string]float64, fields map[string]string) {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "{") {
+			continue
+		}
+		var decoded map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &decoded); err != nil {
+			continue
+		}
+		for k, v := range decoded {
+			switch tv := v.(type) {
+			case float64:
+				metrics[extractor.Prefix+k] = tv
+				delete(fields, extractor.Prefix+k)
+			case string:
+				fields[extractor.Prefix+k] = tv
+				delete(metrics, extractor.Prefix+k)
+			case bool:
+				fields[extractor.Prefix+k] = strconv.FormatBool(tv)
+				delete(metrics, extractor.Prefix+k)
+			}
+		}
+	}
+}
+
+// splitLogfmt splits a line into key=value pairs, supporting double quoted values
+func splitLogfmt(line string) map[string]string {
+	output := make(map[string]string)
+	for len(line) > 0 {
+		line = strings.TrimLeft(line, " \t")
+		end := strings.IndexAny(line, " \t=")
+		if end <= 0 || line[end] != '=' {
+			// not a key=value token so skip the word
+			if end < 0 {
+				break
+			}
+			line = line[end+1:]
+			continue
+		}
+		key := line[:end]
+		line = line[end+1:]
+		var value string
+		if strings.HasPrefix(line, "\"") {
+			if unquoted, err := strconv.QuotedPrefix(line); err == nil {
+				value, _ = strconv.Unquote(unquoted)
+				line = line[len(unquoted):]
+			} else {
+				value = line[1:]
+				line = ""
+			}
+		} else {
+			vend := strings.IndexAny(line, " \t")
+			if vend < 0 {
+				vend = len(line)
+			}
+			value = line[:vend]
+			line = line[vend:]
+		}
+		output[key] = value
+	}
+	return output
+}
+
+func extractLogfmt(extractor *conf.GazeExtractorConfig, output string, metrics map[string]float64, fields map[string]string) {
+	for _, line := range strings.Split(output, "\n") {
+		for k, v := range splitLogfmt(line) {
+			addExtractedValue(metrics, fields, extractor.Prefix+k, v)
+		}
+	}
+}
+
+// runExtractors runs each extractor over the output in order, so later values override earlier ones
+func runExtractors(extractors []*conf.GazeExtractorConfig, output string) (map[string]float64, map[string]string) {
+	metrics := make(map[string]float64)
+	fields := make(map[string]string)
+	for _, e := range extractors {
+		switch e.Type {
+		case "regex":
+			extractRegex(e, output, metrics, fields)
+		case "json":
+			extractJSONLines(e, output, metrics, fields)
+		case "logfmt":
+			extractLogfmt(e, output, metrics, fields)
+		}
+	}
+	return metrics, fields
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+func TestRunExtractors(t *testing.T) {
+	extractors := []*conf.GazeExtractorConfig{
+		{Type: "regex", Pattern: `transferred: (?P<transferred_bytes>\d+) bytes(?: to (?P<target>\S+))?`},
+		{Type: "json", Prefix: "app_"},
+		{Type: "logfmt"},
+	}
+	if err := conf.ValidateExtractors(extractors); err != nil {
+		t.Fatal(err)
+	}
+	output := "starting\n" +
+		"transferred: 100 bytes to s3\n" +
+		"transferred: 250 bytes\n" +
+		`{"rows": 12, "table": "users", "ok": true, "nested": {"a": 1}}` + "\n" +
+		`{not json}` + "\n" +
+		`level=info duration=1.5 msg="all done" rate=NaN flag` + "\n"
+	metrics, fields := runExtractors(extractors, output)
+
+	expectedMetrics := map[string]float64{"transferred_bytes": 250, "app_rows": 12, "duration": 1.5}
+	expectedFields := map[string]string{
+		"target": "s3", "app_table": "users", "app_ok": "true", "level": "info", "msg": "all done", "rate": "NaN",
+	}
+	if !reflect.DeepEqual(metrics, expectedMetrics) {
+		t.Errorf("expected metrics %v but got %v", expectedMetrics, metrics)
+	}
+	if !reflect.DeepEqual(fields, expectedFields) {
+		t.Errorf("expected fields %v but got %v", expectedFields, fields)
+	}
+}
+
+func TestRunExtractorsLaterValuesOverride(t *testing.T) {
+	extractors := []*conf.GazeExtractorConfig{
+		{Type: "regex", Pattern: `status (?P<state>\w+)`},
+		{Type: "logfmt"},
+	}
+	if err := conf.ValidateExtractors(extractors); err != nil {
+		t.Fatal(err)
+	}
+	metrics, fields := runExtractors(extractors, "status 3\nstate=done\n")
+	if _, ok := metrics["state"]; ok || fields["state"] != "done" {
+		t.Errorf("expected the later string value to replace the metric but got %v %v", metrics, fields)
+	}
+}
+
+func TestSplitLogfmt(t *testing.T) {
+	cases := map[string]map[string]string{
+		"":                             {},
+		"a=1 b=two":                    {"a": "1", "b": "two"},
+		`msg="hello \"world\"" x=`:     {"msg": `hello "world"`, "x": ""},
+		"word =skipped key=value tail": {"key": "value"},
+		`bad="unterminated value`:      {"bad": "unterminated value"},
+		"\tindented=yes":               {"indented": "yes"},
+	}
+	for line, expected := range cases {
+		if actual := splitLogfmt(line); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("%q: expected %v but got %v", line, expected, actual)
+		}
+	}
+}
+
+func TestValidateExtractors(t *testing.T) {
+	for _, invalid := range [][]*conf.GazeExtractorConfig{
+		{nil},
+		{{Type: "xml"}},
+		{{Type: "regex", Pattern: `(\d+)`}},
+		{{Type: "regex", Pattern: `(?P<x>`}},
+	} {
+		if err := conf.ValidateExtractors(invalid); err == nil {
+			t.Errorf("expected an error for %+v", invalid[0])
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"os/user"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/AstromechZA/gaze/conf"
@@ -74,6 +75,132 @@ func setupLogging(enabled bool) {
 	}
 }
 
+// behaviourRunsForStatus checks whether the 'when' setting of a behaviour matches the final status
+func behaviourRunsForStatus(when string, status string) bool {
+	switch when {
+	case "successes":
+		return status == conf.StatusSuccess
+	case "warnings":
+		return status == conf.StatusWarning
+	case "failures":
+		return status == conf.StatusFailure
+	case "not_success":
+		return status != conf.StatusSuccess
+	case "start":
+		return false
+	}
+	return true
+}
+
+// runBehaviour runs the correct behaviour for the type
+func runBehaviour(report *GazeReport, bref *conf.GazeBehaviourConfig) error {
+	if bref.Type == "command" {
+		return RunCmdBehaviour(report, bref)
+	} else if bref.Type == "logfile" {
+		return RunLogBehaviour(report, bref)
+	} else if bref.Type == "web" {
+		return RunWebBehaviour(report, bref)
+	} else if bref.Type == "ping" {
+		return RunPingBehaviour(report, bref)
+	} else if bref.Type == "email" {
+		return RunEmailBehaviour(report, bref)
+	} else if bref.Type == "syslog" {
+		return RunSyslogBehaviour(report, bref)
+	} else if bref.Type == "journald" {
+		return RunJournaldBehaviour(report, bref)
+	} else if bref.Type == "statsd" {
+		return RunStatsdBehaviour(report, bref)
+	} else if bref.Type == "graphite" {
+		return RunGraphiteBehaviour(report, bref)
+	} else if bref.Type == "prometheus_textfile" {
+		return RunPrometheusTextfileBehaviour(report, bref)
+	} else if bref.Type == "pushgateway" {
+		return RunPushgatewayBehaviour(report, bref)
+	} else if bref.Type == "influx" {
+		return RunInfluxBehaviour(report, bref)
+	} else if bref.Type == "otlp" {
+		return RunOTLPBehaviour(report, bref)
+	} else if bref.Type == "loki" {
+		return RunLokiBehaviour(report, bref)
+	} else if bref.Type == "elasticsearch" {
+		return RunElasticsearchBehaviour(report, bref)
+	} else if bref.Type == "gelf" {
+		return RunGELFBehaviour(report, bref)
+	} else if bref.Type == "chat" {
+		return RunChatBehaviour(report, bref)
+	} else if bref.Type == "alert" {
+		return RunAlertBehaviour(report, bref)
+	} else if bref.Type == "mqtt" {
+		return RunMQTTBehaviour(report, bref)
+	} else if bref.Type == "nats" {
+		return RunNATSBehaviour(report, bref)
+	} else if bref.Type == "amqp" {
+		return RunAMQPBehaviour(report, bref)
+	} else if bref.Type == "redis" {
+		return RunRedisBehaviour(report, bref)
+	} else if bref.Type == "s3" {
+		return RunS3Behaviour(report, bref)
+	}
+	panic(fmt.Sprintf(">>> err: unknown behaviour type: %v", bref.Type))
+}
+
+// runningReportTypes are the behaviour types that can tell an in-progress report apart from a final one, either by
+// handling the running status themselves or by passing the json report with its status on to a receiver
+var runningReportTypes = []string{
+	"command", "web", "ping", "syslog", "journald", "gelf", "chat", "mqtt", "nats", "amqp", "redis",
+}
+
+// behaviourAcceptsRunningReports checks whether the behaviour can be sent start and heartbeat reports
+func behaviourAcceptsRunningReports(bref *conf.GazeBehaviourConfig) bool {
+	return conf.StringIn(bref.Type, &runningReportTypes)
+}
+
+// behaviourRunsAtStart checks whether the behaviour wants the in-progress report before the command starts
+func behaviourRunsAtStart(bref *conf.GazeBehaviourConfig) bool {
+	if bref.When == "start" {
+		return true
+	}
+	sendStart, _ := bref.Settings["send_start"].(bool)
+	return bref.Type == "ping" && sendStart
+}
+
+// orderedBehaviourNames lists the behaviours in name order, with the s3 uploads first so that the other behaviours
+// can refer to the uploaded artifacts
+func orderedBehaviourNames(behaviours map[string]*conf.GazeBehaviourConfig) []string {
+	names := make([]string, 0, len(behaviours))
+	for name := range behaviours {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		iFirst, jFirst := behaviours[names[i]].Type == "s3", behaviours[names[j]].Type == "s3"
+		if iFirst != jFirst {
+			return iFirst
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// runStartBehaviours sends the in-progress report to the behaviours that run at the start
+func runStartBehaviours(cfg *conf.GazeConfig, report *GazeReport) {
+	for _, name := range orderedBehaviourNames(cfg.Behaviours) {
+		bref := cfg.Behaviours[name]
+		if !behaviourRunsAtStart(bref) {
+			continue
+		}
+		if !behaviourAcceptsRunningReports(bref) {
+			log.Warningf("Skipping start behaviour '%v' because type %v only handles finished runs", name, bref.Type)
+			continue
+		}
+		log.Infof("Running start behaviour '%v' of type %v..", name, bref.Type)
+		if err := runBehaviour(report, bref); err == nil {
+			log.Info("Behaviour completed.")
+		} else {
+			log.Errorf("Behaviour '%v' failed!: %v", bref.Type, err.Error())
+		}
+	}
+}
+
 func mainInner() error {
 
 	// first set up config flag options
@@ -84,6 +211,8 @@ func mainInner() error {
 	nameFlag := flag.String("name", "", "override the auto generated name for the task")
 	tagsFlag := flag.String("extra-tags", "", "comma-seperated extra tags to add to the structure")
 	exampleConfigFlag := flag.Bool("example-config", false, "output an example config and exit")
+	retriesFlag := flag.Int("retries", -1, "retry the command up to this many times if it fails (overrides config)")
+	splayFlag := flag.Duration("splay", 0, "sleep for a random duration up to this long before running the command (overrides config)")
 
 	// set a more verbose usage message.
 	flag.Usage = func() {
@@ -96,7 +225,7 @@ func mainInner() error {
 	// first do arg checking
 	if *versionFlag {
 		fmt.Printf("Version: %s (%s) on %s \n", Version, GitSummary, BuildDate)
-		fmt.Println(logoImage)
+		fmt.Print(logoImage + "\n")
 		fmt.Println("Project: https://github.com/AstromechZA/gaze")
 		return nil
 	}
@@ -160,6 +289,26 @@ func mainInner() error {
 		}
 	}
 
+	// a zero splay is meaningful since it turns off the splay from the config, so check whether the flag was given
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "splay" {
+			cfg.SplayDuration = *splayFlag
+		}
+	})
+	if cfg.SplayDuration < 0 {
+		return fmt.Errorf("-splay must not be negative")
+	}
+
+	if *retriesFlag >= 0 {
+		if cfg.Retries == nil {
+			cfg.Retries = new(conf.GazeRetriesConfig)
+			if err := conf.ValidateRetries(cfg.Retries); err != nil {
+				return err
+			}
+		}
+		cfg.Retries.Count = *retriesFlag
+	}
+
 	// build command name
 	var commandName string
 	if *nameFlag != "" {
@@ -182,13 +331,26 @@ func mainInner() error {
 		return fmt.Errorf("Could not build command name from supplied args, please provide -name flag for gaze")
 	}
 
+	// behaviours can be notified at the start of the run and periodically during it
+	var onStart func(snapshot func() *GazeReport)
+	var runningHeartbeats *heartbeats
+	if !*jsonFlag {
+		onStart = func(snapshot func() *GazeReport) {
+			runStartBehaviours(cfg, snapshot())
+			runningHeartbeats = startHeartbeats(cfg.Behaviours, snapshot)
+		}
+	}
+
 	// run and generate report
 	forwardOutputToConsole := !*jsonFlag
-	report, err := runReport(flag.Args(), cfg, commandName, forwardOutputToConsole)
+	report, err := runReport(flag.Args(), cfg, commandName, forwardOutputToConsole, onStart)
+	if runningHeartbeats != nil {
+		runningHeartbeats.stop()
+	}
 	if err != nil {
 		return fmt.Errorf("Failed during run and report: %v", err.Error())
 	}
-	log.Infof("Command exited with code %v", report.ExitCode)
+	log.Infof("Command exited with code %v (%v)", report.ExitCode, report.Status)
 
 	if *jsonFlag {
 		output, _ := json.Marshal(report)
@@ -196,32 +358,19 @@ func mainInner() error {
 		return nil
 	}
 
-	commandWasSuccessful := report.ExitCode == 0
 	activateBehaviours := true
 	if activateBehaviours {
-		for _, bref := range cfg.Behaviours {
-			log.Infof("Running behaviour of type %v..", bref.Type)
+		for _, name := range orderedBehaviourNames(cfg.Behaviours) {
+			bref := cfg.Behaviours[name]
+			log.Infof("Running behaviour '%v' of type %v..", name, bref.Type)
 
 			// only run at the right times
-			if commandWasSuccessful && bref.When == "failures" {
-				log.Info("Skipping because it only runs on failures")
-				continue
-			} else if !commandWasSuccessful && bref.When == "successes" {
-				log.Info("Skipping because it only runs on successes")
+			if !behaviourRunsForStatus(bref.When, report.Status) {
+				log.Infof("Skipping because it only runs on %v", bref.When)
 				continue
 			}
 
-			// run the correct behaviour
-			if bref.Type == "command" {
-				err = RunCmdBehaviour(report, bref)
-			} else if bref.Type == "logfile" {
-				err = RunLogBehaviour(report, bref)
-			} else if bref.Type == "web" {
-				err = RunWebBehaviour(report, bref)
-			} else {
-				panic(fmt.Sprintf(">>> err: unknown behaviour type: %v", bref.Type))
-			}
-			if err == nil {
+			if err = runBehaviour(report, bref); err == nil {
 				log.Info("Behaviour completed.")
 			} else {
 				log.Errorf("Behaviour '%v' failed!: %v", bref.Type, err.Error())
@@ -233,6 +382,13 @@ func mainInner() error {
 }
 
 func main() {
+	// when running as the limits shim, apply the limits and exec the real command
+	if payload := os.Getenv(limitsShimEnv); payload != "" {
+		err := runLimitsShim(payload)
+		os.Stderr.WriteString("gaze: " + err.Error() + "\n")
+		os.Exit(127)
+	}
+
 	if err := mainInner(); err != nil {
 		os.Stderr.WriteString(err.Error() + "\n")
 		os.Exit(1)
@@ -21,16 +21,36 @@ def generate_content():
     """))
 
     lines.append(dedent("""\
-    There are 3 types of behaviours that can be invoked once an execution has completed:
+    There are 23 types of behaviours that can be invoked once an execution has completed:
     - `web` : Submit a POST or PUT request with a json payload to whatever url you want
     - `command` : Run the given command with a json payload piped to stdin
     - `logfile` : Simple logging of either structured json or human readable text to a given file path
+    - `ping` : Ping a Healthchecks-compatible service with start, success, and failure urls
+    - `email` : Send an email over SMTP with a templated subject and body
+    - `syslog` : Send an RFC 5424 message with the report as structured data to a local or remote syslog
+    - `journald` : Write an entry with native fields to the systemd journal
+    - `statsd` : Send duration, exit code, status counters, and extracted metrics to a statsd server over UDP
+    - `graphite` : Send the same metrics to graphite using the plaintext protocol over TCP
+    - `prometheus_textfile` : Rewrite a .prom file per task for the node_exporter textfile collector
+    - `pushgateway` : Push the run metrics to a Prometheus Pushgateway
+    - `influx` : Write a point per run to InfluxDB in line protocol over HTTP or UDP
+    - `otlp` : Export the run as an OpenTelemetry span, and optionally metrics, over OTLP/HTTP
+    - `loki` : Push the captured output lines to Grafana Loki
+    - `elasticsearch` : Index the report document into Elasticsearch using the bulk api
+    - `gelf` : Send the report as a GELF 1.1 message to Graylog over UDP or TCP
+    - `chat` : Post a formatted notification to Slack, Mattermost, Discord, Teams, or ntfy
+    - `alert` : Trigger and resolve PagerDuty incidents or Alertmanager alerts from the outcome of the run
+    - `mqtt` : Publish the json report to an MQTT topic
+    - `nats` : Publish the json report to a NATS subject
+    - `amqp` : Publish the json report to an AMQP 0-9-1 exchange such as RabbitMQ
+    - `redis` : Store the latest report per task and host in Redis and add it to a stream
+    - `s3` : Upload the report and the gzipped output to S3 compatible storage
     """))
 
     lines.append(dedent("""\
     The `web` and `command` behaviours are the most valuable as they allow you to take action upon failures or to
     generally monitor the health of the command being run. Use `web` to submit the payload to your own dashboard or
-    use `command` to launch a script that submits data to a `graphite` monitoring instance.
+    use `command` to launch a script that does something more specific.
     """))
 
     lines.append(dedent("""\
@@ -97,12 +117,697 @@ def generate_content():
     ```
     """).format(srvout.strip()))
 
+    lines.append(dedent("""\
+    ### Resource limits
+
+    Heavy jobs can be prevented from starving the host by adding a `limits` section to the config. These are applied to
+    the command just before it is executed:
+
+    ```
+    limits:
+      nice: 10              # cpu niceness from -20 to 19
+      io_class: best-effort # io scheduling class: realtime, best-effort, or idle (linux only)
+      io_level: 7           # io priority level from 0 to 7 within the realtime or best-effort class
+      address_space: 2G     # RLIMIT_AS, bytes or with a K, M, G, or T suffix
+      open_files: 1024      # RLIMIT_NOFILE
+      cpu_seconds: 3600     # RLIMIT_CPU, SIGXCPU is sent at this limit and SIGKILL 5 seconds later
+      core_size: 0          # RLIMIT_CORE
+    ```
+
+    Limits are only supported on unix systems. When the command appears to have failed because of one of these limits,
+    the report contains a `limit_hit` field naming the limit and the `exit_description` says so. A crash or an out of
+    memory message while `address_space` is set only counts as hitting the limit when the peak memory usage was close
+    to it, otherwise the `exit_description` just mentions it as a possible cause. Commands killed by a signal, such as
+    the SIGKILL after `cpu_seconds`, have an `exit_code` of -1. The report also includes the `resource_usage` of the
+    command.
+    """))
+
+    lines.append(dedent("""\
+    ### Cgroups
+
+    On linux hosts using cgroup v2, gaze can run the command inside a transient cgroup when it is running as root or has
+    been delegated a cgroup to manage. This caps and measures the whole process tree rather than just the direct child:
+
+    ```
+    cgroup:
+      parent: /sys/fs/cgroup/gaze # where to create the transient cgroup (default /sys/fs/cgroup/gaze)
+      memory_max: 1G              # memory.max
+      cpu_max: 1.5                # cpu.max as a number of cpus, at least 0.01
+      pids_max: 200               # pids.max
+      kill_leftovers: false       # the default, kill processes the command left running in the cgroup
+    ```
+
+    The report's `resource_usage` then contains a `cgroup` section with the peak memory, oom kill count, and cpu usage of
+    the tree. A command that was oom killed has a `limit_hit` of `memory_max`. The cgroup is removed after the command
+    exits. If the command left processes running, such as a daemon it started, gaze logs a warning and leaves the cgroup
+    for them unless `kill_leftovers` is true. If the cgroup cannot be created, gaze logs a warning and runs the
+    command without it. The parent must not contain any processes itself, since cgroup v2 only lets a cgroup without
+    member processes enable controllers for its children.
+    """))
+
+    lines.append(dedent("""\
+    ### Splay
+
+    When hundreds of hosts run the same job at the same time they can overwhelm shared services. A `splay` causes gaze
+    to sleep for a random duration up to the given maximum before starting the command. It can be set with the `-splay`
+    flag, which overrides the config and can be `0` to turn it off, or in the config:
+
+    ```
+    splay: 10m
+    splay_hostname_seeded: true # derive the delay from the hostname and task name so it is the same on every run
+    ```
+
+    The report records the `scheduled_time` when gaze was invoked, the `splay_seconds` it slept for, and the actual
+    `start_time` of the command.
+    """))
+
+    lines.append(dedent("""\
+    ### Retries
+
+    Commands that fail transiently can be retried rather than reported as failures. The number of retries can be set
+    with the `-retries` flag or in the config:
+
+    ```
+    retries:
+      count: 3          # number of retries after the first attempt
+      delay: 30s        # delay before the first retry (default 10s)
+      backoff: 2        # multiply the delay by this after each retry (default 1)
+      max_delay: 10m    # upper bound on the delay
+      exit_codes: [75]  # only retry these exit codes..
+      output_patterns:  # ..or failures whose output matches one of these regexes
+      - "Could not resolve host"
+    ```
+
+    When neither `exit_codes` nor `output_patterns` are given, every failure is retried. The report contains an
+    `attempts` array with the exit code, timing, and output tail of each attempt. The top level exit code, description,
+    captured output and resource usage reflect the final attempt while the top level times cover the whole run.
+
+    Only the first attempt is connected to the stdin of gaze, retries run with an empty stdin.
+    """))
+
+    lines.append(dedent("""\
+    ### Statuses
+
+    Every report has a `status` of `success`, `warning`, or `failure`. By default an exit code of 0 is a success and
+    anything else is a failure, but some tools use non-zero exit codes for conditions that are not failures. A
+    `status_map` maps exit codes or inclusive ranges of exit codes to statuses, and can be overridden per task name in
+    the `tasks` section:
+
+    ```
+    status_map:
+      "1": warning
+      "100-110": warning
+      "-1": warning      # negative codes work too, and ranges like "-5--1"
+    tasks:
+      rsync:             # the task name, either generated from the command or given by -name
+        status_map:
+          "24": warning  # some files vanished during the transfer
+    ```
+
+    When several entries match an exit code, the narrowest range wins, and task entries are checked before the global
+    ones. The `when` setting of a behaviour can be `always`, `successes`, `warnings`, `failures`, or `not_success`
+    (warnings and failures). Only failures are retried.
+    """))
+
+    lines.append(dedent("""\
+    ### Output assertions
+
+    Some scripts exit with 0 even when they print errors or produce nothing at all. Tasks can have assertions that are
+    checked against the captured output and turn the status into a `failure` when they fail:
+
+    ```
+    tasks:
+      backup:
+        fail_if_output_matches: ["ERROR", "(?i)permission denied"] # fail if any line matches
+        require_output_matches: ["^backup complete$"]              # fail unless some line matches
+        fail_if_output_empty: true
+        fail_if_stderr_nonempty: true
+    ```
+
+    Failed assertions are listed in the `assertion_failures` field of the report along with the pattern and the line that
+    matched, and are summarised in the `exit_description`.
+    """))
+
+    lines.append(dedent("""\
+    ### Extracting metrics and fields
+
+    Rather than parsing the `captured_output` in every receiver, extractors can pull structured data out of the output
+    into the `metrics` (numbers) and `fields` (strings) maps of the report. Extractors can be defined globally or per task
+    and are run in order so that later values override earlier ones:
+
+    ```
+    extractors:
+    - type: regex   # named capture groups become metrics or fields
+      pattern: 'transferred: (?P<transferred_bytes>\d+) bytes'
+    - type: json    # every line that is a json object, nested values are ignored
+      prefix: "app_"
+    - type: logfmt  # key=value pairs on any line
+    tasks:
+      backup:
+        extractors:
+        - type: regex
+          pattern: 'files: (?P<files>\d+)'
+    ```
+
+    Values that parse as numbers become metrics and everything else becomes a field.
+    """))
+
+    lines.append(dedent("""\
+    ### Reporting data from the command
+
+    Commands can deliberately report structured data back to gaze instead of having it parsed from their output. The
+    command is given a file on file descriptor 3, and the `GAZE_REPORT_FD` and `GAZE_REPORT_FILE` environment variables
+    point at it. Each line written to it is a json object with any of the following keys:
+
+    ```
+    echo '{"metrics": {"files": 12}, "fields": {"target": "nas"}, "tags": ["weekly"], "status": "warning"}' >&3
+    ```
+
+    After the command exits the lines are merged into the report, overriding any extracted values, and the `status`
+    overrides the status derived from the exit code. Malformed lines are skipped and described in the
+    `side_channel_errors` field of the report, and data over 1MB is ignored entirely.
+    """))
+
+    lines.append(dedent("""\
+    ### Environment variables
+
+    The command is told about the run it is part of so that it can correlate its own logs with the gaze report:
+
+    - `GAZE_RUN_ULID` : the `ulid` of the report
+    - `GAZE_TASK_NAME` : the task name
+    - `GAZE_TAGS` : comma-separated tags
+    - `GAZE_ATTEMPT` : the attempt number, starting at 1
+    - `GAZE_START_TIME` : the `start_time` of the run in RFC 3339 format
+    """))
+
+    lines.append(dedent("""\
+    ### Start and heartbeat notifications
+
+    Behaviours normally only run once the command has exited, so a long running command is invisible until it ends. A
+    behaviour with `when: start` receives an in-progress report just before the command is started, and a behaviour with
+    a `heartbeat_interval` additionally receives an in-progress report periodically while the command is running:
+
+    ```
+    behaviours:
+      started:
+        type: web
+        when: start
+        settings:
+          url: http://127.0.0.1:8080/started
+      progress:
+        type: web
+        when: always
+        heartbeat_interval: 10m
+        settings:
+          url: http://127.0.0.1:8080/progress
+    ```
+
+    In-progress reports have a `status` of `running`, the elapsed seconds so far, and the `output_tail` of the command.
+    Heartbeat reports also have `heartbeat` set to true. They share the `ulid` of the final report so that receivers
+    can pair them up. The `web` and `command` behaviours send the same json as for a final report, so receivers should
+    check the `status` before treating a report as the outcome of the run.
+
+    Heartbeats are only sent to behaviours whose `when` is `always` or `start`, since a behaviour that only runs for
+    some statuses cannot know whether it will run until the command has finished.
+
+    In-progress reports are only sent to the `command`, `web`, `ping`, `syslog`, `journald`, `gelf`, `chat`, `mqtt`,
+    `nats`, `amqp`, and `redis` behaviours. The other types, such as the metrics and `logfile` behaviours, only
+    describe finished runs, so gaze logs a warning and skips them at the start and for heartbeats.
+    """))
+
+    lines.append(dedent("""\
+    ### Ping behaviour
+
+    The `ping` behaviour follows the url conventions of Healthchecks-compatible monitoring services. A successful or
+    warning run pings the `base_url`, a failure pings `<base_url>/fail`, an in-progress report at the start pings
+    `<base_url>/start`, and heartbeats ping `<base_url>/log`.
+
+    ```
+    behaviours:
+      healthcheck:
+        type: ping
+        include_output: true  # send the output tail as the request body
+        settings:
+          base_url: https://hc-ping.com/your-uuid-here
+          send_start: true     # also ping /start before the command starts
+          use_exit_code: false # ping /<exit-code> instead of /fail for failures
+          run_id: true         # add the report ulid, formatted as a uuid, as the rid parameter
+    ```
+    """))
+
+    lines.append(dedent("""\
+    ### Email behaviour
+
+    The `email` behaviour sends a message over SMTP. The `subject` and `body` are Go templates over the report fields
+    (for example `{{.Name}}`, `{{.Status}}`, `{{.ExitCode}}`) with the extra functions `join`, `lower`, `upper` and
+    `date`. The output tail is only included in the body when `include_output` is true.
+
+    ```
+    behaviours:
+      oncall:
+        type: email
+        when: not_success
+        include_output: true
+        settings:
+          host: smtp.example.com
+          port: 587                   # defaults to 587 for starttls, 465 for tls, and 25 for none
+          tls: starttls               # starttls, tls (implicit), or none
+          auth: plain                 # plain or login, only used when a username is given
+          username: gaze@example.com
+          password: secret
+          from: "Gaze <gaze@example.com>"
+          to: [oncall@example.com, ops@example.com]
+          subject: "[gaze] {{.Name}} {{.Status}} on {{.Hostname}}"
+          attach_output: true         # attach the full captured output as a file
+          insecure_skip_verify: false # skip verification of the server certificate
+    ```
+    """))
+
+    lines.append(dedent("""\
+    ### Syslog and journald behaviours
+
+    The `syslog` behaviour sends an RFC 5424 message with the report fields, metrics, and extracted fields in a
+    `gaze@32473` structured data element. The severity is derived from the status: `err` for failures, `warning` for
+    warnings, and `info` for successes.
+
+    ```
+    behaviours:
+      syslog:
+        type: syslog
+        include_output: true  # append the output tail to the message
+        settings:
+          network: udp        # unix (default), udp, or tcp
+          address: logs.example.com:514 # defaults to /dev/log for unix, port defaults to 514
+          facility: cron      # defaults to user
+          app_name: gaze
+    ```
+
+    The `journald` behaviour writes an entry to the systemd journal using the native protocol, with fields such as
+    `GAZE_ULID`, `GAZE_NAME`, `GAZE_STATUS`, `GAZE_EXIT_CODE`, `GAZE_ELAPSED_SECONDS`, `GAZE_TAGS`, and
+    `GAZE_METRIC_<NAME>`/`GAZE_FIELD_<NAME>` for extracted values. The full output is added as `GAZE_OUTPUT` when
+    `include_output` is true.
+
+    ```
+    behaviours:
+      journal:
+        type: journald
+        settings:
+          identifier: gaze    # SYSLOG_IDENTIFIER
+          socket: /run/systemd/journal/socket
+    ```
+    """))
+
+    lines.append(dedent("""\
+    ### Statsd and graphite behaviours
+
+    The `statsd` and `graphite` behaviours emit the following metrics under a prefix rendered from a template over the
+    report, which defaults to `gaze.{{.Name}}`. Each segment of the prefix has characters other than letters, digits, `_`,
+    and `-` replaced with `_`.
+
+    - `duration_seconds` : the elapsed time of the run (a timer in milliseconds for statsd)
+    - `exit_code` : the final exit code
+    - `attempts` : the number of attempts made
+    - `runs`, `successes`, `warnings`, `failures` : counters of 0 or 1 for this run
+    - `metrics.<name>` : any metrics found by the extractors
+
+    ```
+    behaviours:
+      statsd:
+        type: statsd
+        settings:
+          address: 127.0.0.1:8125   # the default, the port defaults to 8125
+          prefix: "cron.{{.Name}}"
+          tags: true                # append the gaze tags in DogStatsD format, set to false for plain statsd
+          max_packet_size: 1432     # the metrics are packed into as few datagrams as fit
+      graphite:
+        type: graphite
+        settings:
+          address: graphite.example.com   # the port defaults to 2003
+          prefix: "cron.{{.Hostname}}.{{.Name}}"
+    ```
+
+    Graphite metrics are timestamped with the end time of the run.
+    """))
+
+    lines.append(dedent("""\
+    ### Prometheus textfile behaviour
+
+    The `prometheus_textfile` behaviour atomically rewrites a `.prom` file for the node_exporter textfile collector after
+    each run. The file is named `gaze_<name>.prom` by default and contains the following gauges:
+
+    - `gaze_last_start_timestamp_seconds` and `gaze_last_end_timestamp_seconds`
+    - `gaze_last_duration_seconds`
+    - `gaze_last_exit_code`
+    - `gaze_last_attempts`
+    - `gaze_last_success` : 1 if the last run succeeded, 0 otherwise
+    - `gaze_last_success_timestamp_seconds` : carried forward from the previous file when the run did not succeed
+    - `gaze_last_user_cpu_seconds`, `gaze_last_system_cpu_seconds`, and `gaze_last_max_rss_bytes`
+
+    Each series is labelled with `name` and `host`. Tags of the form `key:value` or `key=value` become their own label
+    and any other tags are joined into a `tags` label.
+
+    ```
+    behaviours:
+      prometheus:
+        type: prometheus_textfile
+        settings:
+          directory: /var/lib/node_exporter/textfile_collector
+          filename: backup.prom     # optional, must end in .prom
+    ```
+
+    Use a `filename` when the task name changes between runs, for example when it includes a date.
+    """))
+
+    lines.append(dedent("""\
+    ### Pushgateway behaviour
+
+    The `pushgateway` behaviour pushes the same gauges as the `prometheus_textfile` behaviour, plus any extracted metrics as
+    `gaze_last_metric{metric="<name>"}`, to `<url>/metrics/job/<name>/instance/<host>`. The tags are added to the grouping
+    key in the same way they become labels in the textfile behaviour.
+
+    ```
+    behaviours:
+      pushgateway:
+        type: pushgateway
+        settings:
+          url: http://pushgateway.example.com:9091
+          username: gaze      # optional basic auth
+          password: secret
+    ```
+
+    Every run uses a `PUT` which replaces the whole group. Before pushing a run that did not succeed, gaze reads the
+    previous `gaze_last_success_timestamp_seconds` of the group from the pushgateway api so that it is kept.
+    If that lookup fails the run is pushed with a `POST` instead, which keeps the metrics of the group that are not part of
+    the push, including the last success time.
+    """))
+
+    lines.append(dedent("""\
+    ### Influx behaviour
+
+    The `influx` behaviour writes a single point per run in line protocol, timestamped at the end of the run. The point is
+    tagged with `host`, `name`, and the tags (`key:value` tags become their own tag and the rest are joined into a `tags`
+    tag). It has the fields `duration_seconds`, `exit_code`, `attempts`, `status`, `success`, `user_cpu_seconds`,
+    `system_cpu_seconds`, `max_rss_bytes`, and `metric_<name>` for each extracted metric.
+
+    ```
+    behaviours:
+      influx2:
+        type: influx
+        settings:
+          api: v2             # the default, uses /api/v2/write
+          url: http://influx.example.com:8086
+          org: ops
+          bucket: cron
+          token: secret       # sent as "Authorization: Token <token>"
+          precision: s        # ns, us, ms, or s (the default)
+          measurement: gaze   # the default
+      influx1:
+        type: influx
+        settings:
+          api: v1             # uses /write
+          url: http://influx.example.com:8086
+          database: cron
+          retention_policy: autogen   # optional
+          username: gaze      # optional basic auth, a token can also be used
+          password: secret
+      influxudp:
+        type: influx
+        settings:
+          api: udp
+          address: influx.example.com:8089   # the port defaults to 8089
+    ```
+
+    The UDP listener has no way to receive the precision so it must be configured with the same precision as the
+    behaviour.
+    """))
+
+    lines.append(dedent("""\
+    ### OTLP behaviour
+
+    The `otlp` behaviour exports each run as a span to `<url>/v1/traces` using OTLP/HTTP with either the protobuf or the
+    json encoding. The span covers the start and end time of the run and has an error status when the run failed. The
+    report fields, tags, extracted fields (`gaze.field.<name>`), and extracted metrics (`gaze.metric.<name>`) are added as
+    attributes. When `include_output` is true the output tail is added as an `output` event.
+
+    If gaze is run with a `TRACEPARENT` environment variable in the W3C trace context format, the span is nested under that
+    parent and `TRACESTATE` is passed on. Otherwise the span starts a new trace with the `ulid` of the run as the trace id.
+
+    ```
+    behaviours:
+      otlp:
+        type: otlp
+        include_output: true
+        settings:
+          url: http://collector.example.com:4318   # defaults to http://localhost:4318
+          protocol: protobuf  # or json
+          service_name: gaze  # the default
+          metrics: true       # also send gauges to <url>/v1/metrics
+          headers:
+            Authorization: Bearer secret
+    ```
+
+    The metrics are `gaze.run.duration`, `gaze.run.exit_code`, `gaze.run.attempts`, `gaze.run.success`, and
+    `gaze.metric.<name>` for each extracted metric, with the task name and `key:value` tags as attributes.
+    """))
+
+    lines.append(dedent("""\
+    ### Loki and elasticsearch behaviours
+
+    The `loki` behaviour pushes each line of the captured output to the Loki push api. Each line is timestamped with the
+    time it was written by the command. The stream is labelled with `name`, `host`, and `status`. Tags of the form
+    `key:value` become their own label and the rest are joined into a `tags` label. The output is always sent, regardless
+    of `include_output`, and nothing is sent when there was no output.
+
+    ```
+    behaviours:
+      loki:
+        type: loki
+        settings:
+          url: http://loki.example.com:3100
+          tenant_id: ops      # optional, sent as X-Scope-OrgID
+          username: gaze      # optional basic auth
+          password: secret
+    ```
+
+    The `elasticsearch` behaviour indexes the report through the `_bulk` api, using the `ulid` as the document id and
+    adding an `@timestamp` field with the end time. The index name is a template over the report and defaults to one
+    index per day.
+
+    ```
+    behaviours:
+      elasticsearch:
+        type: elasticsearch
+        include_output: true
+        settings:
+          url: https://es.example.com:9200
+          index: 'cron-{{date "2006.01" .StartTime}}'   # defaults to gaze-{{date "2006.01.02" .StartTime}}
+          api_key: c2VjcmV0  # or username and password for basic auth
+    ```
+    """))
+
+    lines.append(dedent("""\
+    ### GELF behaviour
+
+    The `gelf` behaviour sends the report as a GELF 1.1 message to Graylog. The `short_message` is the exit description
+    and the level is derived from the status in the same way as the `syslog` behaviour. The captured output is sent as the
+    `full_message` when `include_output` is true. Every other report field is added as an additional field, with nested
+    fields flattened using underscores, for example `_exit_code`, `_metrics_rows`, and `_resource_usage_max_rss_bytes`.
+
+    ```
+    behaviours:
+      graylog:
+        type: gelf
+        include_output: true
+        settings:
+          network: udp        # udp (the default) or tcp
+          address: graylog.example.com  # the port defaults to 12201
+          compress: true      # gzip udp messages, tcp messages are never compressed
+          chunk_size: 1420    # the largest udp datagram to send, larger messages are chunked
+    ```
+
+    Over TCP each message is terminated by a null byte. Over UDP a message that does not fit in 128 chunks is not sent.
+    """))
+
+    lines.append(dedent("""\
+    ### Chat behaviour
+
+    The `chat` behaviour posts a notification in the native format of the chosen `flavour`, coloured by status and
+    including the exit description, status, exit code, duration, host, tags, and number of attempts. When `include_output`
+    is true the output tail is added as a code block.
+
+    - `slack` and `mattermost` : an incoming webhook message with an attachment
+    - `discord` : a webhook message with an embed
+    - `teams` : an Adaptive Card for Workflows webhooks, or a MessageCard for the older connectors with `card: message_card`
+    - `ntfy` : a plain text message with the title, priority, and tags sent as headers
+
+    ```
+    behaviours:
+      slack:
+        type: chat
+        when: not_success
+        include_output: true
+        settings:
+          flavour: slack
+          url: https://hooks.slack.com/services/T000/B000/XXXX
+          title: "{{.Name}} {{.Status}} on {{.Hostname}}"   # the default, a template over the report
+          username: cron      # optional for slack, mattermost, and discord
+      ntfy:
+        type: chat
+        settings:
+          flavour: ntfy
+          url: https://ntfy.sh/my-cron-jobs
+          token: tk_secret    # optional access token
+    ```
+    """))
+
+    lines.append(dedent("""\
+    ### Alert behaviour
+
+    The `alert` behaviour triggers an alert when the run fails and resolves it when the run succeeds, so its `when` must
+    be `always`. Warnings resolve the alert unless `trigger_on_warning` is true.
+
+    For PagerDuty the Events API v2 is used with a dedup key that defaults to `gaze/<host>/<name>`, so each task on each
+    host maps to a single incident. Triggered events include the report fields, and the output tail when `include_output`
+    is true, as custom details.
+
+    ```
+    behaviours:
+      pagerduty:
+        type: alert
+        include_output: true
+        settings:
+          service: pagerduty
+          routing_key: R0123456789ABCDEF
+          severity: error     # critical, error (the default), warning, or info
+          summary: "{{.Name}} on {{.Hostname}}: {{.ExitDescription}}"   # the default
+          url: https://events.pagerduty.com/v2/enqueue   # the default
+    ```
+
+    For Alertmanager the alert is posted to `<url>/api/v2/alerts` with the labels `alertname`, `name`, `host`, `severity`
+    and any `key:value` tags. Resolved alerts are sent with the same labels and an end time.
+
+    ```
+    behaviours:
+      alertmanager:
+        type: alert
+        settings:
+          service: alertmanager
+          url: http://alertmanager.example.com:9093
+          alert_name: GazeTaskFailed   # the default
+          expires_after: 26h  # the default
+          username: gaze      # optional basic auth
+          password: secret
+    ```
+
+    A firing alert ends `expires_after` after the run unless a later run fires it again or resolves it. Alertmanager
+    resolves alerts without an end time after its `resolve_timeout`, usually 5 minutes, so the end time is always set. Set
+    `expires_after` longer than the time between runs, the default of `26h` suits a daily schedule.
+    """))
+
+    lines.append(dedent("""\
+    ### Message queue behaviours
+
+    The `mqtt`, `nats`, and `amqp` behaviours publish the json report, the same document as the `web` behaviour sends,
+    to a broker. The topic, subject, and routing key are templates over the report. The captured output is only included
+    when `include_output` is true. Each of them accepts `tls: true` and `insecure_skip_verify: true`.
+
+    ```
+    behaviours:
+      mqtt:
+        type: mqtt
+        settings:
+          address: broker.example.com   # the port defaults to 1883, or 8883 with tls
+          topic: "gaze/{{.Name}}/{{.Status}}"   # the default
+          qos: 1              # 0 (the default), 1, or 2
+          retain: true
+          username: gaze      # optional
+          password: secret
+          client_id: backups  # optional, defaults to gaze- and the last 18 characters of the ulid
+      nats:
+        type: nats
+        settings:
+          address: nats.example.com     # the port defaults to 4222
+          subject: "gaze.{{.Name}}.{{.Status}}"  # the default, whitespace is replaced with _
+          token: secret       # or username and password
+      amqp:
+        type: amqp
+        settings:
+          address: rabbitmq.example.com # the port defaults to 5672, or 5671 with tls
+          vhost: /            # the default
+          exchange: amq.topic # the default
+          routing_key: "gaze.{{.Name}}.{{.Status}}"  # the default
+          username: guest     # the default
+          password: guest     # the default
+          persistent: true    # the default, use delivery mode 2
+    ```
+
+    The `amqp` behaviour uses publisher confirms, so an error is reported if the broker does not accept the message. The
+    `nats` behaviour waits for the server to process the publish before disconnecting.
+    """))
+
+    lines.append(dedent("""\
+    ### Redis behaviour
+
+    The `redis` behaviour keeps a hash with the latest report of each task on each host, adds each report to a stream for
+    consumers, and can publish the json report to a channel. The hash and the stream entries have the fields `ulid`,
+    `name`, `host`, `status`, `exit_code`, `exit_description`, `start_time`, `end_time`, `elapsed_seconds`, `tags`, and
+    `report` (the json report, with the captured output only when `include_output` is true).
+
+    ```
+    behaviours:
+      redis:
+        type: redis
+        settings:
+          address: redis.example.com   # defaults to 127.0.0.1, the port defaults to 6379
+          key: "gaze:last:{{.Hostname}}:{{.Name}}"   # the default
+          ttl: 168h           # the default, expire the hash after a while without a run, 0 keeps it, a number is seconds
+          stream: gaze:runs   # the default, set to "" to disable
+          stream_max_len: 10000  # the default, the stream is trimmed approximately, 0 disables trimming
+          channel: gaze-events   # optional, PUBLISH the json report
+          db: 0               # the default
+          username: gaze      # optional, for redis ACLs
+          password: secret    # optional
+          tls: false          # the default
+    ```
+
+    Add a second `redis` behaviour with `when: start` to also record tasks while they are running.
+    """))
+
+    lines.append(dedent("""\
+    ### S3 behaviour
+
+    The `s3` behaviour uploads the gzipped captured output as `<key>/output.log.gz` and the json report as
+    `<key>/report.json` to S3 or any S3 compatible store such as MinIO, so that large outputs are kept even when they are
+    too big for the other behaviours. Requests are signed with AWS signature version 4. The report only contains the
+    captured output when `include_output` is true.
+
+    ```
+    behaviours:
+      s3:
+        type: s3
+        settings:
+          bucket: gaze-logs
+          region: eu-west-1   # defaults to us-east-1
+          endpoint: https://minio.example.com:9000  # defaults to https://s3.<region>.amazonaws.com
+          path_style: true    # use <endpoint>/<bucket>/<key> rather than <bucket>.<endpoint>/<key>, needed for MinIO
+          key: '{{.Name}}/{{date "2006/01/02" .StartTime}}/{{.Ulid}}'   # the default
+          access_key: AKIA... # defaults to $AWS_ACCESS_KEY_ID
+          secret_key: secret  # defaults to $AWS_SECRET_ACCESS_KEY
+          session_token: ...  # optional, defaults to $AWS_SESSION_TOKEN
+    ```
+
+    The `s3` behaviours run before all the others, and add the urls of the uploaded objects to the `artifacts` field of
+    the report as `output` and `report`. The other behaviours send these in the json report, and templates can link to
+    them with `{{index .Artifacts "output"}}`.
+    """))
+
     lines.append("### What is the `ulid`?")
     lines.append("")
     lines.append(dedent("""\
     A `ulid` (https://github.com/oklog/ulid) is a useful UUID alternative that is added as a unique identifier for each
     report payload. You can use this to log the event and have it corrospond with whatever remote data store
-    is consuming the `web` request. The timstamp in the ulid payload is the same as the `end_time`.
+    is consuming the `web` request. The timstamp in the ulid payload is the same as the `start_time`. The ulid is
+    generated before the command is started so that it can be passed to the command.
     """))
 
     text = "\n".join(lines)
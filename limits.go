@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+// limitsShimEnv is the environment variable used to pass the limits through to the re-executed copy of gaze that
+// applies them and then replaces itself with the real command.
+const limitsShimEnv = "GAZE_INTERNAL_LIMITS_SHIM"
+
+type limitsShimPayload struct {
+	Path   string                 `json:"path"`
+	Limits *conf.GazeLimitsConfig `json:"limits"`
+}
+
+// buildLimitedCommand constructs a command that runs via the gaze limits shim so that the niceness, io scheduling and
+// rlimits are applied in the child process before the real command is exec'd.
+func buildLimitedCommand(args []string, limits *conf.GazeLimitsConfig) (*exec.Cmd, error) {
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		return nil, err
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("Could not locate gaze executable for applying limits: %v", err.Error())
+	}
+	payload, err := json.Marshal(&limitsShimPayload{Path: path, Limits: limits})
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(self, args[1:]...)
+	cmd.Args[0] = args[0]
+	cmd.Env = append(os.Environ(), limitsShimEnv+"="+string(payload))
+	return cmd, nil
+}
+
+// runLimitsShim is called at the very start of main when the shim environment variable is present. It never returns
+// unless an error occurs before the exec.
+func runLimitsShim(rawPayload string) error {
+	// niceness and io priority are per-thread on linux so the same thread must set them and exec
+	runtime.LockOSThread()
+
+	var payload limitsShimPayload
+	if err := json.Unmarshal([]byte(rawPayload), &payload); err != nil {
+		return fmt.Errorf("Invalid limits payload: %v", err.Error())
+	}
+	if payload.Limits != nil {
+		if err := applyLimits(payload.Limits); err != nil {
+			return err
+		}
+	}
+
+	env := make([]string, 0)
+	for _, e := range os.Environ() {
+		if !strings.HasPrefix(e, limitsShimEnv+"=") {
+			env = append(env, e)
+		}
+	}
+	return syscall.Exec(payload.Path, os.Args, env)
+}
+
+// describeCgroupLimitHit checks the cgroup event counters for evidence of a limit being hit
+func describeCgroupLimitHit(usage *GazeCgroupUsage) string {
+	if usage == nil {
+		return ""
+	}
+	if usage.OOMKills > 0 {
+		return "memory_max"
+	}
+	if usage.PidsMaxEvents > 0 {
+		return "pids_max"
+	}
+	return ""
+}
@@ -0,0 +1,30 @@
+//go:build !unix
+// +build !unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+func buildResourceUsage(state *os.ProcessState) *GazeResourceUsage {
+	if state == nil {
+		return nil
+	}
+	return &GazeResourceUsage{
+		UserCPUSeconds:   state.UserTime().Seconds(),
+		SystemCPUSeconds: state.SystemTime().Seconds(),
+	}
+}
+
+func applyLimits(limits *conf.GazeLimitsConfig) error {
+	return fmt.Errorf("limits are only supported on unix systems")
+}
+
+func describeLimitHit(limits *conf.GazeLimitsConfig, status syscall.WaitStatus, usage *GazeResourceUsage, output string) (string, bool) {
+	return "", false
+}
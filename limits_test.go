@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+// TestMain lets the test binary act as the limits shim, since the shim re-executes whatever binary is running
+func TestMain(m *testing.M) {
+	if payload := os.Getenv(limitsShimEnv); payload != "" {
+		err := runLimitsShim(payload)
+		os.Stderr.WriteString("gaze: " + err.Error() + "\n")
+		os.Exit(127)
+	}
+	os.Exit(m.Run())
+}
+
+func TestLimitsShimAppliesLimits(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("limits are only supported on unix systems")
+	}
+	openFiles, cpuSeconds := uint64(64), uint64(300)
+	limits := &conf.GazeLimitsConfig{OpenFiles: &openFiles, CPUSeconds: &cpuSeconds}
+	cmd, err := buildLimitedCommand([]string{"sh", "-c", `echo "$0 $(ulimit -n) $(ulimit -t) ${` + limitsShimEnv + `:-unset}"`}, limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, output)
+	}
+	if actual := strings.TrimSpace(string(output)); actual != "sh 64 300 unset" {
+		t.Errorf("expected the limits to be applied and the shim variable removed but got '%v'", actual)
+	}
+}
+
+func TestLimitsShimReportsMissingCommand(t *testing.T) {
+	if _, err := buildLimitedCommand([]string{"gaze-test-command-that-does-not-exist"}, &conf.GazeLimitsConfig{}); err == nil {
+		t.Errorf("expected an error for a command that is not on the path")
+	}
+}
+
+func TestDescribeCgroupLimitHit(t *testing.T) {
+	cases := []struct {
+		usage    *GazeCgroupUsage
+		expected string
+	}{
+		{nil, ""},
+		{&GazeCgroupUsage{}, ""},
+		{&GazeCgroupUsage{OOMKills: 1, PidsMaxEvents: 2}, "memory_max"},
+		{&GazeCgroupUsage{PidsMaxEvents: 2}, "pids_max"},
+	}
+	for _, c := range cases {
+		if actual := describeCgroupLimitHit(c.usage); actual != c.expected {
+			t.Errorf("%+v: expected '%v' but got '%v'", c.usage, c.expected, actual)
+		}
+	}
+}
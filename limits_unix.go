@@ -0,0 +1,139 @@
+//go:build unix
+// +build unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+// outOfMemoryMarkers are lower case strings commonly printed by programs that fail to allocate memory
+var outOfMemoryMarkers = []string{
+	strings.ToLower(syscall.ENOMEM.Error()),
+	"out of memory",
+	"memoryerror",
+	"bad_alloc",
+}
+
+func buildResourceUsage(state *os.ProcessState) *GazeResourceUsage {
+	if state == nil {
+		return nil
+	}
+	ru, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return nil
+	}
+	return &GazeResourceUsage{
+		UserCPUSeconds:   state.UserTime().Seconds(),
+		SystemCPUSeconds: state.SystemTime().Seconds(),
+		MaxRSSBytes:      int64(ru.Maxrss) * maxRSSMultiplier,
+	}
+}
+
+// setRlimitValue assigns to an rlimit field, which is signed on some of the bsds and unsigned everywhere else
+func setRlimitValue[T ~int64 | ~uint64](field *T, value uint64) {
+	*field = T(value)
+}
+
+func setRlimit(resource int, value uint64, extraHard uint64) error {
+	var current syscall.Rlimit
+	if err := syscall.Getrlimit(resource, &current); err != nil {
+		return err
+	}
+	soft := value
+	hard := value + extraHard
+	// we can only lower the hard limit unless we are privileged
+	if hard > uint64(current.Max) {
+		hard = uint64(current.Max)
+	}
+	if soft > hard {
+		soft = hard
+	}
+	var limit syscall.Rlimit
+	setRlimitValue(&limit.Cur, soft)
+	setRlimitValue(&limit.Max, hard)
+	return syscall.Setrlimit(resource, &limit)
+}
+
+func applyLimits(limits *conf.GazeLimitsConfig) error {
+	if limits.AddressSpace != nil {
+		if err := setRlimit(syscall.RLIMIT_AS, uint64(*limits.AddressSpace), 0); err != nil {
+			return fmt.Errorf("Failed to set address space limit: %v", err.Error())
+		}
+	}
+	if limits.OpenFiles != nil {
+		if err := setRlimit(syscall.RLIMIT_NOFILE, *limits.OpenFiles, 0); err != nil {
+			return fmt.Errorf("Failed to set open files limit: %v", err.Error())
+		}
+	}
+	if limits.CPUSeconds != nil {
+		// leave a gap between the soft and hard limit so that SIGXCPU is delivered before SIGKILL
+		if err := setRlimit(syscall.RLIMIT_CPU, *limits.CPUSeconds, 5); err != nil {
+			return fmt.Errorf("Failed to set cpu time limit: %v", err.Error())
+		}
+	}
+	if limits.CoreSize != nil {
+		if err := setRlimit(syscall.RLIMIT_CORE, uint64(*limits.CoreSize), 0); err != nil {
+			return fmt.Errorf("Failed to set core size limit: %v", err.Error())
+		}
+	}
+	if limits.Nice != nil {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, 0, *limits.Nice); err != nil {
+			return fmt.Errorf("Failed to set nice level: %v", err.Error())
+		}
+	}
+	if limits.IOClass != "" {
+		level := 4
+		if limits.IOLevel != nil {
+			level = *limits.IOLevel
+		}
+		if err := setIOPriority(limits.IOClass, level); err != nil {
+			return fmt.Errorf("Failed to set io scheduling class: %v", err.Error())
+		}
+	}
+	return nil
+}
+
+// describeLimitHit attempts to work out whether a failed command was killed or failed because of one of the
+// configured limits. It returns an empty string when no limit appears to have been involved. The returned bool is
+// false when the limit is only a possible cause, such as a crash or an out of memory message from a command whose
+// peak memory usage was nowhere near the address space limit.
+func describeLimitHit(limits *conf.GazeLimitsConfig, status syscall.WaitStatus, usage *GazeResourceUsage, output string) (string, bool) {
+	if limits == nil {
+		return "", false
+	}
+	if status.Signaled() {
+		switch status.Signal() {
+		case syscall.SIGXCPU:
+			return "cpu_seconds", true
+		case syscall.SIGKILL:
+			if limits.CPUSeconds != nil && usage != nil && uint64(usage.UserCPUSeconds+usage.SystemCPUSeconds) >= *limits.CPUSeconds {
+				return "cpu_seconds", true
+			}
+		case syscall.SIGXFSZ:
+			return "file_size", true
+		}
+	}
+	lowerOutput := strings.ToLower(output)
+	if limits.AddressSpace != nil {
+		crashed := status.Signaled() && (status.Signal() == syscall.SIGSEGV || status.Signal() == syscall.SIGABRT)
+		for _, marker := range outOfMemoryMarkers {
+			crashed = crashed || strings.Contains(lowerOutput, marker)
+		}
+		if crashed {
+			// the address space is always larger than the resident set, so a peak rss of at least half the limit
+			// means the address space was very likely exhausted
+			nearLimit := usage != nil && usage.MaxRSSBytes >= int64(*limits.AddressSpace/2)
+			return "address_space", nearLimit
+		}
+	}
+	if limits.OpenFiles != nil && strings.Contains(lowerOutput, strings.ToLower(syscall.EMFILE.Error())) {
+		return "open_files", true
+	}
+	return "", false
+}
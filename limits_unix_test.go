@@ -0,0 +1,57 @@
+//go:build unix
+// +build unix
+
+package main
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+func TestDescribeLimitHit(t *testing.T) {
+	addressSpace := conf.ByteSize(1 << 30)
+	cpuSeconds, openFiles := uint64(10), uint64(64)
+	limits := &conf.GazeLimitsConfig{AddressSpace: &addressSpace, CPUSeconds: &cpuSeconds, OpenFiles: &openFiles}
+	// a wait status holds the signal in the low bits, or the exit code in the second byte
+	exited := syscall.WaitStatus(1 << 8)
+	cases := []struct {
+		name            string
+		limits          *conf.GazeLimitsConfig
+		status          syscall.WaitStatus
+		usage           *GazeResourceUsage
+		output          string
+		expected        string
+		expectedCertain bool
+	}{
+		{"no limits", nil, syscall.WaitStatus(syscall.SIGXCPU), nil, "", "", false},
+		{"sigxcpu", limits, syscall.WaitStatus(syscall.SIGXCPU), nil, "", "cpu_seconds", true},
+		{"sigkill after the cpu limit", limits, syscall.WaitStatus(syscall.SIGKILL), &GazeResourceUsage{UserCPUSeconds: 12}, "", "cpu_seconds", true},
+		{"sigkill before the cpu limit", limits, syscall.WaitStatus(syscall.SIGKILL), &GazeResourceUsage{UserCPUSeconds: 2}, "", "", false},
+		{"sigxfsz", limits, syscall.WaitStatus(syscall.SIGXFSZ), nil, "", "file_size", true},
+		{"crash near the address space", limits, syscall.WaitStatus(syscall.SIGSEGV), &GazeResourceUsage{MaxRSSBytes: 900 << 20}, "", "address_space", true},
+		{"crash far from the address space", limits, syscall.WaitStatus(syscall.SIGSEGV), &GazeResourceUsage{MaxRSSBytes: 10 << 20}, "", "address_space", false},
+		{"out of memory message", limits, exited, nil, "fatal: Out of memory\n", "address_space", false},
+		{"too many open files", limits, exited, nil, "open: " + syscall.EMFILE.Error(), "open_files", true},
+		{"plain failure", limits, exited, nil, "something broke", "", false},
+	}
+	for _, c := range cases {
+		actual, certain := describeLimitHit(c.limits, c.status, c.usage, c.output)
+		if actual != c.expected || certain != c.expectedCertain {
+			t.Errorf("%v: expected '%v' %v but got '%v' %v", c.name, c.expected, c.expectedCertain, actual, certain)
+		}
+	}
+}
+
+func TestRunAttemptSignalledCommand(t *testing.T) {
+	attempt := &GazeAttempt{Number: 1}
+	err := runAttempt([]string{"sh", "-c", "kill -9 $$"}, nil, "test", false, nil, new(syncBuffer), attempt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a command killed by a signal keeps the exit code that go reports for it
+	if attempt.ExitCode != -1 || attempt.ExitDescription != "Execution failed with code -1" {
+		t.Errorf("unexpected exit code %d and description '%v'", attempt.ExitCode, attempt.ExitDescription)
+	}
+}
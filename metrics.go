@@ -0,0 +1,111 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+const (
+	metricKindCounter = "counter"
+	metricKindGauge   = "gauge"
+	metricKindTimer   = "timer"
+)
+
+// reportMetric is a single numeric value derived from a report for the metric emitting behaviours
+type reportMetric struct {
+	Name  string
+	Value float64
+	Kind  string
+}
+
+func boolToMetric(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// float32ToMetric widens a float32 without exposing the binary representation error in the formatted value
+func float32ToMetric(f float32) float64 {
+	v, _ := strconv.ParseFloat(strconv.FormatFloat(float64(f), 'f', -1, 32), 64)
+	return v
+}
+
+// collectReportMetrics returns the standard metrics for a finished run followed by any extracted metrics in name order
+func collectReportMetrics(report *GazeReport) []reportMetric {
+	output := []reportMetric{
+		{"duration_seconds", float32ToMetric(report.ElapsedSeconds), metricKindTimer},
+		{"exit_code", float64(report.ExitCode), metricKindGauge},
+		{"attempts", float64(len(report.Attempts)), metricKindGauge},
+		{"runs", 1, metricKindCounter},
+		{"successes", boolToMetric(report.Status == conf.StatusSuccess), metricKindCounter},
+		{"warnings", boolToMetric(report.Status == conf.StatusWarning), metricKindCounter},
+		{"failures", boolToMetric(report.Status == conf.StatusFailure), metricKindCounter},
+	}
+	names := make([]string, 0, len(report.Metrics))
+	for k := range report.Metrics {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		output = append(output, reportMetric{"metrics." + metricPathSegment(k), report.Metrics[k], metricKindGauge})
+	}
+	return output
+}
+
+// metricPathSegment replaces anything that is not safe in a dotted metric path segment with an underscore
+func metricPathSegment(input string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, input)
+}
+
+// renderMetricPrefix renders the templated prefix setting and cleans each dotted segment of it
+func renderMetricPrefix(report *GazeReport, config *conf.GazeBehaviourConfig) (string, error) {
+	rendered, err := renderReportTemplate("prefix", config.Settings["prefix"].(string), report)
+	if err != nil {
+		return "", err
+	}
+	segments := []string{}
+	for _, s := range strings.Split(rendered, ".") {
+		if s = strings.TrimSpace(s); s != "" {
+			segments = append(segments, metricPathSegment(s))
+		}
+	}
+	return strings.Join(segments, "."), nil
+}
+
+// joinMetricPath joins a prefix and a metric name, allowing for an empty prefix
+func joinMetricPath(prefix string, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+// reportTagLabels converts the tags into labels, "key:value" and "key=value" tags become their own label and the rest
+// are joined into a "tags" label.
+func reportTagLabels(tags []string) [][2]string {
+	labels := [][2]string{}
+	bare := []string{}
+	for _, t := range tags {
+		if i := strings.IndexAny(t, ":="); i > 0 {
+			name := promLabelName(t[:i])
+			if name != "name" && name != "host" && name != "tags" && !strings.HasPrefix(name, "__") {
+				labels = append(labels, [2]string{name, t[i+1:]})
+				continue
+			}
+		}
+		bare = append(bare, t)
+	}
+	if len(bare) > 0 {
+		labels = append(labels, [2]string{"tags", strings.Join(bare, ",")})
+	}
+	return labels
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+func TestCollectReportMetrics(t *testing.T) {
+	report := &GazeReport{
+		Name:           "backup",
+		ElapsedSeconds: 1.1,
+		ExitCode:       2,
+		Status:         conf.StatusFailure,
+		Attempts:       []*GazeAttempt{{}, {}},
+		Metrics:        map[string]float64{"rows copied": 12, "bytes": 2048},
+	}
+	expected := []reportMetric{
+		{"duration_seconds", 1.1, metricKindTimer},
+		{"exit_code", 2, metricKindGauge},
+		{"attempts", 2, metricKindGauge},
+		{"runs", 1, metricKindCounter},
+		{"successes", 0, metricKindCounter},
+		{"warnings", 0, metricKindCounter},
+		{"failures", 1, metricKindCounter},
+		{"metrics.bytes", 2048, metricKindGauge},
+		{"metrics.rows_copied", 12, metricKindGauge},
+	}
+	if actual := collectReportMetrics(report); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v but got %v", expected, actual)
+	}
+}
+
+func TestRenderMetricPrefix(t *testing.T) {
+	cases := []struct {
+		name     string
+		prefix   string
+		expected string
+	}{
+		{"empty", "", ""},
+		{"plain", "gaze", "gaze"},
+		{"templated", "gaze.{{.Name}}", "gaze.nightly_backup"},
+		{"empty segments", ".gaze.. {{.Name}} .", "gaze.nightly_backup"},
+		{"unsafe characters", "ga/ze.{{.Hostname}}", "ga_ze.web-1.example.com"},
+	}
+	report := &GazeReport{Name: "nightly backup", Hostname: "web-1.example.com"}
+	for _, c := range cases {
+		config := &conf.GazeBehaviourConfig{Settings: map[string]interface{}{"prefix": c.prefix}}
+		actual, err := renderMetricPrefix(report, config)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", c.name, err)
+		} else if actual != c.expected {
+			t.Errorf("%v: expected prefix '%v' but got '%v'", c.name, c.expected, actual)
+		}
+	}
+}
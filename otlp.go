@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"strconv"
+)
+
+// The types below are the parts of the OTLP trace and metric export requests that gaze uses. They carry json tags for
+// the OTLP/HTTP JSON encoding and marshalProto methods for the protobuf encoding, using the field numbers from the
+// opentelemetry-proto definitions.
+
+// otlpUint64 and otlpInt64 are encoded as strings in json as required by the protobuf json mapping
+type otlpUint64 uint64
+type otlpInt64 int64
+
+func (u otlpUint64) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(strconv.FormatUint(uint64(u), 10))), nil
+}
+
+func (i otlpInt64) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(strconv.FormatInt(int64(i), 10))), nil
+}
+
+type otlpAnyValue struct {
+	StringValue *string         `json:"stringValue,omitempty"`
+	BoolValue   *bool           `json:"boolValue,omitempty"`
+	IntValue    *otlpInt64      `json:"intValue,omitempty"`
+	DoubleValue *float64        `json:"doubleValue,omitempty"`
+	ArrayValue  *otlpArrayValue `json:"arrayValue,omitempty"`
+}
+
+type otlpArrayValue struct {
+	Values []otlpAnyValue `json:"values"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+func otlpStringAttr(key string, value string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{StringValue: &value}}
+}
+
+func otlpIntAttr(key string, value int64) otlpKeyValue {
+	v := otlpInt64(value)
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{IntValue: &v}}
+}
+
+func otlpDoubleAttr(key string, value float64) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{DoubleValue: &value}}
+}
+
+func otlpStringsAttr(key string, values []string) otlpKeyValue {
+	array := &otlpArrayValue{Values: make([]otlpAnyValue, len(values))}
+	for i := range values {
+		array.Values[i] = otlpAnyValue{StringValue: &values[i]}
+	}
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{ArrayValue: array}}
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano otlpUint64     `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+// otlpSpan holds the trace, span, and parent span ids as hex strings as used by the json encoding
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	TraceState        string         `json:"traceState,omitempty"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano otlpUint64     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   otlpUint64     `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Events            []otlpEvent    `json:"events,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpTracesRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpDataPoint struct {
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+	TimeUnixNano otlpUint64     `json:"timeUnixNano"`
+	AsDouble     float64        `json:"asDouble"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpMetric struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Unit        string    `json:"unit,omitempty"`
+	Gauge       otlpGauge `json:"gauge"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpMetricsRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+// protoBuffer is a minimal protobuf encoder. Like proto3, the scalar field methods skip default values and the
+// message method always writes the field.
+type protoBuffer struct {
+	bytes.Buffer
+}
+
+const (
+	protoWireVarint  = 0
+	protoWireFixed64 = 1
+	protoWireBytes   = 2
+)
+
+func (b *protoBuffer) varint(v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	b.Write(tmp[:binary.PutUvarint(tmp[:], v)])
+}
+
+func (b *protoBuffer) tag(field int, wireType int) {
+	b.varint(uint64(field<<3 | wireType))
+}
+
+func (b *protoBuffer) varintField(field int, v uint64) {
+	if v != 0 {
+		b.tag(field, protoWireVarint)
+		b.varint(v)
+	}
+}
+
+func (b *protoBuffer) fixed64Field(field int, v uint64) {
+	if v != 0 {
+		b.tag(field, protoWireFixed64)
+		var tmp [8]byte
+		binary.LittleEndian.PutUint64(tmp[:], v)
+		b.Write(tmp[:])
+	}
+}
+
+// doubleField always writes the value since gaze only uses doubles as members of a oneof
+func (b *protoBuffer) doubleField(field int, v float64) {
+	b.tag(field, protoWireFixed64)
+	var tmp [8]byte
+	binary.LittleEndian.PutUint64(tmp[:], math.Float64bits(v))
+	b.Write(tmp[:])
+}
+
+func (b *protoBuffer) bytesField(field int, v []byte) {
+	if len(v) > 0 {
+		b.tag(field, protoWireBytes)
+		b.varint(uint64(len(v)))
+		b.Write(v)
+	}
+}
+
+func (b *protoBuffer) stringField(field int, v string) {
+	b.bytesField(field, []byte(v))
+}
+
+// hexField writes a hex encoded id as bytes
+func (b *protoBuffer) hexField(field int, v string) {
+	decoded, _ := hex.DecodeString(v)
+	b.bytesField(field, decoded)
+}
+
+func (b *protoBuffer) messageField(field int, marshal func(*protoBuffer)) {
+	var inner protoBuffer
+	marshal(&inner)
+	b.tag(field, protoWireBytes)
+	b.varint(uint64(inner.Len()))
+	b.Write(inner.Bytes())
+}
+
+func (v *otlpAnyValue) marshalProto(b *protoBuffer) {
+	// these are members of a oneof so they are written even when they hold the default value
+	switch {
+	case v.StringValue != nil:
+		b.tag(1, protoWireBytes)
+		b.varint(uint64(len(*v.StringValue)))
+		b.WriteString(*v.StringValue)
+	case v.BoolValue != nil:
+		b.tag(2, protoWireVarint)
+		if *v.BoolValue {
+			b.varint(1)
+		} else {
+			b.varint(0)
+		}
+	case v.IntValue != nil:
+		b.tag(3, protoWireVarint)
+		b.varint(uint64(*v.IntValue))
+	case v.DoubleValue != nil:
+		b.doubleField(4, *v.DoubleValue)
+	case v.ArrayValue != nil:
+		b.messageField(5, func(ab *protoBuffer) {
+			for i := range v.ArrayValue.Values {
+				ab.messageField(1, v.ArrayValue.Values[i].marshalProto)
+			}
+		})
+	}
+}
+
+func marshalProtoAttributes(b *protoBuffer, field int, attributes []otlpKeyValue) {
+	for i := range attributes {
+		kv := &attributes[i]
+		b.messageField(field, func(kb *protoBuffer) {
+			kb.stringField(1, kv.Key)
+			kb.messageField(2, kv.Value.marshalProto)
+		})
+	}
+}
+
+func (r *otlpResource) marshalProto(b *protoBuffer) {
+	marshalProtoAttributes(b, 1, r.Attributes)
+}
+
+func (s *otlpScope) marshalProto(b *protoBuffer) {
+	b.stringField(1, s.Name)
+	b.stringField(2, s.Version)
+}
+
+func (s *otlpSpan) marshalProto(b *protoBuffer) {
+	b.hexField(1, s.TraceID)
+	b.hexField(2, s.SpanID)
+	b.stringField(3, s.TraceState)
+	b.hexField(4, s.ParentSpanID)
+	b.stringField(5, s.Name)
+	b.varintField(6, uint64(s.Kind))
+	b.fixed64Field(7, uint64(s.StartTimeUnixNano))
+	b.fixed64Field(8, uint64(s.EndTimeUnixNano))
+	marshalProtoAttributes(b, 9, s.Attributes)
+	for i := range s.Events {
+		e := &s.Events[i]
+		b.messageField(11, func(eb *protoBuffer) {
+			eb.fixed64Field(1, uint64(e.TimeUnixNano))
+			eb.stringField(2, e.Name)
+			marshalProtoAttributes(eb, 3, e.Attributes)
+		})
+	}
+	b.messageField(15, func(sb *protoBuffer) {
+		sb.stringField(2, s.Status.Message)
+		sb.varintField(3, uint64(s.Status.Code))
+	})
+}
+
+func (r *otlpTracesRequest) marshalProto(b *protoBuffer) {
+	for i := range r.ResourceSpans {
+		rs := &r.ResourceSpans[i]
+		b.messageField(1, func(rb *protoBuffer) {
+			rb.messageField(1, rs.Resource.marshalProto)
+			for j := range rs.ScopeSpans {
+				ss := &rs.ScopeSpans[j]
+				rb.messageField(2, func(sb *protoBuffer) {
+					sb.messageField(1, ss.Scope.marshalProto)
+					for k := range ss.Spans {
+						sb.messageField(2, ss.Spans[k].marshalProto)
+					}
+				})
+			}
+		})
+	}
+}
+
+func (m *otlpMetric) marshalProto(b *protoBuffer) {
+	b.stringField(1, m.Name)
+	b.stringField(2, m.Description)
+	b.stringField(3, m.Unit)
+	b.messageField(5, func(gb *protoBuffer) {
+		for i := range m.Gauge.DataPoints {
+			dp := &m.Gauge.DataPoints[i]
+			gb.messageField(1, func(db *protoBuffer) {
+				db.fixed64Field(3, uint64(dp.TimeUnixNano))
+				db.doubleField(4, dp.AsDouble)
+				marshalProtoAttributes(db, 7, dp.Attributes)
+			})
+		}
+	})
+}
+
+func (r *otlpMetricsRequest) marshalProto(b *protoBuffer) {
+	for i := range r.ResourceMetrics {
+		rm := &r.ResourceMetrics[i]
+		b.messageField(1, func(rb *protoBuffer) {
+			rb.messageField(1, rm.Resource.marshalProto)
+			for j := range rm.ScopeMetrics {
+				sm := &rm.ScopeMetrics[j]
+				rb.messageField(2, func(sb *protoBuffer) {
+					sb.messageField(1, sm.Scope.marshalProto)
+					for k := range sm.Metrics {
+						sb.messageField(2, sm.Metrics[k].marshalProto)
+					}
+				})
+			}
+		})
+	}
+}
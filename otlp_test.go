@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestProtoBufferVarint(t *testing.T) {
+	cases := []struct {
+		input    uint64
+		expected []byte
+	}{
+		{0, []byte{0x00}},
+		{1, []byte{0x01}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x01}},
+		{300, []byte{0xac, 0x02}},
+		{16384, []byte{0x80, 0x80, 0x01}},
+	}
+	for _, c := range cases {
+		var b protoBuffer
+		b.varint(c.input)
+		if !bytes.Equal(b.Bytes(), c.expected) {
+			t.Errorf("%v: expected % x but got % x", c.input, c.expected, b.Bytes())
+		}
+	}
+}
+
+func TestProtoBufferLengthPrefix(t *testing.T) {
+	// a length of 128 or more takes a second byte in the length prefix
+	value := strings.Repeat("a", 200)
+	var b protoBuffer
+	b.stringField(5, value)
+	expected := append([]byte{0x2a, 0xc8, 0x01}, value...)
+	if !bytes.Equal(b.Bytes(), expected) {
+		t.Errorf("expected % x but got % x", expected[:3], b.Bytes()[:3])
+	}
+
+	b.Reset()
+	b.messageField(1, func(inner *protoBuffer) {
+		inner.stringField(1, strings.Repeat("b", 126))
+	})
+	expected = append([]byte{0x0a, 0x80, 0x01, 0x0a, 0x7e}, strings.Repeat("b", 126)...)
+	if !bytes.Equal(b.Bytes(), expected) {
+		t.Errorf("expected % x but got % x", expected[:5], b.Bytes()[:5])
+	}
+}
+
+func TestProtoBufferDefaults(t *testing.T) {
+	var b protoBuffer
+	b.varintField(1, 0)
+	b.fixed64Field(2, 0)
+	b.stringField(3, "")
+	b.hexField(4, "")
+	if b.Len() != 0 {
+		t.Errorf("expected default values to be skipped but got % x", b.Bytes())
+	}
+
+	// oneof members are written even when they hold the default value
+	f, zero, empty := false, otlpInt64(0), ""
+	for _, c := range []struct {
+		value    otlpAnyValue
+		expected []byte
+	}{
+		{otlpAnyValue{BoolValue: &f}, []byte{0x10, 0x00}},
+		{otlpAnyValue{IntValue: &zero}, []byte{0x18, 0x00}},
+		{otlpAnyValue{StringValue: &empty}, []byte{0x0a, 0x00}},
+	} {
+		b.Reset()
+		c.value.marshalProto(&b)
+		if !bytes.Equal(b.Bytes(), c.expected) {
+			t.Errorf("expected % x but got % x", c.expected, b.Bytes())
+		}
+	}
+}
+
+// The golden bytes below are derived by hand from the opentelemetry-proto definitions: Span is trace_id = 1,
+// span_id = 2, name = 5, kind = 6, start_time_unix_nano = 7 (fixed64), end_time_unix_nano = 8 (fixed64),
+// attributes = 9 and status = 15 with message = 2 and code = 3. KeyValue is key = 1 and value = 2 and AnyValue has
+// string_value = 1.
+
+func TestOTLPSpanMarshalProto(t *testing.T) {
+	span := otlpSpan{
+		TraceID:           "0102030405060708090a0b0c0d0e0f10",
+		SpanID:            "1112131415161718",
+		Name:              "job",
+		Kind:              otlpSpanKindInternal,
+		StartTimeUnixNano: 1000,
+		EndTimeUnixNano:   2000,
+		Attributes:        []otlpKeyValue{otlpStringAttr("k", "v")},
+		Status:            otlpStatus{Code: otlpStatusError, Message: "bad"},
+	}
+	expected := []byte{
+		0x0a, 0x10, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10,
+		0x12, 0x08, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18,
+		0x2a, 0x03, 'j', 'o', 'b',
+		0x30, 0x01,
+		0x39, 0xe8, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x41, 0xd0, 0x07, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x4a, 0x08, 0x0a, 0x01, 'k', 0x12, 0x03, 0x0a, 0x01, 'v',
+		0x7a, 0x07, 0x12, 0x03, 'b', 'a', 'd', 0x18, 0x02,
+	}
+	var b protoBuffer
+	span.marshalProto(&b)
+	if !bytes.Equal(b.Bytes(), expected) {
+		t.Errorf("expected\n% x\nbut got\n% x", expected, b.Bytes())
+	}
+}
+
+// Metric is name = 1, unit = 3 and gauge = 5, Gauge is data_points = 1 and NumberDataPoint is time_unix_nano = 3
+// (fixed64), as_double = 4 (double) and attributes = 7.
+
+func TestOTLPGaugeMarshalProto(t *testing.T) {
+	metric := otlpMetric{Name: "m", Unit: "s", Gauge: otlpGauge{DataPoints: []otlpDataPoint{{
+		Attributes: []otlpKeyValue{otlpStringAttr("k", "v")}, TimeUnixNano: 1000, AsDouble: 1.5,
+	}}}}
+	expected := []byte{
+		0x0a, 0x01, 'm',
+		0x1a, 0x01, 's',
+		0x2a, 0x1e, 0x0a, 0x1c,
+		0x19, 0xe8, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x21, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xf8, 0x3f,
+		0x3a, 0x08, 0x0a, 0x01, 'k', 0x12, 0x03, 0x0a, 0x01, 'v',
+	}
+	var b protoBuffer
+	metric.marshalProto(&b)
+	if !bytes.Equal(b.Bytes(), expected) {
+		t.Errorf("expected\n% x\nbut got\n% x", expected, b.Bytes())
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"github.com/AstromechZA/gaze/conf"
+
+	"github.com/ScaleFT/monotime"
+)
+
+// syncBuffer is a bytes.Buffer that can be read while the command's output is still being written to it. It also
+// records the time that each line started arriving.
+type syncBuffer struct {
+	mutex     sync.Mutex
+	buffer    bytes.Buffer
+	lineTimes []time.Time
+	midLine   bool
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := time.Now()
+	for _, c := range p {
+		if !b.midLine {
+			b.lineTimes = append(b.lineTimes, now)
+			b.midLine = true
+		}
+		if c == '\n' {
+			b.midLine = false
+		}
+	}
+	return b.buffer.Write(p)
+}
+
+// LineTimes returns the time that each line of the output started arriving
+func (b *syncBuffer) LineTimes() []time.Time {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append([]time.Time{}, b.lineTimes...)
+}
+
+func (b *syncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.String()
+}
+
+// runProgress tracks a run that is still in progress so that in-progress reports can be built from another goroutine
+type runProgress struct {
+	mutex     sync.Mutex
+	base      GazeReport
+	monotimer monotime.Timer
+	attempt   int
+	output    *syncBuffer
+}
+
+// newRunProgress captures the fields of the report that are known before the command starts
+func newRunProgress(report *GazeReport, monotimer monotime.Timer) *runProgress {
+	return &runProgress{
+		base: GazeReport{
+			Ulid:          report.Ulid,
+			Name:          report.Name,
+			Command:       report.Command,
+			ScheduledTime: report.ScheduledTime,
+			SplaySeconds:  report.SplaySeconds,
+			StartTime:     report.StartTime,
+			Hostname:      report.Hostname,
+			Tags:          report.Tags,
+		},
+		monotimer: monotimer,
+	}
+}
+
+// setAttempt records the attempt that is currently running and the buffer its output is going to
+func (p *runProgress) setAttempt(number int, output *syncBuffer) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.attempt = number
+	p.output = output
+}
+
+// snapshot builds an in-progress report with the status 'running'
+func (p *runProgress) snapshot() *GazeReport {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	// each snapshot goes to a behaviour on its own goroutine, so it must not share anything with the base report
+	report := p.base
+	report.Command = append([]string{}, p.base.Command...)
+	report.Tags = append([]string{}, p.base.Tags...)
+	report.Status = conf.StatusRunning
+	report.ExitDescription = "Execution in progress"
+	report.ElapsedSeconds = float32(p.monotimer.Elapsed()) / float32(time.Second)
+	report.Metrics = make(map[string]float64)
+	report.Fields = make(map[string]string)
+	report.Attempts = make([]*GazeAttempt, 0)
+	if p.output != nil {
+		report.OutputTail = outputTail(p.output.String())
+	}
+	if p.attempt > 0 {
+		report.Attempts = append(report.Attempts, &GazeAttempt{Number: p.attempt, Status: conf.StatusRunning})
+	}
+	return &report
+}
+
+// heartbeats periodically sends in-progress reports to the behaviours that have a heartbeat interval
+type heartbeats struct {
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// startHeartbeats starts a ticker for each behaviour with a heartbeat interval. Behaviours that only run for some
+// final statuses get no heartbeats since it is not yet known whether they will run at all, and neither do the types
+// that only handle finished runs.
+func startHeartbeats(behaviours map[string]*conf.GazeBehaviourConfig, snapshot func() *GazeReport) *heartbeats {
+	h := &heartbeats{stopChan: make(chan struct{})}
+	for _, name := range orderedBehaviourNames(behaviours) {
+		bref := behaviours[name]
+		if bref.HeartbeatDuration <= 0 {
+			continue
+		}
+		if bref.When != "always" && !behaviourRunsAtStart(bref) {
+			log.Infof("Skipping heartbeats for behaviour '%v' because it only runs on %v", name, bref.When)
+			continue
+		}
+		if !behaviourAcceptsRunningReports(bref) {
+			log.Warningf("Skipping heartbeats for behaviour '%v' because type %v only handles finished runs", name, bref.Type)
+			continue
+		}
+		h.wg.Add(1)
+		go func(name string, bref *conf.GazeBehaviourConfig) {
+			defer h.wg.Done()
+			ticker := time.NewTicker(bref.HeartbeatDuration)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-h.stopChan:
+					return
+				case <-ticker.C:
+					log.Infof("Running heartbeat for behaviour '%v' of type %v..", name, bref.Type)
+					report := snapshot()
+					report.Heartbeat = true
+					if err := runBehaviour(report, bref); err != nil {
+						log.Errorf("Heartbeat for behaviour '%v' failed!: %v", name, err.Error())
+					}
+				}
+			}
+		}(name, bref)
+	}
+	return h
+}
+
+// stop stops all of the heartbeats and waits for any that are in flight to complete
+func (h *heartbeats) stop() {
+	close(h.stopChan)
+	h.wg.Wait()
+}
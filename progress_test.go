@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AstromechZA/gaze/conf"
+
+	"github.com/ScaleFT/monotime"
+)
+
+// appendingBehaviour is a command behaviour that appends the line its script prints to the given file
+func appendingBehaviour(when string, path string, script string) *conf.GazeBehaviourConfig {
+	return &conf.GazeBehaviourConfig{Type: "command", When: when, Settings: map[string]interface{}{
+		"command": "sh",
+		"args":    []interface{}{"-c", "(" + script + ") >> " + path},
+	}}
+}
+
+func readLines(t *testing.T, path string) []string {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSpace(string(raw)), "\n")
+}
+
+func TestRunStartBehavioursOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "started")
+	cfg := &conf.GazeConfig{Behaviours: map[string]*conf.GazeBehaviourConfig{
+		"c":       appendingBehaviour("start", path, "echo c"),
+		"a":       appendingBehaviour("start", path, "echo a"),
+		"b":       appendingBehaviour("start", path, "echo b"),
+		"final":   appendingBehaviour("always", path, "echo final"),
+		"metrics": {Type: "statsd", When: "start", Settings: map[string]interface{}{"address": "127.0.0.1:1"}},
+	}}
+	if err := conf.ValidateAndClean(cfg); err != nil {
+		t.Fatal(err)
+	}
+	runStartBehaviours(cfg, &GazeReport{Status: conf.StatusRunning})
+	if lines := strings.Join(readLines(t, path), ","); lines != "a,b,c" {
+		t.Errorf("expected the start behaviours to run in name order but got %v", lines)
+	}
+}
+
+func TestHeartbeatsStartAndStop(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "heartbeats")
+	skippedPath := filepath.Join(dir, "skipped")
+	behaviours := map[string]*conf.GazeBehaviourConfig{
+		"progress": appendingBehaviour("always", path, "cat; echo"),
+		"failures": appendingBehaviour("failures", skippedPath, "echo failures"),
+		"logfile":  {Type: "logfile", When: "always", Settings: map[string]interface{}{"directory": dir, "filename": "skipped", "format": "human"}},
+		"quiet":    appendingBehaviour("always", skippedPath, "echo quiet"),
+	}
+	cfg := &conf.GazeConfig{Behaviours: behaviours}
+	if err := conf.ValidateAndClean(cfg); err != nil {
+		t.Fatal(err)
+	}
+	for name, b := range behaviours {
+		if name != "quiet" {
+			b.HeartbeatDuration = 20 * time.Millisecond
+		}
+	}
+
+	progress := newRunProgress(&GazeReport{Ulid: "01BX5ZZKBKACTAV9WEVGEMMVRZ", Name: "backup"}, monotime.New())
+	progress.setAttempt(1, new(syncBuffer))
+	h := startHeartbeats(behaviours, progress.snapshot)
+	time.Sleep(150 * time.Millisecond)
+	h.stop()
+	sent := readLines(t, path)
+	time.Sleep(60 * time.Millisecond)
+	if after := readLines(t, path); len(after) != len(sent) {
+		t.Errorf("expected no heartbeats after stopping but got %d more", len(after)-len(sent))
+	}
+
+	if len(sent) < 2 {
+		t.Fatalf("expected several heartbeats but got %d", len(sent))
+	}
+	for _, line := range sent {
+		var report GazeReport
+		if err := json.Unmarshal([]byte(line), &report); err != nil {
+			t.Fatal(err)
+		}
+		if report.Status != conf.StatusRunning || !report.Heartbeat || report.Ulid != "01BX5ZZKBKACTAV9WEVGEMMVRZ" {
+			t.Errorf("expected a running heartbeat report but got %+v", report)
+		}
+	}
+	if skipped := readLines(t, skippedPath); len(skipped) != 0 {
+		t.Errorf("expected no heartbeats for the other behaviours but got %v", skipped)
+	}
+}
+
+func TestRunProgressSnapshot(t *testing.T) {
+	report := &GazeReport{Name: "backup", Command: []string{"backup.sh"}, Tags: []string{"env:prod"}}
+	progress := newRunProgress(report, monotime.New())
+	output := new(syncBuffer)
+	progress.setAttempt(2, output)
+	output.Write([]byte("first line\nsecond"))
+
+	first := progress.snapshot()
+	if first.Status != conf.StatusRunning || first.OutputTail != "first line\nsecond" || len(first.Attempts) != 1 || first.Attempts[0].Number != 2 {
+		t.Errorf("unexpected snapshot %+v", first)
+	}
+	first.Tags[0] = "changed"
+	first.Command[0] = "changed"
+	first.Fields["x"] = "y"
+	first.Attempts[0].Status = conf.StatusFailure
+	second := progress.snapshot()
+	if second.Tags[0] != "env:prod" || second.Command[0] != "backup.sh" || len(second.Fields) != 0 || second.Attempts[0].Status != conf.StatusRunning {
+		t.Errorf("expected changes to one snapshot not to affect the next but got %+v", second)
+	}
+	if report.Tags[0] != "env:prod" || report.Command[0] != "backup.sh" {
+		t.Errorf("expected changes to a snapshot not to affect the report but got %v %v", report.Tags, report.Command)
+	}
+
+	// snapshots are taken by the heartbeat goroutines while the command is still writing output
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				s := progress.snapshot()
+				s.Tags = append(s.Tags, "extra")
+			}
+		}()
+	}
+	for j := 0; j < 50; j++ {
+		output.Write([]byte("more output\n"))
+	}
+	progress.setAttempt(3, new(syncBuffer))
+	wg.Wait()
+	if final := progress.snapshot(); len(final.Tags) != 1 || final.Attempts[0].Number != 3 {
+		t.Errorf("unexpected final snapshot %+v", final)
+	}
+}
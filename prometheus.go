@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// promLabelName replaces anything that is not valid in a Prometheus label or metric name with an underscore
+func promLabelName(input string) string {
+	output := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, input)
+	if output == "" || (output[0] >= '0' && output[0] <= '9') {
+		output = "_" + output
+	}
+	return output
+}
+
+// promReportLabels returns the labels that identify the series for a report
+func promReportLabels(report *GazeReport) [][2]string {
+	return append([][2]string{{"name", report.Name}, {"host", report.Hostname}}, reportTagLabels(report.Tags)...)
+}
+
+func formatPromLabels(labels [][2]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	parts := make([]string, len(labels))
+	escaper := strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+	for i, l := range labels {
+		parts[i] = fmt.Sprintf("%v=\"%v\"", l[0], escaper.Replace(l[1]))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatPromValue(value float64) string {
+	switch {
+	case math.IsNaN(value):
+		return "NaN"
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// promWriter builds a text exposition format document where every sample shares a common set of labels
+type promWriter struct {
+	buff   bytes.Buffer
+	labels [][2]string
+}
+
+// family writes the help and type lines for a gauge
+func (w *promWriter) family(name string, help string) {
+	w.buff.WriteString(fmt.Sprintf("# HELP %v %v\n# TYPE %v gauge\n", name, help, name))
+}
+
+// sample writes a single value with the common labels and any extra ones
+func (w *promWriter) sample(name string, value float64, extra ...[2]string) {
+	labels := append(append([][2]string{}, w.labels...), extra...)
+	w.buff.WriteString(fmt.Sprintf("%v%v %v\n", name, formatPromLabels(labels), formatPromValue(value)))
+}
+
+func (w *promWriter) gauge(name string, help string, value float64) {
+	w.family(name, help)
+	w.sample(name, value)
+}
+
+// findPromSample returns the value of the first sample of the named metric in an exposition format document
+func findPromSample(reader io.Reader, name string) (float64, bool) {
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, name+"{") && !strings.HasPrefix(line, name+" ") {
+			continue
+		}
+		// the files written by gaze never include a timestamp so the value is the last field
+		if v, err := strconv.ParseFloat(line[strings.LastIndex(line, " ")+1:], 64); err == nil {
+			return v, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPromLabelName(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected string
+	}{
+		{"env", "env"},
+		{"data-center", "data_center"},
+		{"a.b c", "a_b_c"},
+		{"9lives", "_9lives"},
+		{"", "_"},
+	}
+	for _, c := range cases {
+		if actual := promLabelName(c.input); actual != c.expected {
+			t.Errorf("%q: expected '%v' but got '%v'", c.input, c.expected, actual)
+		}
+	}
+}
+
+func TestFormatPromLabels(t *testing.T) {
+	cases := []struct {
+		name     string
+		labels   [][2]string
+		expected string
+	}{
+		{"none", nil, ""},
+		{"plain", [][2]string{{"name", "backup"}, {"host", "db1"}}, `{name="backup",host="db1"}`},
+		{"escaped", [][2]string{{"tags", "say \"hi\"\nC:\\"}}, `{tags="say \"hi\"\nC:\\"}`},
+	}
+	for _, c := range cases {
+		if actual := formatPromLabels(c.labels); actual != c.expected {
+			t.Errorf("%v: expected '%v' but got '%v'", c.name, c.expected, actual)
+		}
+	}
+}
+
+func TestFormatPromValue(t *testing.T) {
+	cases := []struct {
+		input    float64
+		expected string
+	}{
+		{0, "0"},
+		{-3, "-3"},
+		{0.25, "0.25"},
+		{1.5e9, "1500000000"},
+		{math.NaN(), "NaN"},
+		{math.Inf(1), "+Inf"},
+		{math.Inf(-1), "-Inf"},
+	}
+	for _, c := range cases {
+		if actual := formatPromValue(c.input); actual != c.expected {
+			t.Errorf("%v: expected '%v' but got '%v'", c.input, c.expected, actual)
+		}
+	}
+}
+
+func TestFindPromSample(t *testing.T) {
+	document := "# HELP gaze_last_success_timestamp_seconds Unix time the last successful run ended.\n" +
+		"gaze_last_success_timestamp_seconds_extra 1\n" +
+		"gaze_last_success_timestamp_seconds{name=\"a b\",tags=\"x y\"} 1500000000.5\n" +
+		"gaze_last_exit_code 2\n"
+	cases := []struct {
+		name     string
+		metric   string
+		expected float64
+		found    bool
+	}{
+		{"labelled", "gaze_last_success_timestamp_seconds", 1500000000.5, true},
+		{"bare", "gaze_last_exit_code", 2, true},
+		{"missing", "gaze_last_attempts", 0, false},
+	}
+	for _, c := range cases {
+		value, found := findPromSample(strings.NewReader(document), c.metric)
+		if value != c.expected || found != c.found {
+			t.Errorf("%v: expected %v %v but got %v %v", c.name, c.expected, c.found, value, found)
+		}
+	}
+}
+func TestReportTagLabels(t *testing.T) {
+	cases := []struct {
+		name     string
+		tags     []string
+		expected [][2]string
+	}{
+		{"none", nil, [][2]string{}},
+		{"bare", []string{"nightly", "db"}, [][2]string{{"tags", "nightly,db"}}},
+		{"key value", []string{"env:prod", "team=data"}, [][2]string{{"env", "prod"}, {"team", "data"}}},
+		{"value keeps separators", []string{"url=http://x:1"}, [][2]string{{"url", "http://x:1"}}},
+		{"label name cleaned", []string{"data-center:eu"}, [][2]string{{"data_center", "eu"}}},
+		{"reserved names stay bare", []string{"name:x", "host=y", "tags:z", "__meta:w"}, [][2]string{{"tags", "name:x,host=y,tags:z,__meta:w"}}},
+		{"leading separator stays bare", []string{":x", "nightly"}, [][2]string{{"tags", ":x,nightly"}}},
+	}
+	for _, c := range cases {
+		if actual := reportTagLabels(c.tags); !reflect.DeepEqual(actual, c.expected) {
+			t.Errorf("%v: expected %v but got %v", c.name, c.expected, actual)
+		}
+	}
+}
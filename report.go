@@ -1,13 +1,14 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
 	"fmt"
+	"hash/fnv"
 	"io"
+	"math"
 	"math/rand"
 	"os"
 	"os/exec"
+	"strings"
 	"syscall"
 	"time"
 
@@ -23,28 +24,114 @@ type GazeReport struct {
 	Name    string   `json:"name"`
 	Command []string `json:"command"`
 
+	ScheduledTime  time.Time `json:"scheduled_time"`
+	SplaySeconds   float32   `json:"splay_seconds"`
 	StartTime      time.Time `json:"start_time"`
 	EndTime        time.Time `json:"end_time"`
 	ElapsedSeconds float32   `json:"elapsed_seconds"`
 
 	ExitCode        int    `json:"exit_code"`
 	ExitDescription string `json:"exit_description"`
+	LimitHit        string `json:"limit_hit,omitempty"`
+	Status          string `json:"status"`
+	Heartbeat       bool   `json:"heartbeat,omitempty"`
+
+	AssertionFailures []*GazeAssertionFailure `json:"assertion_failures,omitempty"`
+
+	Metrics map[string]float64 `json:"metrics"`
+	Fields  map[string]string  `json:"fields"`
+
+	SideChannelErrors []string `json:"side_channel_errors,omitempty"`
+
+	ResourceUsage *GazeResourceUsage `json:"resource_usage,omitempty"`
 
 	CapturedOutput string `json:"captured_output"`
+	OutputTail     string `json:"output_tail"`
 
 	Hostname string `json:"hostname"`
 
 	Tags []string `json:"tags"`
+
+	Attempts []*GazeAttempt `json:"attempts"`
+
+	// Artifacts holds the urls of anything uploaded by earlier behaviours in this run, such as the s3 objects
+	Artifacts map[string]string `json:"artifacts,omitempty"`
+
+	// outputLineTimes holds the time each line of the captured output started arriving
+	outputLineTimes []time.Time
+}
+
+// addArtifact records the url of something uploaded for this run
+func (r *GazeReport) addArtifact(name string, url string) {
+	if r.Artifacts == nil {
+		r.Artifacts = make(map[string]string)
+	}
+	r.Artifacts[name] = url
+}
+
+type GazeResourceUsage struct {
+	UserCPUSeconds   float64 `json:"user_cpu_seconds"`
+	SystemCPUSeconds float64 `json:"system_cpu_seconds"`
+	MaxRSSBytes      int64   `json:"max_rss_bytes"`
+
+	Cgroup *GazeCgroupUsage `json:"cgroup,omitempty"`
+}
+
+// GazeCgroupUsage covers the whole process tree of the command when it was run inside a transient cgroup
+type GazeCgroupUsage struct {
+	MemoryPeakBytes     int64   `json:"memory_peak_bytes"`
+	OOMKills            int64   `json:"oom_kills"`
+	PidsMaxEvents       int64   `json:"pids_max_events"`
+	CPUUsageSeconds     float64 `json:"cpu_usage_seconds"`
+	CPUUserSeconds      float64 `json:"cpu_user_seconds"`
+	CPUSystemSeconds    float64 `json:"cpu_system_seconds"`
+	CPUThrottledSeconds float64 `json:"cpu_throttled_seconds"`
 }
 
-func streamToBuffer(r io.Reader, buff *bytes.Buffer) error {
-	w := bufio.NewWriter(buff)
-	defer w.Flush()
-	_, err := io.Copy(w, r)
+// GazeAttempt describes a single execution of the command, there may be several when retries are enabled
+type GazeAttempt struct {
+	Number          int       `json:"number"`
+	StartTime       time.Time `json:"start_time"`
+	EndTime         time.Time `json:"end_time"`
+	ElapsedSeconds  float32   `json:"elapsed_seconds"`
+	ExitCode        int       `json:"exit_code"`
+	ExitDescription string    `json:"exit_description"`
+	LimitHit        string    `json:"limit_hit,omitempty"`
+	Status          string    `json:"status"`
+	OutputTail      string    `json:"output_tail"`
+
+	AssertionFailures []*GazeAssertionFailure `json:"assertion_failures,omitempty"`
+
+	capturedOutput  string
+	outputLineTimes []time.Time
+	stderrBytes     int64
+	resourceUsage   *GazeResourceUsage
+	sideChannel     *sideChannelData
+}
+
+// countingReader counts the bytes passing through it
+type countingReader struct {
+	r     io.Reader
+	count int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.count += int64(n)
+	return n, err
+}
+
+const (
+	outputTailLines = 20
+	outputTailBytes = 2048
+)
+
+func streamToBuffer(r io.Reader, buff *syncBuffer) error {
+	_, err := io.Copy(buff, r)
 	return err
 }
 
-func beginBufferTee(inputPipe io.ReadCloser, target *bytes.Buffer, forwardOutput bool, forwardTarget *os.File) error {
+func beginBufferTee(inputPipe io.Reader, target *syncBuffer, forwardOutput bool, forwardTarget *os.File) error {
 	doneChan := make(chan error, 1)
 
 	var bufferSource io.Reader = inputPipe
@@ -62,7 +149,7 @@ func beginBufferTee(inputPipe io.ReadCloser, target *bytes.Buffer, forwardOutput
 	return <-doneChan
 }
 
-func setupReadAll(stdoutPipe, stderrPipe io.ReadCloser, buff *bytes.Buffer, forwardOutput bool) error {
+func setupReadAll(stdoutPipe, stderrPipe io.Reader, buff *syncBuffer, forwardOutput bool) error {
 	// wait for goroutines
 	stdOutResult := beginBufferTee(stdoutPipe, buff, forwardOutput, os.Stdout)
 	stdErrResult := beginBufferTee(stderrPipe, buff, forwardOutput, os.Stderr)
@@ -74,93 +161,316 @@ func setupReadAll(stdoutPipe, stderrPipe io.ReadCloser, buff *bytes.Buffer, forw
 	return stdErrResult
 }
 
-func runReport(args []string, config *conf.GazeConfig, name string, forwardOutput bool) (*GazeReport, error) {
-	output := new(GazeReport)
-	randSource := rand.New(rand.NewSource(time.Now().UnixNano()))
-	output.Name = name
-	output.StartTime = time.Now()
-	monotimer := monotime.New()
-	output.ExitCode = 0
-	output.ExitDescription = "No description added"
-	output.CapturedOutput = ""
-	output.ElapsedSeconds = 0
-	output.Command = args
-
-	if config != nil {
-		output.Tags = config.Tags
+// chooseSplay picks a random delay up to the given maximum. When seeded by hostname, the same host and task name
+// always get the same delay so that a fleet of hosts is spread out deterministically.
+func chooseSplay(maximum time.Duration, hostnameSeeded bool, hostname string, name string) time.Duration {
+	if maximum <= 0 {
+		return 0
 	}
-	if output.Tags == nil {
-		output.Tags = make([]string, 0)
+	seed := time.Now().UnixNano()
+	if hostnameSeeded {
+		h := fnv.New64a()
+		h.Write([]byte(hostname + "/" + name))
+		seed = int64(h.Sum64())
 	}
+	return time.Duration(rand.New(rand.NewSource(seed)).Int63n(int64(maximum)))
+}
 
-	hn, err := os.Hostname()
-	if err == nil {
-		output.Hostname = hn
+// outputTail returns the last few lines of the output, limited in size so that it is suitable for notifications
+func outputTail(output string) string {
+	lines := strings.SplitAfter(output, "\n")
+	if len(lines) > outputTailLines {
+		lines = lines[len(lines)-outputTailLines:]
+	}
+	tail := strings.Join(lines, "")
+	if len(tail) > outputTailBytes {
+		tail = tail[len(tail)-outputTailBytes:]
 	}
+	return tail
+}
 
+// runAttempt executes the command once and fills in the outcome of the attempt. An error is only returned if gaze
+// itself failed in some way, a failing command is described by the exit code.
+func runAttempt(args []string, config *conf.GazeConfig, name string, forwardOutput bool, runEnv []string, outputBuffer *syncBuffer, attempt *GazeAttempt) error {
+	attempt.StartTime = time.Now()
+	monotimer := monotime.New()
 	defer func() {
-		output.EndTime = time.Now()
-		output.ElapsedSeconds = float32(monotimer.Elapsed()) / float32(time.Second)
-		output.Ulid = ulid.MustNew(ulid.Timestamp(output.EndTime), randSource).String()
+		attempt.EndTime = time.Now()
+		attempt.ElapsedSeconds = float32(monotimer.Elapsed()) / float32(time.Second)
+		attempt.OutputTail = outputTail(attempt.capturedOutput)
 	}()
 
-	// run command
-	cmd := exec.Command(args[0], args[1:]...)
+	// run command, via the limits shim if there are limits to apply
+	var err error
+	var cmd *exec.Cmd
+	var limits *conf.GazeLimitsConfig
+	if config != nil && config.Limits != nil {
+		limits = config.Limits
+		cmd, err = buildLimitedCommand(args, limits)
+		if err != nil {
+			attempt.ExitCode = 127
+			attempt.ExitDescription = err.Error()
+			return nil
+		}
+	} else {
+		cmd = exec.Command(args[0], args[1:]...)
+	}
+
+	// send process stdin to the first attempt only, retries would just see whatever it left unread
+	if attempt.Number == 1 {
+		cmd.Stdin = os.Stdin
+	}
 
-	// send process stdin to subprocess
-	cmd.Stdin = os.Stdin
+	// let the command know about the run it is part of
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, runEnv...)
+	cmd.Env = append(cmd.Env, fmt.Sprintf("GAZE_ATTEMPT=%d", attempt.Number))
+
+	// give the command somewhere to report structured data back to us
+	sideChannel, err := createSideChannel()
+	if err != nil {
+		log.Warningf("Running without a side channel: %v", err.Error())
+	} else {
+		cmd.Env = append(cmd.Env, sideChannelEnv(sideChannel)...)
+		cmd.ExtraFiles = []*os.File{sideChannel}
+		defer func() {
+			attempt.sideChannel = readSideChannel(sideChannel)
+		}()
+	}
+
+	// place the command in its own cgroup if configured, but don't fail the run if we can't
+	var cgroup *transientCgroup
+	if config != nil && config.Cgroup != nil {
+		cgroup, err = createTransientCgroup(config.Cgroup, name)
+		if err != nil {
+			log.Warningf("Running without a cgroup: %v", err.Error())
+		} else {
+			log.Infof("Running command in cgroup %v", cgroup.path)
+			cgroup.attach(cmd)
+			defer cgroup.remove()
+		}
+	}
 
 	var stdoutPipe io.ReadCloser
 	var stderrPipe io.ReadCloser
 
 	stdoutPipe, err = cmd.StdoutPipe()
 	if err != nil {
-		output.ExitCode = -1
-		output.ExitDescription = fmt.Sprintf("Failed to bind stdout pipe: %v", err.Error())
-		return output, err
+		attempt.ExitCode = -1
+		attempt.ExitDescription = fmt.Sprintf("Failed to bind stdout pipe: %v", err.Error())
+		return err
 	}
 
 	stderrPipe, err = cmd.StderrPipe()
 	if err != nil {
-		output.ExitCode = -1
-		output.ExitDescription = fmt.Sprintf("Failed to bind stderr pipe: %v", err.Error())
-		return output, err
+		attempt.ExitCode = -1
+		attempt.ExitDescription = fmt.Sprintf("Failed to bind stderr pipe: %v", err.Error())
+		return err
 	}
 
 	err = cmd.Start()
 	if err != nil {
-		output.ExitCode = 127
-		output.ExitDescription = err.Error()
-		return output, nil
+		attempt.ExitCode = 127
+		attempt.ExitDescription = err.Error()
+		return nil
 	}
 
-	outputBuffer := new(bytes.Buffer)
+	stderrCounter := &countingReader{r: stderrPipe}
 
-	err = setupReadAll(stdoutPipe, stderrPipe, outputBuffer, forwardOutput)
+	err = setupReadAll(stdoutPipe, stderrCounter, outputBuffer, forwardOutput)
 	if err != nil {
-		output.ExitCode = -1
-		output.ExitDescription = fmt.Sprintf("Failed to setup read channels: %v", err.Error())
-		return output, err
+		attempt.ExitCode = -1
+		attempt.ExitDescription = fmt.Sprintf("Failed to setup read channels: %v", err.Error())
+		return err
 	}
 
 	err = cmd.Wait()
-	output.CapturedOutput = outputBuffer.String()
+	attempt.capturedOutput = outputBuffer.String()
+	attempt.outputLineTimes = outputBuffer.LineTimes()
+	attempt.stderrBytes = stderrCounter.count
+	attempt.resourceUsage = buildResourceUsage(cmd.ProcessState)
+	if cgroup != nil && attempt.resourceUsage != nil {
+		attempt.resourceUsage.Cgroup = cgroup.collect()
+	}
 
 	if err != nil {
 		exitErr, ok := err.(*exec.ExitError)
-		output.ExitCode = 127
-		output.ExitDescription = "Execution failed"
+		attempt.ExitCode = 127
+		attempt.ExitDescription = "Execution failed"
 		if ok {
 			if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
-				output.ExitCode = status.ExitStatus()
-				output.ExitDescription = fmt.Sprintf("Execution failed with code %d", output.ExitCode)
+				attempt.ExitCode = status.ExitStatus()
+				attempt.ExitDescription = fmt.Sprintf("Execution failed with code %d", attempt.ExitCode)
+				limitHit, certain := describeLimitHit(limits, status, attempt.resourceUsage, attempt.capturedOutput)
+				if limitHit == "" && attempt.resourceUsage != nil {
+					limitHit, certain = describeCgroupLimitHit(attempt.resourceUsage.Cgroup), true
+				}
+				if limitHit != "" && certain {
+					attempt.LimitHit = limitHit
+					attempt.ExitDescription += fmt.Sprintf(" after hitting the %v limit", limitHit)
+				} else if limitHit != "" {
+					attempt.ExitDescription += fmt.Sprintf(" possibly because of the %v limit", limitHit)
+				}
 			}
 		} else {
-			output.ExitDescription = fmt.Sprintf("Unexpected error: %v", err.Error())
+			attempt.ExitDescription = fmt.Sprintf("Unexpected error: %v", err.Error())
 		}
 	} else {
-		output.ExitDescription = "Execution finished with no error"
+		attempt.ExitDescription = "Execution finished with no error"
+	}
+
+	return nil
+}
+
+// shouldRetry decides whether another attempt should be made after the given failed attempt
+func shouldRetry(retries *conf.GazeRetriesConfig, attempt *GazeAttempt) bool {
+	if retries == nil || attempt.Status != conf.StatusFailure || attempt.Number > retries.Count {
+		return false
+	}
+	if len(retries.ExitCodes) == 0 && len(retries.OutputPatterns) == 0 {
+		return true
+	}
+	for _, c := range retries.ExitCodes {
+		if c == attempt.ExitCode {
+			return true
+		}
+	}
+	for _, re := range retries.OutputRegexes {
+		if re.MatchString(attempt.capturedOutput) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryDelay calculates the exponential backoff delay after the given attempt number
+func retryDelay(retries *conf.GazeRetriesConfig, attemptNumber int) time.Duration {
+	maxDelay := time.Duration(math.MaxInt64)
+	if retries.MaxDelayDuration > 0 {
+		maxDelay = retries.MaxDelayDuration
+	}
+	// stop multiplying at the maximum so that a large backoff cannot overflow the duration
+	delay := float64(retries.DelayDuration)
+	for i := 1; i < attemptNumber; i++ {
+		delay *= retries.Backoff
+		if delay >= float64(maxDelay) {
+			return maxDelay
+		}
+	}
+	return time.Duration(delay)
+}
+
+// buildRunEnv creates the environment variables describing the run that are passed to every attempt
+func buildRunEnv(report *GazeReport) []string {
+	return []string{
+		"GAZE_RUN_ULID=" + report.Ulid,
+		"GAZE_TASK_NAME=" + report.Name,
+		"GAZE_TAGS=" + strings.Join(report.Tags, ","),
+		"GAZE_START_TIME=" + report.StartTime.Format(time.RFC3339Nano),
+	}
+}
+
+// runReport runs the command, with retries if configured, and builds the final report. If onStart is given, it is
+// called before the first attempt with a function that builds in-progress reports.
+func runReport(args []string, config *conf.GazeConfig, name string, forwardOutput bool, onStart func(snapshot func() *GazeReport)) (*GazeReport, error) {
+	output := new(GazeReport)
+	randSource := rand.New(rand.NewSource(time.Now().UnixNano()))
+	output.Name = name
+	output.ScheduledTime = time.Now()
+
+	hn, err := os.Hostname()
+	if err == nil {
+		output.Hostname = hn
+	}
+
+	if config != nil && config.SplayDuration > 0 {
+		splay := chooseSplay(config.SplayDuration, config.SplayHostnameSeeded, output.Hostname, name)
+		log.Infof("Sleeping for %v splay before starting..", splay)
+		time.Sleep(splay)
+	}
+
+	output.StartTime = time.Now()
+	output.SplaySeconds = float32(output.StartTime.Sub(output.ScheduledTime)) / float32(time.Second)
+	output.Ulid = ulid.MustNew(ulid.Timestamp(output.StartTime), randSource).String()
+	monotimer := monotime.New()
+	output.ExitCode = 0
+	output.ExitDescription = "No description added"
+	output.CapturedOutput = ""
+	output.ElapsedSeconds = 0
+	output.Command = args
+	output.Attempts = make([]*GazeAttempt, 0)
+
+	if config != nil {
+		output.Tags = config.Tags
+	}
+	if output.Tags == nil {
+		output.Tags = make([]string, 0)
+	}
+
+	defer func() {
+		output.EndTime = time.Now()
+		output.ElapsedSeconds = float32(monotimer.Elapsed()) / float32(time.Second)
+	}()
+	runEnv := buildRunEnv(output)
+
+	progress := newRunProgress(output, monotimer)
+	if onStart != nil {
+		onStart(progress.snapshot)
+	}
+
+	var retries *conf.GazeRetriesConfig
+	if config != nil {
+		retries = config.Retries
+	}
+
+	for attemptNumber := 1; ; attemptNumber++ {
+		attempt := &GazeAttempt{Number: attemptNumber}
+		outputBuffer := new(syncBuffer)
+		progress.setAttempt(attemptNumber, outputBuffer)
+		err = runAttempt(args, config, name, forwardOutput, runEnv, outputBuffer, attempt)
+		attempt.Status = config.StatusForExitCode(name, attempt.ExitCode)
+		if attempt.sideChannel != nil && attempt.sideChannel.status != "" {
+			attempt.Status = attempt.sideChannel.status
+		}
+		if err == nil {
+			attempt.AssertionFailures = checkOutputAssertions(config.Task(name), attempt.capturedOutput, attempt.stderrBytes)
+			if len(attempt.AssertionFailures) > 0 {
+				joiner := " but "
+				if attempt.Status == conf.StatusFailure {
+					joiner = " and "
+				}
+				attempt.Status = conf.StatusFailure
+				attempt.ExitDescription += joiner + describeAssertionFailures(attempt.AssertionFailures)
+			}
+		}
+		output.Attempts = append(output.Attempts, attempt)
+
+		// the top level fields always reflect the final attempt
+		output.ExitCode = attempt.ExitCode
+		output.ExitDescription = attempt.ExitDescription
+		output.LimitHit = attempt.LimitHit
+		output.Status = attempt.Status
+		output.AssertionFailures = attempt.AssertionFailures
+		output.CapturedOutput = attempt.capturedOutput
+		output.outputLineTimes = attempt.outputLineTimes
+		output.OutputTail = attempt.OutputTail
+		output.ResourceUsage = attempt.resourceUsage
+
+		if err != nil || !shouldRetry(retries, attempt) {
+			break
+		}
+		delay := retryDelay(retries, attemptNumber)
+		log.Infof("Attempt %d failed with code %d, retrying in %v..", attemptNumber, attempt.ExitCode, delay)
+		time.Sleep(delay)
+	}
+
+	// pull structured data out of the final output
+	output.Metrics, output.Fields = runExtractors(config.ExtractorsFor(name), output.CapturedOutput)
+	if attempt := output.Attempts[len(output.Attempts)-1]; attempt.sideChannel != nil {
+		mergeSideChannel(output, attempt.sideChannel)
 	}
 
-	return output, nil
+	return output, err
 }
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"math"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+func TestChooseSplay(t *testing.T) {
+	if splay := chooseSplay(0, false, "host1", "backup"); splay != 0 {
+		t.Errorf("expected no splay without a maximum but got %v", splay)
+	}
+	for i := 0; i < 100; i++ {
+		if splay := chooseSplay(time.Minute, false, "host1", "backup"); splay < 0 || splay >= time.Minute {
+			t.Fatalf("splay %v is outside of the maximum", splay)
+		}
+	}
+	first := chooseSplay(time.Hour, true, "host1", "backup")
+	if again := chooseSplay(time.Hour, true, "host1", "backup"); again != first {
+		t.Errorf("expected the hostname seeded splay to be stable but got %v and %v", first, again)
+	}
+	if other := chooseSplay(time.Hour, true, "host2", "backup"); other == first {
+		t.Errorf("expected a different host to get a different splay than %v", first)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	cases := []struct {
+		name     string
+		retries  *conf.GazeRetriesConfig
+		attempt  int
+		expected time.Duration
+	}{
+		{"constant", &conf.GazeRetriesConfig{DelayDuration: 10 * time.Second, Backoff: 1}, 5, 10 * time.Second},
+		{"first attempt", &conf.GazeRetriesConfig{DelayDuration: 10 * time.Second, Backoff: 2}, 1, 10 * time.Second},
+		{"doubling", &conf.GazeRetriesConfig{DelayDuration: 10 * time.Second, Backoff: 2}, 4, 80 * time.Second},
+		{"capped", &conf.GazeRetriesConfig{DelayDuration: 10 * time.Second, Backoff: 2, MaxDelayDuration: time.Minute}, 4, time.Minute},
+		{"overflow capped", &conf.GazeRetriesConfig{DelayDuration: time.Hour, Backoff: 10, MaxDelayDuration: 24 * time.Hour}, 1000, 24 * time.Hour},
+		{"overflow without a cap", &conf.GazeRetriesConfig{DelayDuration: time.Hour, Backoff: 10}, 1000, time.Duration(math.MaxInt64)},
+	}
+	for _, c := range cases {
+		if actual := retryDelay(c.retries, c.attempt); actual != c.expected {
+			t.Errorf("%v: expected %v but got %v", c.name, c.expected, actual)
+		}
+	}
+}
+
+func TestShouldRetry(t *testing.T) {
+	everything := &conf.GazeRetriesConfig{Count: 2}
+	selective := &conf.GazeRetriesConfig{
+		Count: 2, ExitCodes: []int{75}, OutputPatterns: []string{"timed out"},
+		OutputRegexes: []*regexp.Regexp{regexp.MustCompile("timed out")},
+	}
+	cases := []struct {
+		name     string
+		retries  *conf.GazeRetriesConfig
+		attempt  *GazeAttempt
+		expected bool
+	}{
+		{"no retries", nil, &GazeAttempt{Number: 1, Status: conf.StatusFailure}, false},
+		{"success", everything, &GazeAttempt{Number: 1, Status: conf.StatusSuccess}, false},
+		{"warning", everything, &GazeAttempt{Number: 1, Status: conf.StatusWarning}, false},
+		{"any failure", everything, &GazeAttempt{Number: 2, Status: conf.StatusFailure, ExitCode: 1}, true},
+		{"out of retries", everything, &GazeAttempt{Number: 3, Status: conf.StatusFailure, ExitCode: 1}, false},
+		{"matching exit code", selective, &GazeAttempt{Number: 1, Status: conf.StatusFailure, ExitCode: 75}, true},
+		{"matching output", selective, &GazeAttempt{Number: 1, Status: conf.StatusFailure, ExitCode: 1, capturedOutput: "connection timed out\n"}, true},
+		{"no match", selective, &GazeAttempt{Number: 1, Status: conf.StatusFailure, ExitCode: 1, capturedOutput: "bad input\n"}, false},
+	}
+	for _, c := range cases {
+		if actual := shouldRetry(c.retries, c.attempt); actual != c.expected {
+			t.Errorf("%v: expected %v but got %v", c.name, c.expected, actual)
+		}
+	}
+}
+
+func TestRunReportRetries(t *testing.T) {
+	config := &conf.GazeConfig{Retries: &conf.GazeRetriesConfig{Count: 2, Delay: "1ms"}}
+	if err := conf.ValidateAndClean(config); err != nil {
+		t.Fatal(err)
+	}
+	report, err := runReport([]string{"sh", "-c", "echo attempt $GAZE_ATTEMPT; exit 3"}, config, "retried", false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Attempts) != 3 || report.Status != conf.StatusFailure || report.ExitCode != 3 {
+		t.Fatalf("expected 3 failed attempts but got %d with status %v", len(report.Attempts), report.Status)
+	}
+	if report.CapturedOutput != "attempt 3\n" {
+		t.Errorf("expected the report to have the output of the final attempt but got %q", report.CapturedOutput)
+	}
+}
+
+func TestRunReportEnvironment(t *testing.T) {
+	config := &conf.GazeConfig{Tags: []string{"env:prod", "db"}, Retries: &conf.GazeRetriesConfig{Count: 1, Delay: "1ms"}}
+	if err := conf.ValidateAndClean(config); err != nil {
+		t.Fatal(err)
+	}
+	script := `echo "$GAZE_RUN_ULID|$GAZE_TASK_NAME|$GAZE_TAGS|$GAZE_ATTEMPT|$GAZE_START_TIME"; [ "$GAZE_ATTEMPT" = 2 ]`
+	report, err := runReport([]string{"sh", "-c", script}, config, "backup", false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Attempts) != 2 || report.Status != conf.StatusSuccess {
+		t.Fatalf("expected the second attempt to succeed but got %d attempts and %v", len(report.Attempts), report.Status)
+	}
+	expected := report.Ulid + "|backup|env:prod,db|2|" + report.StartTime.Format(time.RFC3339Nano) + "\n"
+	if report.CapturedOutput != expected {
+		t.Errorf("expected the run environment %q but got %q", expected, report.CapturedOutput)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+const (
+	// sideChannelFD is the file descriptor number the side channel file is given in the command
+	sideChannelFD = 3
+	// sideChannelMaxBytes is the largest amount of side channel data that is accepted
+	sideChannelMaxBytes = 1024 * 1024
+)
+
+// sideChannelLine is a single json line written by the command to the side channel. All keys are optional.
+type sideChannelLine struct {
+	Fields  map[string]string  `json:"fields"`
+	Metrics map[string]float64 `json:"metrics"`
+	Tags    []string           `json:"tags"`
+	Status  string             `json:"status"`
+}
+
+// sideChannelData is the merged content of all of the lines written by the command
+type sideChannelData struct {
+	fields  map[string]string
+	metrics map[string]float64
+	tags    []string
+	status  string
+	errors  []string
+}
+
+// createSideChannel creates the temporary file that the command can write to
+func createSideChannel() (*os.File, error) {
+	return ioutil.TempFile("", "gaze-report-")
+}
+
+// sideChannelEnv builds the environment variables that tell the command where to write
+func sideChannelEnv(f *os.File) []string {
+	return []string{
+		fmt.Sprintf("GAZE_REPORT_FD=%d", sideChannelFD),
+		"GAZE_REPORT_FILE=" + f.Name(),
+	}
+}
+
+// readSideChannel reads and parses the side channel file, skipping lines that are malformed. The file is closed and
+// removed afterwards.
+func readSideChannel(f *os.File) *sideChannelData {
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	output := &sideChannelData{
+		fields:  make(map[string]string),
+		metrics: make(map[string]float64),
+		tags:    make([]string, 0),
+		errors:  make([]string, 0),
+	}
+
+	// read one byte past the limit so that oversized data is detected without reading all of it
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		output.errors = append(output.errors, fmt.Sprintf("Could not read side channel: %v", err.Error()))
+		return output
+	}
+	raw, err := ioutil.ReadAll(io.LimitReader(f, sideChannelMaxBytes+1))
+	if err != nil {
+		output.errors = append(output.errors, fmt.Sprintf("Could not read side channel: %v", err.Error()))
+		return output
+	}
+	if len(raw) > sideChannelMaxBytes {
+		output.errors = append(output.errors, fmt.Sprintf("Side channel data exceeded the limit of %d bytes", sideChannelMaxBytes))
+		return output
+	}
+
+	validStatuses := []string{conf.StatusSuccess, conf.StatusWarning, conf.StatusFailure}
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	scanner.Buffer(make([]byte, 64*1024), sideChannelMaxBytes)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var line sideChannelLine
+		if err := json.Unmarshal([]byte(text), &line); err != nil {
+			output.errors = append(output.errors, fmt.Sprintf("Side channel line %d is not valid: %v", lineNumber, err.Error()))
+			continue
+		}
+		if line.Status != "" && !conf.StringIn(line.Status, &validStatuses) {
+			output.errors = append(output.errors, fmt.Sprintf("Side channel line %d status must be one of %v", lineNumber, validStatuses))
+			continue
+		}
+		for k, v := range line.Fields {
+			output.fields[k] = v
+		}
+		for k, v := range line.Metrics {
+			output.metrics[k] = v
+		}
+		for _, t := range line.Tags {
+			if t = strings.TrimSpace(t); t != "" {
+				output.tags = append(output.tags, t)
+			}
+		}
+		if line.Status != "" {
+			output.status = line.Status
+		}
+	}
+	return output
+}
+
+// mergeSideChannel copies the side channel data into the report, overriding any extracted values
+func mergeSideChannel(report *GazeReport, data *sideChannelData) {
+	for k, v := range data.fields {
+		report.Fields[k] = v
+		delete(report.Metrics, k)
+	}
+	for k, v := range data.metrics {
+		report.Metrics[k] = v
+		delete(report.Fields, k)
+	}
+	if len(data.tags) > 0 {
+		tags := make([]string, 0, len(report.Tags)+len(data.tags))
+		tags = append(tags, report.Tags...)
+		report.Tags = append(tags, data.tags...)
+	}
+	if len(data.errors) > 0 {
+		report.SideChannelErrors = data.errors
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+func writeSideChannel(t *testing.T, content string) *os.File {
+	f, err := createSideChannel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestReadSideChannel(t *testing.T) {
+	f := writeSideChannel(t, `{"fields": {"db": "users"}, "metrics": {"rows": 10}, "tags": ["a", " "]}`+"\n"+
+		"\n"+
+		"not json\n"+
+		`{"status": "done"}`+"\n"+
+		`{"metrics": {"rows": 12}, "tags": ["b"], "status": "warning"}`+"\n")
+	data := readSideChannel(f)
+	if _, err := os.Stat(f.Name()); !os.IsNotExist(err) {
+		t.Errorf("expected the side channel file to be removed")
+	}
+	if !reflect.DeepEqual(data.fields, map[string]string{"db": "users"}) || !reflect.DeepEqual(data.metrics, map[string]float64{"rows": 12}) {
+		t.Errorf("unexpected fields %v or metrics %v", data.fields, data.metrics)
+	}
+	if strings.Join(data.tags, ",") != "a,b" || data.status != conf.StatusWarning {
+		t.Errorf("unexpected tags %v or status '%v'", data.tags, data.status)
+	}
+	if len(data.errors) != 2 || !strings.HasPrefix(data.errors[0], "Side channel line 3 is not valid") ||
+		!strings.HasPrefix(data.errors[1], "Side channel line 4 status must be one of") {
+		t.Errorf("unexpected errors %q", data.errors)
+	}
+}
+
+func TestReadSideChannelLimit(t *testing.T) {
+	line := `{"fields": {"padding": "` + strings.Repeat("x", 1000) + `"}}` + "\n"
+	atLimit := strings.Repeat(line, sideChannelMaxBytes/len(line))
+	atLimit += strings.Repeat(" ", sideChannelMaxBytes-len(atLimit))
+	if data := readSideChannel(writeSideChannel(t, atLimit)); len(data.errors) != 0 || data.fields["padding"] == "" {
+		t.Errorf("expected data of exactly the limit to be read but got errors %q", data.errors)
+	}
+	data := readSideChannel(writeSideChannel(t, atLimit+"x"))
+	if len(data.errors) != 1 || data.errors[0] != "Side channel data exceeded the limit of 1048576 bytes" || len(data.fields) != 0 {
+		t.Errorf("expected only the limit error but got %q and %v", data.errors, data.fields)
+	}
+}
+
+func TestMergeSideChannel(t *testing.T) {
+	report := &GazeReport{
+		Tags:    []string{"env:prod"},
+		Metrics: map[string]float64{"rows": 1, "state": 2},
+		Fields:  map[string]string{"rows": "many"},
+	}
+	mergeSideChannel(report, &sideChannelData{
+		fields:  map[string]string{"state": "ok"},
+		metrics: map[string]float64{"rows": 5},
+		tags:    []string{"db"},
+		errors:  []string{"Side channel line 1 is not valid"},
+	})
+	if !reflect.DeepEqual(report.Metrics, map[string]float64{"rows": 5}) || !reflect.DeepEqual(report.Fields, map[string]string{"state": "ok"}) {
+		t.Errorf("expected the side channel to override extracted values but got %v %v", report.Metrics, report.Fields)
+	}
+	if strings.Join(report.Tags, ",") != "env:prod,db" || len(report.SideChannelErrors) != 1 {
+		t.Errorf("unexpected tags %v or errors %v", report.Tags, report.SideChannelErrors)
+	}
+}
+
+func TestRunReportSideChannel(t *testing.T) {
+	script := `echo '{"status": "warning", "metrics": {"rows": 3}}' >&3; echo '{"tags": ["fd"]}' >> "$GAZE_REPORT_FILE"; exit 1`
+	report, err := runReport([]string{"sh", "-c", script}, nil, "reporting", false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Status != conf.StatusWarning || report.Metrics["rows"] != 3 || strings.Join(report.Tags, ",") != "fd" {
+		t.Errorf("expected the side channel to set the status, metrics and tags but got %v %v %v", report.Status, report.Metrics, report.Tags)
+	}
+}
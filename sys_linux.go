@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+const (
+	ioprioClassShift   = 13
+	ioprioWhoProcess   = 1
+	ioprioClassRT      = 1
+	ioprioClassBE      = 2
+	ioprioClassIdle    = 3
+	ioprioDefaultLevel = 0
+
+	// linux reports ru_maxrss in kilobytes
+	maxRSSMultiplier = 1024
+)
+
+func setIOPriority(class string, level int) error {
+	var ioClass int
+	switch class {
+	case "realtime":
+		ioClass = ioprioClassRT
+	case "best-effort":
+		ioClass = ioprioClassBE
+	case "idle":
+		ioClass = ioprioClassIdle
+		level = ioprioDefaultLevel
+	default:
+		return fmt.Errorf("unknown io class '%v'", class)
+	}
+	prio := ioClass<<ioprioClassShift | level
+	_, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, 0, uintptr(prio))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "fmt"
+
+// darwin reports ru_maxrss in bytes
+const maxRSSMultiplier = 1
+
+func setIOPriority(class string, level int) error {
+	return fmt.Errorf("io scheduling classes are only supported on linux")
+}
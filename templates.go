@@ -0,0 +1,21 @@
+package main
+
+import (
+	"bytes"
+	"text/template"
+
+	"github.com/AstromechZA/gaze/conf"
+)
+
+// renderReportTemplate renders a templated behaviour setting using the report as the data
+func renderReportTemplate(name string, text string, report *GazeReport) (string, error) {
+	tmpl, err := template.New(name).Funcs(conf.TemplateFuncs).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buff bytes.Buffer
+	if err := tmpl.Execute(&buff, report); err != nil {
+		return "", err
+	}
+	return buff.String(), nil
+}